@@ -0,0 +1,80 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path"
+)
+
+// appNameHashLen is the length of the hash suffix of HashAppNameSuffix,
+// a dash and 8 hex digits.
+const appNameHashLen = 9
+
+// AppNameTruncation controls how APP-NAME is shortened when longer than the
+// 48 characters allowed by RFC5424, after keeping only the last element of
+// paths.
+type AppNameTruncation int
+
+const (
+	// KeepAppNameHead keeps the first 48 characters, the default.
+	KeepAppNameHead AppNameTruncation = iota
+	// KeepAppNameTail keeps the last 48 characters, for names sharing a
+	// long prefix.
+	KeepAppNameTail
+	// HashAppNameSuffix keeps the first 39 characters followed by a dash and
+	// a hash of the whole name, so that distinct names stay distinct.
+	HashAppNameSuffix
+)
+
+// normalizeAppName makes app a valid APP-NAME with m, shortened with the
+// strategy t.
+func normalizeAppName(app string, t AppNameTruncation, m charMapper) string {
+	if app == "" {
+		return nilValue
+	}
+	if len(app) > maxAppNameLen {
+		app = path.Base(app)
+	}
+	if t == KeepAppNameHead {
+		// Don't split percent-encoded characters
+		app = m.apply(app, maxAppNameLen)
+	} else {
+		app = m.apply(app, 0)
+	}
+	if app == "" {
+		return nilValue
+	}
+	if len(app) <= maxAppNameLen {
+		return app
+	}
+
+	switch t {
+	case KeepAppNameTail:
+		return app[len(app)-maxAppNameLen:]
+	case HashAppNameSuffix:
+		h := fnv.New32a()
+		h.Write([]byte(app))
+		return fmt.Sprintf("%s-%08x", app[:maxAppNameLen-appNameHashLen], h.Sum32())
+	}
+	return app[:maxAppNameLen]
+}
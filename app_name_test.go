@@ -0,0 +1,67 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeAppName(t *testing.T) {
+	prefix := strings.Repeat("service-", 6)
+	a, b := prefix+"billing-worker", prefix+"billing-api"
+
+	assert.Equal(t, "-", normalizeAppName("", KeepAppNameHead, charMapper{}))
+	assert.Equal(t, "my_app", normalizeAppName("my app", HashAppNameSuffix, charMapper{}))
+	assert.Equal(t, "worker", normalizeAppName("/opt/"+prefix+"/worker", KeepAppNameHead, charMapper{}))
+
+	assert.Equal(t, prefix, normalizeAppName(a, KeepAppNameHead, charMapper{}))
+	assert.Equal(t, normalizeAppName(a, KeepAppNameHead, charMapper{}), normalizeAppName(b, KeepAppNameHead, charMapper{}))
+
+	tail := normalizeAppName(a, KeepAppNameTail, charMapper{})
+	assert.Len(t, tail, maxAppNameLen)
+	assert.True(t, strings.HasSuffix(tail, "billing-worker"), tail)
+
+	hashedA, hashedB := normalizeAppName(a, HashAppNameSuffix, charMapper{}), normalizeAppName(b, HashAppNameSuffix, charMapper{})
+	assert.Len(t, hashedA, maxAppNameLen)
+	assert.Len(t, hashedB, maxAppNameLen)
+	assert.NotEqual(t, hashedA, hashedB)
+	assert.Equal(t, a[:maxAppNameLen-appNameHashLen]+"-", hashedA[:maxAppNameLen-appNameHashLen+1])
+	assert.Equal(t, hashedA, normalizeAppName(a, HashAppNameSuffix, charMapper{}), "the hash must be stable")
+}
+
+func TestSyslogEncoderAppNameTruncation(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.App = strings.Repeat("long-app-name-", 4) + "tail"
+	cfg.AppNameTruncation = KeepAppNameTail
+	cfg.AppKey = "app"
+	enc := NewSyslogEncoder(cfg)
+
+	expected := cfg.App[len(cfg.App)-maxAppNameLen:]
+	buf, err := enc.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.Contains(t, buf.String(), " localhost "+expected+" 9876 ")
+	assert.Contains(t, buf.String(), `"app":"`+expected+`"}`)
+}
@@ -0,0 +1,600 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultQueueSize = 1024
+	defaultWriters   = 1
+)
+
+var (
+	_ zapcore.WriteSyncer = &AsyncSyncer{}
+
+	errQueueFull = errors.New("queue full")
+)
+
+// An AsyncOption configures an AsyncSyncer.
+type AsyncOption interface {
+	apply(*AsyncSyncer)
+}
+
+// asyncOptionFunc wraps a func so it satisfies the AsyncOption interface.
+type asyncOptionFunc func(*AsyncSyncer)
+
+func (f asyncOptionFunc) apply(s *AsyncSyncer) {
+	f(s)
+}
+
+// WithQueueSize sets how many messages may be queued before writes are
+// dropped, the default is 1024.
+func WithQueueSize(n int) AsyncOption {
+	return asyncOptionFunc(func(s *AsyncSyncer) {
+		if n < 1 {
+			n = 1
+		}
+		s.size = n
+	})
+}
+
+// WithWriters sets how many goroutines write queued messages concurrently,
+// the default is one. Messages may be written out of order with more than
+// one writer, which only helps if the underlying syncer doesn't serialize
+// writes itself.
+func WithWriters(n int) AsyncOption {
+	return asyncOptionFunc(func(s *AsyncSyncer) {
+		if n < 1 {
+			n = 1
+		}
+		s.writers = n
+	})
+}
+
+// WithSyncSeverity makes messages at severity or above, e.g. syslog.LOG_ERR
+// for zap's Error level and up, skip the queue and be written synchronously,
+// so that they're never dropped because of a full queue. Messages without a
+// syslog PRI are always queued.
+func WithSyncSeverity(severity syslog.Priority) AsyncOption {
+	return asyncOptionFunc(func(s *AsyncSyncer) {
+		s.syncSeverity = severity
+		s.bypass = true
+	})
+}
+
+// WithSeverityEviction makes a full queue evict its least severe message,
+// the oldest of them, to make room for a more severe one instead of dropping
+// the latter, so that debug and info messages go before warnings and errors.
+// Evicted messages are reported as dropped to the queue stats only, their
+// writes having already succeeded.
+func WithSeverityEviction() AsyncOption {
+	return asyncOptionFunc(func(s *AsyncSyncer) {
+		s.evict = true
+	})
+}
+
+// WithBatching makes writers coalesce queued messages into writes of up to
+// size bytes, a single syscall and fewer segments for many messages. It only
+// suits stream transports, TCP, TLS and unix sockets, whose framing keeps
+// the messages apart, preferably OctetCountingFraming. A ConnSyncer's
+// maximum message size applies to whole batches.
+func WithBatching(size int) AsyncOption {
+	return asyncOptionFunc(func(s *AsyncSyncer) {
+		s.batchSize = size
+	})
+}
+
+// WithBatchCallback calls fn after each batch is written to the underlying
+// syncer, from the writer goroutine, so that deliveries can be reconciled.
+// Without WithBatching each message is a batch of its own.
+func WithBatchCallback(fn func(BatchResult)) AsyncOption {
+	return asyncOptionFunc(func(s *AsyncSyncer) {
+		s.onBatch = fn
+	})
+}
+
+// BatchResult describes a batch written by an AsyncSyncer. Queued messages
+// are numbered from 1 in the order they're queued, messages dropped because
+// the queue is full and those written synchronously aren't numbered. The
+// numbers of a batch aren't contiguous if messages were evicted.
+type BatchResult struct {
+	Messages int
+	Bytes    int
+	FirstSeq uint64
+	LastSeq  uint64
+	// Err is the error of the write, none of the messages of the batch are
+	// assumed to be written when set.
+	Err error
+}
+
+// WithQueueWatermarks calls fn with the queue depth when it reaches high, and
+// again when it falls back to low, so that the application may shed load
+// before messages are dropped. fn is called outside of the syncer's lock, one
+// transition at a time and in order, so it must not write to the syncer. The
+// option is ignored unless 0 < low < high.
+func WithQueueWatermarks(high, low int, fn func(depth int, above bool)) AsyncOption {
+	return asyncOptionFunc(func(s *AsyncSyncer) {
+		if low < 1 || high <= low {
+			return
+		}
+		s.high = high
+		s.low = low
+		s.onWatermark = fn
+	})
+}
+
+// WithQueueStats reports the time messages spend queued, and the messages
+// dropped because the queue is full, to st.
+func WithQueueStats(st LatencyStats) AsyncOption {
+	return asyncOptionFunc(func(s *AsyncSyncer) {
+		s.stats = st
+	})
+}
+
+// WithAsyncErrorLogger reports the syncer's own problems, messages dropped
+// because the queue is full and failed writes, which aren't reported
+// otherwise, to l, e.g. a sampled stderr console logger. l must not write to
+// the syncer.
+func WithAsyncErrorLogger(l *zap.Logger) AsyncOption {
+	return asyncOptionFunc(func(s *AsyncSyncer) {
+		s.errLog = l
+	})
+}
+
+type queuedMessage struct {
+	b        []byte
+	queuedAt time.Time
+	severity syslog.Priority
+	seq      uint64
+}
+
+// AsyncSyncer queues messages and writes them to the underlying syncer from
+// background goroutines, so that logging doesn't block on the network.
+// Messages are dropped when the queue is full, write errors of the underlying
+// syncer aren't reported.
+type AsyncSyncer struct {
+	ws zapcore.WriteSyncer
+
+	mu       sync.Mutex
+	cond     *sync.Cond // broadcast when the queue or the closed state change
+	queue    []queuedMessage
+	size     int
+	inflight int
+	seq      uint64   // of the last queued message
+	writing  []uint64 // seq of the first message of each batch being written
+	closed   bool
+	writers  int
+	wg       sync.WaitGroup
+
+	high        int
+	low         int
+	onWatermark func(depth int, above bool)
+	above       bool
+	wmSeq       uint64 // of the last watermark transition
+
+	wmMu        sync.Mutex
+	wmCond      *sync.Cond // broadcast when a transition is delivered
+	wmDelivered uint64
+
+	stats   LatencyStats
+	onBatch func(BatchResult)
+	errLog  *zap.Logger
+
+	bypass       bool
+	syncSeverity syslog.Priority
+	evict        bool
+	batchSize    int
+}
+
+// NewAsyncSyncer returns an asynchronous syncer writing to ws, Close it to
+// stop the background goroutines.
+func NewAsyncSyncer(ws zapcore.WriteSyncer, opts ...AsyncOption) *AsyncSyncer {
+	s := &AsyncSyncer{
+		ws:      ws,
+		size:    defaultQueueSize,
+		writers: defaultWriters,
+		errLog:  zap.NewNop(),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.wmCond = sync.NewCond(&s.wmMu)
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+
+	s.wg.Add(s.writers)
+	for i := 0; i < s.writers; i++ {
+		go s.run()
+	}
+	return s
+}
+
+// Write queues a copy of p, it fails with ErrDropped if the queue is full
+// and ErrNotConnected once the syncer is closed. Critical messages and above,
+// as written by zap for Panic and Fatal entries, are written synchronously
+// after the messages queued before them, and synced. zap's DPanic level maps
+// to the same severity, so DPanic entries are written that way too, even
+// when they don't panic.
+func (s *AsyncSyncer) Write(p []byte) (int, error) {
+	severity, ok := messageSeverity(p)
+	if !ok {
+		severity = syslog.LOG_DEBUG
+	}
+	if ok && severity <= syslog.LOG_CRIT {
+		// zap panics or exits right after writing such entries
+		return s.writeFinal(p)
+	}
+	if s.bypass && ok && severity <= s.syncSeverity {
+		return s.writeSync(p)
+	}
+
+	m := queuedMessage{b: append([]byte(nil), p...), queuedAt: time.Now(), severity: severity}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return 0, newSyncerError(ErrNotConnected, errSyncerClosed)
+	}
+	if len(s.queue) >= s.size && !(s.evict && s.evictLessSevere(severity)) {
+		s.mu.Unlock()
+		err := newSyncerError(ErrDropped, errQueueFull)
+		if s.stats != nil {
+			s.stats.Dropped(err)
+		}
+		s.errLog.Warn("zapsyslog: message dropped", zap.Int("queueSize", s.size), zap.Error(err))
+		return 0, err
+	}
+	s.seq++
+	m.seq = s.seq
+	s.queue = append(s.queue, m)
+	wm, depth, above := s.watermark()
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	s.notifyWatermark(wm, depth, above)
+	return len(p), nil
+}
+
+// evictLessSevere removes the oldest of the least severe queued messages if
+// it's less severe than severity, and tells whether it did.
+func (s *AsyncSyncer) evictLessSevere(severity syslog.Priority) bool {
+	victim := -1
+	for i, m := range s.queue {
+		if m.severity > severity && (victim < 0 || m.severity > s.queue[victim].severity) {
+			victim = i
+		}
+	}
+	if victim < 0 {
+		return false
+	}
+
+	copy(s.queue[victim:], s.queue[victim+1:])
+	s.queue[len(s.queue)-1] = queuedMessage{}
+	s.queue = s.queue[:len(s.queue)-1]
+	if s.stats != nil {
+		s.stats.Dropped(newSyncerError(ErrDropped, errQueueFull))
+	}
+	return true
+}
+
+// writeSync writes p to the underlying syncer, skipping the queue.
+func (s *AsyncSyncer) writeSync(p []byte) (int, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return 0, newSyncerError(ErrNotConnected, errSyncerClosed)
+	}
+	return s.ws.Write(p)
+}
+
+// writeFinal writes p to the underlying syncer once the messages queued
+// before it are written, and syncs it.
+func (s *AsyncSyncer) writeFinal(p []byte) (int, error) {
+	s.mu.Lock()
+	last := s.seq
+	for s.pending(last) {
+		s.cond.Wait()
+	}
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return 0, newSyncerError(ErrNotConnected, errSyncerClosed)
+	}
+
+	n, err := s.ws.Write(p)
+	if serr := s.ws.Sync(); err == nil {
+		err = serr
+	}
+	return n, err
+}
+
+// pending tells whether messages up to seq are queued or being written.
+func (s *AsyncSyncer) pending(seq uint64) bool {
+	if len(s.queue) > 0 && s.queue[0].seq <= seq {
+		return true
+	}
+	for _, first := range s.writing {
+		if first <= seq {
+			return true
+		}
+	}
+	return false
+}
+
+// messageSeverity returns the severity of the syslog message p, which may be
+// octet-counting framed.
+func messageSeverity(p []byte) (syslog.Priority, bool) {
+	i := 0
+	for i < len(p) && p[i] >= '0' && p[i] <= '9' {
+		i++
+	}
+	if i > 0 {
+		// Skip MSG-LEN SP
+		if i == len(p) || p[i] != ' ' {
+			return 0, false
+		}
+		i++
+	}
+	if i == len(p) || p[i] != '<' {
+		return 0, false
+	}
+	i++
+
+	pri := 0
+	start := i
+	for i < len(p) && i-start < 3 && p[i] >= '0' && p[i] <= '9' {
+		pri = pri*10 + int(p[i]-'0')
+		i++
+	}
+	if i == start || i == len(p) || p[i] != '>' {
+		return 0, false
+	}
+	return syslog.Priority(pri) & severityMask, true
+}
+
+// watermark updates the watermark state after the queue changed, it returns
+// the sequence number of the transition to notify, if any, and its
+// arguments.
+func (s *AsyncSyncer) watermark() (seq uint64, depth int, above bool) {
+	if s.onWatermark == nil {
+		return 0, 0, false
+	}
+	depth = len(s.queue)
+	switch {
+	case !s.above && depth >= s.high:
+		s.above = true
+	case s.above && depth <= s.low:
+		s.above = false
+	default:
+		return 0, 0, false
+	}
+	s.wmSeq++
+	return s.wmSeq, depth, s.above
+}
+
+// notifyWatermark calls onWatermark for the transition seq, once the
+// previous transitions have been delivered.
+func (s *AsyncSyncer) notifyWatermark(seq uint64, depth int, above bool) {
+	if seq == 0 {
+		return
+	}
+	s.wmMu.Lock()
+	defer s.wmMu.Unlock()
+	for s.wmDelivered != seq-1 {
+		s.wmCond.Wait()
+	}
+	s.onWatermark(depth, above)
+	s.wmDelivered = seq
+	s.wmCond.Broadcast()
+}
+
+// QueueDepth returns the number of messages queued, not counting those being
+// written.
+func (s *AsyncSyncer) QueueDepth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// run writes the queued messages until the syncer is closed and drained.
+func (s *AsyncSyncer) run() {
+	defer s.wg.Done()
+
+	var batch []queuedMessage
+	var buf []byte
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			return
+		}
+
+		batch = s.takeBatch(batch[:0])
+		s.inflight++
+		first := batch[0].seq
+		s.writing = append(s.writing, first)
+		wm, depth, above := s.watermark()
+		s.mu.Unlock()
+
+		s.notifyWatermark(wm, depth, above)
+		if s.stats != nil {
+			for _, m := range batch {
+				s.stats.ObserveQueue(time.Since(m.queuedAt))
+			}
+		}
+		var (
+			n   int
+			err error
+		)
+		if len(batch) == 1 {
+			n, err = s.ws.Write(batch[0].b)
+		} else {
+			buf = buf[:0]
+			for _, m := range batch {
+				buf = append(buf, m.b...)
+			}
+			n, err = s.ws.Write(buf)
+		}
+		if err != nil {
+			s.errLog.Error("zapsyslog: write failed", zap.Int("messages", len(batch)), zap.Error(err))
+		}
+		if s.onBatch != nil {
+			s.onBatch(BatchResult{
+				Messages: len(batch),
+				Bytes:    n,
+				FirstSeq: first,
+				LastSeq:  batch[len(batch)-1].seq,
+				Err:      err,
+			})
+		}
+		for i := range batch {
+			batch[i] = queuedMessage{}
+		}
+
+		s.mu.Lock()
+		s.inflight--
+		for i, seq := range s.writing {
+			if seq == first {
+				s.writing = append(s.writing[:i], s.writing[i+1:]...)
+				break
+			}
+		}
+		s.cond.Broadcast()
+	}
+}
+
+// takeBatch moves the next message from the queue to batch, followed by the
+// next ones as long as the batch fits in batchSize bytes.
+func (s *AsyncSyncer) takeBatch(batch []queuedMessage) []queuedMessage {
+	size := 0
+	for i, m := range s.queue {
+		if i > 0 && size+len(m.b) > s.batchSize {
+			break
+		}
+		size += len(m.b)
+		batch = append(batch, m)
+		s.queue[i] = queuedMessage{}
+	}
+	s.queue = s.queue[len(batch):]
+	return batch
+}
+
+// Sync waits for the queued messages to be written, then syncs the
+// underlying syncer.
+func (s *AsyncSyncer) Sync() error {
+	s.mu.Lock()
+	for len(s.queue) > 0 || s.inflight > 0 {
+		s.cond.Wait()
+	}
+	s.mu.Unlock()
+	return s.ws.Sync()
+}
+
+// Close stops accepting messages, waits for the queued ones to be written,
+// then syncs and closes the underlying syncer if it's an io.Closer.
+func (s *AsyncSyncer) Close() error {
+	s.Drain(context.Background())
+	return s.closeSyncer()
+}
+
+// CloseWithTimeout is like Close, but gives up writing the queued messages
+// after d and returns how many were abandoned. Syncing and closing the
+// underlying syncer are bounded by the same deadline, when it passes they
+// carry on in the background, e.g. until a blocked write returns.
+func (s *AsyncSyncer) CloseWithTimeout(d time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	abandoned, err := s.Drain(ctx)
+	closed := make(chan error, 1)
+	go func() {
+		closed <- s.closeSyncer()
+	}()
+	select {
+	case cerr := <-closed:
+		if err == nil {
+			err = cerr
+		}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return abandoned, err
+}
+
+// Drain stops accepting messages and waits for the queued ones to be
+// written. When ctx is done first, the messages still queued are abandoned
+// and Drain returns how many they were along with the context error, a
+// message being written at that time may still make it.
+func (s *AsyncSyncer) Drain(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return 0, nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	abandoned := len(s.queue)
+	s.queue = nil
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	if s.stats != nil {
+		for i := 0; i < abandoned; i++ {
+			s.stats.Dropped(newSyncerError(ErrDropped, ctx.Err()))
+		}
+	}
+	return abandoned, ctx.Err()
+}
+
+// closeSyncer syncs and closes the underlying syncer.
+func (s *AsyncSyncer) closeSyncer() error {
+	err := s.ws.Sync()
+	if c, ok := s.ws.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
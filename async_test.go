@@ -0,0 +1,541 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// gatedSyncer records the messages written to it, writes block until the
+// gate is opened.
+type gatedSyncer struct {
+	gate chan struct{}
+
+	mu      sync.Mutex
+	written []string
+	synced  int
+	closed  bool
+}
+
+func newGatedSyncer() *gatedSyncer {
+	return &gatedSyncer{gate: make(chan struct{})}
+}
+
+func (s *gatedSyncer) open() {
+	close(s.gate)
+}
+
+func (s *gatedSyncer) Write(p []byte) (int, error) {
+	<-s.gate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written = append(s.written, string(p))
+	return len(p), nil
+}
+
+func (s *gatedSyncer) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.synced++
+	return nil
+}
+
+func (s *gatedSyncer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *gatedSyncer) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.written...)
+}
+
+// heldSyncer blocks the writes of the messages in held until their channel
+// is closed, other messages are written right away.
+type heldSyncer struct {
+	*gatedSyncer
+	held map[string]chan struct{}
+}
+
+func newHeldSyncer(msgs ...string) *heldSyncer {
+	s := &heldSyncer{gatedSyncer: newGatedSyncer(), held: make(map[string]chan struct{})}
+	s.open()
+	for _, msg := range msgs {
+		s.held[msg] = make(chan struct{})
+	}
+	return s
+}
+
+func (s *heldSyncer) release(msg string) {
+	close(s.held[msg])
+}
+
+func (s *heldSyncer) Write(p []byte) (int, error) {
+	if held, ok := s.held[string(p)]; ok {
+		<-held
+	}
+	return s.gatedSyncer.Write(p)
+}
+
+func TestAsyncSyncer(t *testing.T) {
+	ws := newGatedSyncer()
+	ws.open()
+	s := NewAsyncSyncer(ws)
+
+	var expected []string
+	for i := 0; i < 100; i++ {
+		msg := strconv.Itoa(i)
+		expected = append(expected, msg)
+		n, err := s.Write([]byte(msg))
+		require.NoError(t, err)
+		assert.Equal(t, len(msg), n)
+	}
+	require.NoError(t, s.Sync())
+	assert.Equal(t, expected, ws.messages())
+	assert.Equal(t, 1, ws.synced)
+
+	require.NoError(t, s.Close())
+	assert.True(t, ws.closed)
+	_, err := s.Write([]byte("late"))
+	assert.True(t, errors.Is(err, ErrNotConnected))
+}
+
+func TestAsyncSyncerQueueFull(t *testing.T) {
+	ws := newGatedSyncer()
+	st := &recordingStats{}
+	s := NewAsyncSyncer(ws, WithQueueStats(st))
+
+	// One message may be taken by the writer, blocked on the gate
+	var err error
+	for i := 0; i <= defaultQueueSize+1 && err == nil; i++ {
+		_, err = s.Write([]byte("x"))
+	}
+	assert.True(t, errors.Is(err, ErrDropped))
+	require.Len(t, st.dropped, 1)
+
+	ws.open()
+	require.NoError(t, s.Close())
+	assert.True(t, len(ws.messages()) >= defaultQueueSize)
+	assert.Equal(t, len(ws.messages()), len(st.queue))
+}
+
+func TestAsyncSyncerWatermarks(t *testing.T) {
+	ws := newGatedSyncer()
+	type event struct {
+		depth int
+		above bool
+	}
+	var mu sync.Mutex
+	var events []event
+	s := NewAsyncSyncer(ws, WithQueueWatermarks(10, 2, func(depth int, above bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event{depth, above})
+	}))
+
+	for i := 0; i < 20; i++ {
+		_, err := s.Write([]byte("x"))
+		require.NoError(t, err)
+	}
+	ws.open()
+	require.NoError(t, s.Sync())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, events, 2)
+	assert.True(t, events[0].above)
+	assert.Equal(t, 10, events[0].depth)
+	assert.False(t, events[1].above)
+	assert.Equal(t, 2, events[1].depth)
+}
+
+func TestAsyncSyncerWatermarksOrder(t *testing.T) {
+	ws := newGatedSyncer()
+	ws.open()
+	var mu sync.Mutex
+	var transitions []bool
+	s := NewAsyncSyncer(ws, WithWriters(4), WithQueueWatermarks(2, 1, func(depth int, above bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		transitions = append(transitions, above)
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				s.Write([]byte("x"))
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, s.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, above := range transitions {
+		require.Equal(t, i%2 == 0, above, "transition %d", i)
+	}
+}
+
+func TestAsyncSyncerInvalidWatermarks(t *testing.T) {
+	for _, wm := range [][2]int{{0, 0}, {-1, -2}, {2, 2}, {2, 0}} {
+		fired := false
+		ws := newGatedSyncer()
+		ws.open()
+		s := NewAsyncSyncer(ws, WithQueueWatermarks(wm[0], wm[1], func(int, bool) {
+			fired = true
+		}))
+		_, err := s.Write([]byte("x"))
+		require.NoError(t, err)
+		require.NoError(t, s.Close())
+		assert.False(t, fired, "watermarks %v", wm)
+	}
+}
+
+func TestAsyncSyncerQueueSizeAndWriters(t *testing.T) {
+	ws := newGatedSyncer()
+	s := NewAsyncSyncer(ws, WithQueueSize(4), WithWriters(3))
+
+	// Up to three messages may be taken by the writers, blocked on the gate
+	var written int
+	for i := 0; i < 10; i++ {
+		if _, err := s.Write([]byte(strconv.Itoa(i))); err == nil {
+			written++
+		}
+	}
+	assert.True(t, written >= 4 && written <= 7, "written: %d", written)
+
+	ws.open()
+	require.NoError(t, s.Close())
+	assert.Len(t, ws.messages(), written)
+}
+
+func TestMessageSeverity(t *testing.T) {
+	for _, tt := range []struct {
+		msg      string
+		severity syslog.Priority
+		ok       bool
+	}{
+		{"<131>1 - - - - - -", syslog.LOG_ERR, true},
+		{"18 <134>1 - - - - - -", syslog.LOG_INFO, true},
+		{"<0>1", syslog.LOG_EMERG, true},
+		{"<>1", 0, false},
+		{"<1311>1", 0, false},
+		{"18<134>1", 0, false},
+		{"hello", 0, false},
+		{"", 0, false},
+	} {
+		severity, ok := messageSeverity([]byte(tt.msg))
+		assert.Equal(t, tt.ok, ok, "msg: %q", tt.msg)
+		assert.Equal(t, tt.severity, severity, "msg: %q", tt.msg)
+	}
+}
+
+func TestAsyncSyncerSyncSeverity(t *testing.T) {
+	ws := newHeldSyncer("<134>1 info")
+	s := NewAsyncSyncer(ws, WithQueueSize(1), WithSyncSeverity(syslog.LOG_ERR))
+
+	// Fill the queue, the writer may be blocked on the first message
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		_, err = s.Write([]byte("<134>1 info"))
+	}
+	require.True(t, errors.Is(err, ErrDropped))
+
+	// Written while the queued messages are still held
+	_, err = s.Write([]byte("<131>1 error"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"<131>1 error"}, ws.messages())
+
+	ws.release("<134>1 info")
+	require.NoError(t, s.Close())
+	assert.Contains(t, ws.messages(), "<134>1 info")
+}
+
+func TestAsyncSyncerSeverityEviction(t *testing.T) {
+	ws := newGatedSyncer()
+	st := &recordingStats{}
+	s := NewAsyncSyncer(ws, WithQueueSize(3), WithSeverityEviction(), WithQueueStats(st))
+
+	// Block the writer on a first message
+	_, err := s.Write([]byte("<134>1 blocked"))
+	require.NoError(t, err)
+	for {
+		s.mu.Lock()
+		n := len(s.queue)
+		s.mu.Unlock()
+		if n == 0 {
+			break
+		}
+	}
+
+	for _, msg := range []string{"<134>1 info1", "<135>1 debug", "<134>1 info2", "<132>1 warn", "<131>1 err", "<135>1 debug2"} {
+		s.Write([]byte(msg))
+	}
+	ws.open()
+	require.NoError(t, s.Close())
+	assert.Equal(t, []string{"<134>1 blocked", "<134>1 info2", "<132>1 warn", "<131>1 err"}, ws.messages())
+	assert.Len(t, st.dropped, 3)
+}
+
+func TestAsyncSyncerCloseWithTimeout(t *testing.T) {
+	ws := newGatedSyncer()
+	st := &recordingStats{}
+	s := NewAsyncSyncer(ws, WithQueueStats(st))
+	for i := 0; i < 5; i++ {
+		_, err := s.Write([]byte(strconv.Itoa(i)))
+		require.NoError(t, err)
+	}
+
+	// The writer is blocked on the first message
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ws.open()
+	}()
+	abandoned, err := s.CloseWithTimeout(10 * time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 4, abandoned)
+	assert.Len(t, st.dropped, 4)
+
+	_, err = s.Write([]byte("late"))
+	assert.True(t, errors.Is(err, ErrNotConnected))
+
+	// Closed in the background once the blocked write returns
+	assert.Eventually(t, func() bool {
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		return ws.closed
+	}, time.Second, time.Millisecond)
+}
+
+// lockedSyncer holds its lock while a write blocks, like a ConnSyncer stuck
+// in a network write.
+type lockedSyncer struct {
+	mu   sync.Mutex
+	gate chan struct{}
+}
+
+func (s *lockedSyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	<-s.gate
+	return len(p), nil
+}
+
+func (s *lockedSyncer) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return nil
+}
+
+func (s *lockedSyncer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return nil
+}
+
+func TestAsyncSyncerCloseWithTimeoutBlockedWrite(t *testing.T) {
+	ws := &lockedSyncer{gate: make(chan struct{})}
+	defer close(ws.gate)
+	s := NewAsyncSyncer(ws)
+	_, err := s.Write([]byte("0"))
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := s.CloseWithTimeout(10 * time.Millisecond)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.DeadlineExceeded, err)
+	case <-time.After(time.Second):
+		t.Fatal("CloseWithTimeout blocked on the underlying syncer")
+	}
+}
+
+func TestAsyncSyncerDrain(t *testing.T) {
+	ws := newGatedSyncer()
+	ws.open()
+	s := NewAsyncSyncer(ws)
+	for i := 0; i < 5; i++ {
+		_, err := s.Write([]byte(strconv.Itoa(i)))
+		require.NoError(t, err)
+	}
+
+	abandoned, err := s.Drain(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, abandoned)
+	assert.Len(t, ws.messages(), 5)
+	assert.False(t, ws.closed)
+}
+
+func TestAsyncSyncerFlushesOnCritical(t *testing.T) {
+	ws := newGatedSyncer()
+	s := NewAsyncSyncer(ws)
+	for i := 0; i < 3; i++ {
+		_, err := s.Write([]byte(strconv.Itoa(i)))
+		require.NoError(t, err)
+	}
+
+	written := make(chan error)
+	go func() {
+		_, err := s.Write([]byte("<130>1 panic"))
+		written <- err
+	}()
+	select {
+	case <-written:
+		t.Fatal("Critical message written before the queued ones")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	ws.open()
+	require.NoError(t, <-written)
+	assert.Equal(t, []string{"0", "1", "2", "<130>1 panic"}, ws.messages())
+	ws.mu.Lock()
+	assert.Equal(t, 1, ws.synced)
+	ws.mu.Unlock()
+	require.NoError(t, s.Close())
+}
+
+func TestAsyncSyncerCriticalSkipsLaterMessages(t *testing.T) {
+	ws := newHeldSyncer("0", "late")
+	defer ws.release("late")
+	s := NewAsyncSyncer(ws)
+	_, err := s.Write([]byte("0"))
+	require.NoError(t, err)
+
+	written := make(chan error)
+	go func() {
+		_, err := s.Write([]byte("<130>1 panic"))
+		written <- err
+	}()
+	// Queued after the critical message, so it's not waited for
+	time.Sleep(10 * time.Millisecond)
+	_, err = s.Write([]byte("late"))
+	require.NoError(t, err)
+	ws.release("0")
+
+	select {
+	case err := <-written:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Critical message waited for a message queued after it")
+	}
+	assert.Equal(t, []string{"0", "<130>1 panic"}, ws.messages())
+}
+
+func TestAsyncSyncerBatching(t *testing.T) {
+	ws := newGatedSyncer()
+	st := &recordingStats{}
+	var results []BatchResult
+	s := NewAsyncSyncer(ws, WithBatching(12), WithQueueStats(st), WithBatchCallback(func(r BatchResult) {
+		results = append(results, r)
+	}))
+
+	// The writer takes the first message alone, the others are batched
+	// while it's blocked
+	for _, msg := range []string{"<14>1 first", "<14>1a", "<14>1b", "<14>1c", "<14>1d"} {
+		_, err := s.Write([]byte(msg))
+		require.NoError(t, err)
+	}
+	for {
+		s.mu.Lock()
+		n := s.inflight
+		s.mu.Unlock()
+		if n > 0 {
+			break
+		}
+	}
+	ws.open()
+	require.NoError(t, s.Close())
+
+	messages := ws.messages()
+	require.Len(t, messages, 3)
+	assert.Equal(t, "<14>1 first", messages[0])
+	assert.Equal(t, "<14>1a<14>1b", messages[1])
+	assert.Equal(t, "<14>1c<14>1d", messages[2])
+	assert.Len(t, st.queue, 5)
+	assert.Equal(t, []BatchResult{
+		{Messages: 1, Bytes: 11, FirstSeq: 1, LastSeq: 1},
+		{Messages: 2, Bytes: 12, FirstSeq: 2, LastSeq: 3},
+		{Messages: 2, Bytes: 12, FirstSeq: 4, LastSeq: 5},
+	}, results)
+}
+
+func TestAsyncSyncerBatchCallbackError(t *testing.T) {
+	ws := &flakySyncer{down: true}
+	var results []BatchResult
+	s := NewAsyncSyncer(ws, WithBatchCallback(func(r BatchResult) {
+		results = append(results, r)
+	}))
+	_, err := s.Write([]byte("<14>1 lost"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	require.Len(t, results, 1)
+	assert.True(t, errors.Is(results[0].Err, ErrNotConnected))
+	assert.Equal(t, 1, results[0].Messages)
+	assert.Equal(t, uint64(1), results[0].FirstSeq)
+}
+
+func TestAsyncSyncerErrorLogger(t *testing.T) {
+	ws := newGatedSyncer()
+	core, logs := observer.New(zapcore.DebugLevel)
+	s := NewAsyncSyncer(ws, WithQueueSize(1), WithAsyncErrorLogger(zap.New(core)))
+
+	_, err := s.Write([]byte("held"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.inflight == 1
+	}, time.Second, time.Millisecond)
+	_, err = s.Write([]byte("queued"))
+	require.NoError(t, err)
+	_, err = s.Write([]byte("dropped"))
+	require.Error(t, err)
+
+	ws.open()
+	require.NoError(t, s.Close())
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	assert.Equal(t, "zapsyslog: message dropped", entry.Message)
+	assert.Equal(t, int64(1), entry.ContextMap()["queueSize"])
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+)
+
+// AtomicFacility is a facility that can be changed at runtime, e.g. to
+// re-route logs during an incident, like zap.AtomicLevel. Encoders configured
+// with it pick up changes with their next entry. Copies share the same
+// facility, it's safe for concurrent use.
+type AtomicFacility struct {
+	f *int32
+}
+
+// NewAtomicFacility returns an AtomicFacility set to facility, LOG_USER if
+// it isn't valid.
+func NewAtomicFacility(facility syslog.Priority) AtomicFacility {
+	a := AtomicFacility{f: new(int32)}
+	if a.SetFacility(facility) != nil {
+		a.SetFacility(syslog.LOG_USER)
+	}
+	return a
+}
+
+// Facility returns the current facility.
+func (a AtomicFacility) Facility() syslog.Priority {
+	return syslog.Priority(atomic.LoadInt32(a.f))
+}
+
+// SetFacility changes the facility, it fails unless facility is one of
+// LOG_KERN to LOG_LOCAL7.
+func (a AtomicFacility) SetFacility(facility syslog.Priority) error {
+	if _, err := syslog.Compose(facility, 0); err != nil {
+		return err
+	}
+	atomic.StoreInt32(a.f, int32(facility))
+	return nil
+}
+
+// String returns the keyword of the current facility, e.g. "local0".
+func (a AtomicFacility) String() string {
+	return a.Facility().FacilityKeyword()
+}
+
+// MarshalText marshals the current facility as its keyword.
+func (a AtomicFacility) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText sets the facility from its keyword, e.g. "local0",
+// allocating the AtomicFacility if needed.
+func (a *AtomicFacility) UnmarshalText(text []byte) error {
+	facility, err := syslog.FacilityPriority(string(text))
+	if err != nil {
+		return err
+	}
+	if a.f == nil {
+		a.f = new(int32)
+	}
+	return a.SetFacility(facility)
+}
+
+type facilityPayload struct {
+	Facility *AtomicFacility `json:"facility"`
+}
+
+type errorPayload struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP is a simple JSON endpoint reporting the current facility on GET
+// requests, and changing it on PUT requests, e.g. with {"facility":"local3"}.
+func (a AtomicFacility) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		enc.Encode(facilityPayload{Facility: &a})
+	case http.MethodPut:
+		var req facilityPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(errorPayload{Error: fmt.Sprintf("Request body must be well-formed JSON: %v", err)})
+			return
+		}
+		if req.Facility == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(errorPayload{Error: "Must specify a facility."})
+			return
+		}
+		a.SetFacility(req.Facility.Facility())
+		enc.Encode(facilityPayload{Facility: &a})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		enc.Encode(errorPayload{Error: "Only GET and PUT are supported."})
+	}
+}
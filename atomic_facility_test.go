@@ -0,0 +1,106 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func encodedPriority(t testing.TB, enc zapcore.Encoder) syslog.Priority {
+	buf, err := enc.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+	msg, err := syslog.ParseMessage([]byte(strings.TrimSuffix(buf.String(), "\n")))
+	require.NoError(t, err)
+	return msg.Priority
+}
+
+func TestAtomicFacility(t *testing.T) {
+	facility := NewAtomicFacility(syslog.LOG_LOCAL1)
+	cfg := testEncoderConfig(NonTransparentFraming)
+	cfg.AtomicFacility = facility
+	enc := NewSyslogEncoder(cfg)
+	clone := enc.Clone()
+
+	assert.Equal(t, syslog.LOG_LOCAL1|syslog.LOG_DEBUG, encodedPriority(t, enc))
+	require.NoError(t, facility.SetFacility(syslog.LOG_LOCAL3))
+	assert.Equal(t, syslog.LOG_LOCAL3|syslog.LOG_DEBUG, encodedPriority(t, enc))
+	assert.Equal(t, syslog.LOG_LOCAL3|syslog.LOG_DEBUG, encodedPriority(t, clone), "Clones should follow the facility.")
+	assert.Equal(t, syslog.LOG_AUTH|syslog.LOG_DEBUG, encodedPriority(t, WithFacility(enc, syslog.LOG_AUTH)),
+		"Derived encoders should use their own facility.")
+
+	assert.Error(t, facility.SetFacility(syslog.LOG_ERR), "Severities should be rejected.")
+	assert.Error(t, facility.SetFacility(syslog.Priority(192)))
+	assert.Equal(t, "local3", facility.String())
+	assert.Equal(t, syslog.LOG_USER, NewAtomicFacility(-1).Facility())
+}
+
+func TestAtomicFacilityText(t *testing.T) {
+	var facility AtomicFacility
+	require.NoError(t, facility.UnmarshalText([]byte("LOCAL5")))
+	assert.Equal(t, syslog.LOG_LOCAL5, facility.Facility())
+	text, err := facility.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "local5", string(text))
+	assert.Error(t, facility.UnmarshalText([]byte("nope")))
+}
+
+func TestAtomicFacilityServeHTTP(t *testing.T) {
+	facility := NewAtomicFacility(syslog.LOG_LOCAL0)
+	srv := httptest.NewServer(facility)
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		method   string
+		body     string
+		status   int
+		response string
+	}{
+		{http.MethodGet, "", http.StatusOK, `{"facility":"local0"}`},
+		{http.MethodPut, `{"facility":"local3"}`, http.StatusOK, `{"facility":"local3"}`},
+		{http.MethodPut, `{"facility":"nope"}`, http.StatusBadRequest, ""},
+		{http.MethodPut, `{}`, http.StatusBadRequest, `{"error":"Must specify a facility."}`},
+		{http.MethodPost, "", http.StatusMethodNotAllowed, `{"error":"Only GET and PUT are supported."}`},
+	} {
+		req, err := http.NewRequest(tt.method, srv.URL, strings.NewReader(tt.body))
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		res.Body.Close()
+
+		assert.Equal(t, tt.status, res.StatusCode, "%s %s", tt.method, tt.body)
+		if tt.response != "" {
+			assert.Equal(t, tt.response+"\n", string(body), "%s %s", tt.method, tt.body)
+		}
+	}
+	assert.Equal(t, syslog.LOG_LOCAL3, facility.Facility())
+}
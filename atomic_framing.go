@@ -0,0 +1,60 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// AtomicFraming is a framing that can be changed at runtime, so that
+// collectors can be migrated from one framing to the other without
+// restarting producers. Encoders configured with it pick up changes with
+// their next entry. Copies share the same framing, it's safe for concurrent
+// use.
+type AtomicFraming struct {
+	f *int32
+}
+
+// NewAtomicFraming returns an AtomicFraming set to framing, DefaultFraming
+// if it isn't valid.
+func NewAtomicFraming(framing Framing) AtomicFraming {
+	a := AtomicFraming{f: new(int32)}
+	if a.SetFraming(framing) != nil {
+		a.SetFraming(DefaultFraming)
+	}
+	return a
+}
+
+// Framing returns the current framing.
+func (a AtomicFraming) Framing() Framing {
+	return Framing(atomic.LoadInt32(a.f))
+}
+
+// SetFraming changes the framing, it fails unless framing is
+// NonTransparentFraming or OctetCountingFraming.
+func (a AtomicFraming) SetFraming(framing Framing) error {
+	if framing != NonTransparentFraming && framing != OctetCountingFraming {
+		return fmt.Errorf("zapsyslog: invalid framing: %d", framing)
+	}
+	atomic.StoreInt32(a.f, int32(framing))
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomicFraming(t *testing.T) {
+	framing := NewAtomicFraming(NonTransparentFraming)
+	cfg := testEncoderConfig(NonTransparentFraming)
+	cfg.AtomicFraming = framing
+	enc := NewSyslogEncoder(cfg)
+
+	var stream bytes.Buffer
+	encode := func() {
+		buf, err := enc.EncodeEntry(testEntry, nil)
+		require.NoError(t, err)
+		stream.Write(buf.Bytes())
+		buf.Free()
+	}
+	encode()
+	require.NoError(t, framing.SetFraming(OctetCountingFraming))
+	encode()
+	require.NoError(t, framing.SetFraming(NonTransparentFraming))
+	encode()
+
+	// Receivers detecting the framing of each message can follow the switch
+	scanner := bufio.NewScanner(&stream)
+	scanner.Split(syslog.ScanFrames)
+	var frames int
+	for scanner.Scan() {
+		_, err := syslog.ParseMessage(scanner.Bytes())
+		require.NoError(t, err)
+		frames++
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, 3, frames)
+
+	assert.Error(t, framing.SetFraming(Framing(2)))
+	assert.Equal(t, NonTransparentFraming, framing.Framing())
+	assert.Equal(t, DefaultFraming, NewAtomicFraming(Framing(-1)).Framing())
+}
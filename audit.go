@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+
+	"github.com/imperfectgo/zap-syslog/internal/bufferpool"
+	"go.uber.org/zap/buffer"
+)
+
+const (
+	// maxSequenceID is the largest sequenceId, RFC5424 section 7.3.1.
+	maxSequenceID = 2147483647
+
+	defaultIntegritySDID = "hmac@32473"
+)
+
+// sequence numbers the messages of an encoder and its clones.
+type sequence struct {
+	n uint64
+}
+
+// next returns the next sequenceId, from 1 to maxSequenceID and back to 1.
+func (s *sequence) next() uint64 {
+	return (atomic.AddUint64(&s.n, 1)-1)%maxSequenceID + 1
+}
+
+// appendSequenceSDElement appends the RFC5424 meta element holding id.
+func appendSequenceSDElement(buf *buffer.Buffer, id uint64) {
+	buf.AppendString(`[meta sequenceId="`)
+	buf.AppendUint(id)
+	buf.AppendString(`"]`)
+}
+
+// signMessage returns msg with an SD-ELEMENT inserted at offset at, holding
+// the hex encoded HMAC-SHA256 of msg, i.e. of the message without the
+// element. The trailing LF of non-transparent framing isn't signed. msg is
+// freed.
+func signMessage(msg *buffer.Buffer, at int, id string, key []byte, framing Framing) *buffer.Buffer {
+	b := msg.Bytes()
+	signed := b
+	if framing != OctetCountingFraming && len(signed) > 0 && signed[len(signed)-1] == '\n' {
+		signed = signed[:len(signed)-1]
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signed)
+
+	out := bufferpool.Get()
+	growBuffer(out, len(b)+len(id)+sha256.Size*2+len(` sha256=""[]`))
+	out.Write(b[:at])
+	out.AppendByte('[')
+	out.AppendString(id)
+	out.AppendString(` sha256="`)
+	out.AppendString(hex.EncodeToString(mac.Sum(nil)))
+	out.AppendString(`"]`)
+	out.Write(b[at:])
+	msg.Free()
+	return out
+}
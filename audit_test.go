@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// verifySignature checks the signature of the SYSLOG-MSG b, without
+// transport framing, the way a collector would.
+func verifySignature(t *testing.T, b []byte, id string, key []byte) bool {
+	prefix := "[" + id + ` sha256="`
+	start := bytes.Index(b, []byte(prefix))
+	require.True(t, start > 0, "No signature in %q", b)
+	end := start + len(prefix) + sha256.Size*2 + len(`"]`)
+	require.True(t, end <= len(b), "Truncated signature in %q", b)
+	sum, err := hex.DecodeString(string(b[start+len(prefix) : end-len(`"]`)]))
+	require.NoError(t, err)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b[:start])
+	mac.Write(b[end:])
+	return hmac.Equal(sum, mac.Sum(nil))
+}
+
+func TestSequenceWraps(t *testing.T) {
+	s := &sequence{}
+	assert.Equal(t, uint64(1), s.next())
+	assert.Equal(t, uint64(2), s.next())
+	s.n = maxSequenceID - 1
+	assert.Equal(t, uint64(maxSequenceID), s.next())
+	assert.Equal(t, uint64(1), s.next())
+}
+
+func TestSyslogEncoderSequenceIDs(t *testing.T) {
+	cfg := testEncoderConfig(NonTransparentFraming)
+	cfg.SequenceIDs = true
+	enc := NewSyslogEncoder(cfg)
+	clone := WithApp(enc.Clone(), "other")
+
+	for i, e := range []zapcore.Encoder{enc, clone, enc} {
+		buf, err := e.EncodeEntry(testEntry, nil)
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), ` - [meta sequenceId="`+strconv.Itoa(i+1)+`"] `, "Clones should share the sequence.")
+		buf.Free()
+	}
+}
+
+func TestSyslogEncoderIntegrity(t *testing.T) {
+	key := []byte("secret")
+	for _, framing := range []Framing{NonTransparentFraming, OctetCountingFraming} {
+		for _, sequenceIDs := range []bool{false, true} {
+			cfg := testEncoderConfig(framing)
+			cfg.SequenceIDs = sequenceIDs
+			cfg.IntegrityKey = key
+			enc := NewSyslogEncoder(cfg)
+
+			buf, err := enc.EncodeEntry(testEntry, []zapcore.Field{zap.String("user", "alice")})
+			require.NoError(t, err)
+			msg := buf.Bytes()
+			if framing == OctetCountingFraming {
+				msg = msg[bytes.IndexByte(msg, ' ')+1:]
+			} else {
+				msg = bytes.TrimSuffix(msg, []byte("\n"))
+			}
+			assert.Contains(t, string(msg), ` 9876 - [`)
+			assert.True(t, verifySignature(t, msg, defaultIntegritySDID, key), "Invalid signature: %q", msg)
+
+			tampered := []byte(strings.Replace(string(msg), "alice", "mallory", 1))
+			assert.False(t, verifySignature(t, tampered, defaultIntegritySDID, key), "Tampering should be detected.")
+			assert.False(t, verifySignature(t, msg, defaultIntegritySDID, []byte("other")))
+			buf.Free()
+		}
+	}
+}
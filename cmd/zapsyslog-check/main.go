@@ -0,0 +1,141 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command zapsyslog-check validates syslog messages read from files, or from
+// stdin, against the RFC5424 grammar and RFC6587 framing, reporting which
+// field of each message is malformed.
+//
+//	nc -lk 514 | zapsyslog-check
+//
+// pcap and pcapng captures are read directly: each UDP datagram is checked as
+// a message, and TCP streams are reassembled before being split into frames.
+// Only the traffic to or from the -ports is checked, IP fragments aren't
+// reassembled.
+//
+//	tcpdump -i any -w - port 514 | zapsyslog-check -q
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+)
+
+const maxMessageSize = 1 << 20
+
+func main() {
+	quiet := flag.Bool("q", false, "only report invalid messages")
+	portList := flag.String("ports", "514,601", "comma separated ports of the syslog traffic in captures, empty for all")
+	flag.Parse()
+
+	ports, err := parsePorts(*portList)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zapsyslog-check:", err)
+		os.Exit(2)
+	}
+	var invalid int
+	if flag.NArg() == 0 {
+		invalid, err = checkInput(os.Stdin, "-", os.Stdout, *quiet, ports)
+	}
+	for _, name := range flag.Args() {
+		var f *os.File
+		if f, err = os.Open(name); err != nil {
+			break
+		}
+		var n int
+		n, err = checkInput(f, name, os.Stdout, *quiet, ports)
+		f.Close()
+		invalid += n
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zapsyslog-check:", err)
+		os.Exit(2)
+	}
+	if invalid > 0 {
+		os.Exit(1)
+	}
+}
+
+// parsePorts parses a comma separated list of ports.
+func parsePorts(s string) (map[int]bool, error) {
+	ports := make(map[int]bool)
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n <= 0 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+		ports[n] = true
+	}
+	return ports, nil
+}
+
+// checkInput checks r as a capture file, or as a stream of frames.
+func checkInput(r io.Reader, name string, w io.Writer, quiet bool, ports map[int]bool) (int, error) {
+	br := bufio.NewReader(r)
+	if isCapture(br) {
+		return checkCapture(br, name, w, quiet, ports)
+	}
+	return check(br, name, w, quiet)
+}
+
+// check validates the frames read from r and reports them to w, it returns
+// the number of invalid messages.
+func check(r io.Reader, name string, w io.Writer, quiet bool) (int, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxMessageSize)
+	s.Split(syslog.ScanFrames)
+
+	var n, invalid int
+	for s.Scan() {
+		n++
+		if !report(w, name, n, s.Bytes(), quiet) {
+			invalid++
+		}
+	}
+	if err := s.Err(); err != nil {
+		return invalid, fmt.Errorf("%s: after message %d: %s", name, n, err)
+	}
+	return invalid, nil
+}
+
+// report validates the nth message and reports it to w, it returns whether
+// the message is valid.
+func report(w io.Writer, name string, n int, msg []byte, quiet bool) bool {
+	if _, err := syslog.ParseMessage(msg); err != nil {
+		fmt.Fprintf(w, "%s: message %d: %s\n\t%q\n", name, n, err, msg)
+		return false
+	}
+	if !quiet {
+		fmt.Fprintf(w, "%s: message %d: ok\n", name, n)
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	in := "<13>1 - host app - - - hello\n" +
+		"<13>1 - host app - - [k=v] hello\n" +
+		"17 <13>1 - - - - - -"
+	var out bytes.Buffer
+	invalid, err := check(strings.NewReader(in), "in", &out, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, invalid)
+	assert.Equal(t, "in: message 1: ok\n"+
+		"in: message 2: syslog: invalid SD-ELEMENT at offset 23: expected ']'\n"+
+		"\t\"<13>1 - host app - - [k=v] hello\"\n"+
+		"in: message 3: ok\n", out.String())
+}
+
+func TestCheckInvalidFrame(t *testing.T) {
+	var out bytes.Buffer
+	_, err := check(strings.NewReader("20 <13>1 - - - - - -"), "in", &out, true)
+	assert.EqualError(t, err, "in: after message 0: syslog: invalid octet-counting frame")
+}
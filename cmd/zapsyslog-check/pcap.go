@@ -0,0 +1,477 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Capture file magic numbers, as read in big endian order.
+const (
+	pcapMagic        = 0xa1b2c3d4
+	pcapMagicNano    = 0xa1b23c4d
+	pcapMagicSwapped = 0xd4c3b2a1
+	pcapNanoSwapped  = 0x4d3cb2a1
+	pcapngMagic      = 0x0a0d0d0a
+	pcapngByteOrder  = 0x1a2b3c4d
+	pcapngSwapped    = 0x4d3c2b1a
+)
+
+// Link types of the captured packets.
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkSLL      = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+	linkSLL2     = 276
+)
+
+// pcapng block types.
+const (
+	blockInterface    = 0x00000001
+	blockPacket       = 0x00000002 // obsolete
+	blockSimplePacket = 0x00000003
+	blockEnhanced     = 0x00000006
+)
+
+const (
+	ipProtoTCP = 6
+	ipProtoUDP = 17
+
+	tcpSYN = 0x02
+)
+
+var errInvalidCapture = errors.New("invalid capture file")
+
+// isCapture reports whether r starts like a pcap or pcapng file.
+func isCapture(r *bufio.Reader) bool {
+	b, err := r.Peek(4)
+	if err != nil {
+		return false
+	}
+	switch binary.BigEndian.Uint32(b) {
+	case pcapMagic, pcapMagicNano, pcapMagicSwapped, pcapNanoSwapped, pcapngMagic:
+		return true
+	}
+	return false
+}
+
+// flow is the payload sent from one address to another.
+type flow struct {
+	name string
+	udp  bool
+
+	// UDP
+	datagrams [][]byte
+
+	// TCP, segments are appended to stream once the ones before them are
+	started bool
+	next    uint32
+	stream  []byte
+	pending map[uint32][]byte
+}
+
+// addSegment adds the payload of a TCP segment starting at seq.
+func (f *flow) addSegment(seq uint32, flags byte, payload []byte) {
+	if !f.started {
+		f.started = true
+		f.next = seq
+		f.pending = make(map[uint32][]byte)
+	}
+	if flags&tcpSYN != 0 {
+		// The SYN flag takes a sequence number
+		if seq == f.next {
+			f.next++
+		}
+		seq++
+	}
+	if len(payload) > 0 {
+		if d := int32(seq - f.next); d > 0 {
+			f.pending[seq] = append([]byte(nil), payload...)
+		} else {
+			f.append(seq, payload)
+		}
+	}
+	for {
+		p, ok := f.pending[f.next]
+		if !ok {
+			break
+		}
+		delete(f.pending, f.next)
+		f.append(f.next, p)
+	}
+}
+
+// append appends the part of the segment starting at seq, not before the
+// next sequence number, to the stream.
+func (f *flow) append(seq uint32, payload []byte) {
+	if skip := int(f.next - seq); skip < len(payload) {
+		f.stream = append(f.stream, payload[skip:]...)
+		f.next = seq + uint32(len(payload))
+	}
+}
+
+// capture holds the syslog flows read from a capture file.
+type capture struct {
+	ports     map[int]bool // all ports if empty
+	flows     []*flow
+	byName    map[string]*flow
+	fragments int
+	truncated int
+}
+
+func newCapture(ports map[int]bool) *capture {
+	return &capture{ports: ports, byName: make(map[string]*flow)}
+}
+
+func (c *capture) flow(proto string, src, dst net.IP, sport, dport int) *flow {
+	name := proto + " " + net.JoinHostPort(src.String(), strconv.Itoa(sport)) +
+		" > " + net.JoinHostPort(dst.String(), strconv.Itoa(dport))
+	f, ok := c.byName[name]
+	if !ok {
+		f = &flow{name: name, udp: proto == "udp"}
+		c.byName[name] = f
+		c.flows = append(c.flows, f)
+	}
+	return f
+}
+
+// read reads the packets of the pcap or pcapng file r.
+func (c *capture) read(r *bufio.Reader) error {
+	b, err := r.Peek(4)
+	if err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(b) == pcapngMagic {
+		return c.readPcapng(r)
+	}
+	return c.readPcap(r)
+}
+
+func (c *capture) readPcap(r io.Reader) error {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return errInvalidCapture
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if m := order.Uint32(hdr[:]); m == pcapMagicSwapped || m == pcapNanoSwapped {
+		order = binary.LittleEndian
+	}
+	link := int(order.Uint32(hdr[20:]) & 0xffff)
+
+	for {
+		var rec [16]byte
+		if _, err := io.ReadFull(r, rec[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errInvalidCapture
+		}
+		capLen, origLen := order.Uint32(rec[8:]), order.Uint32(rec[12:])
+		if capLen > maxMessageSize+1<<16 {
+			return errInvalidCapture
+		}
+		data := make([]byte, capLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return errInvalidCapture
+		}
+		c.packet(link, data, capLen < origLen)
+	}
+}
+
+func (c *capture) readPcapng(r io.Reader) error {
+	var order binary.ByteOrder = binary.BigEndian
+	var links []int
+	for {
+		var hdr [12]byte
+		if _, err := io.ReadFull(r, hdr[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errInvalidCapture
+		}
+		typ := binary.BigEndian.Uint32(hdr[:])
+		if typ == pcapngMagic {
+			// A new section, with its own byte order and interfaces
+			switch binary.BigEndian.Uint32(hdr[8:]) {
+			case pcapngByteOrder:
+				order = binary.BigEndian
+			case pcapngSwapped:
+				order = binary.LittleEndian
+			default:
+				return errInvalidCapture
+			}
+			links = links[:0]
+		} else {
+			typ = order.Uint32(hdr[:])
+		}
+		n := order.Uint32(hdr[4:])
+		if n < 12 || n%4 != 0 || n > maxMessageSize+1<<16 || typ == pcapngMagic && n < 28 {
+			return errInvalidCapture
+		}
+		// The body and the trailing length, their first 4 bytes were read
+		// with the header
+		body := make([]byte, n-8)
+		copy(body, hdr[8:])
+		if _, err := io.ReadFull(r, body[4:]); err != nil {
+			return errInvalidCapture
+		}
+		body = body[:len(body)-4]
+
+		switch typ {
+		case pcapngMagic:
+		case blockInterface:
+			if len(body) < 8 {
+				return errInvalidCapture
+			}
+			links = append(links, int(order.Uint16(body)))
+		case blockEnhanced, blockPacket:
+			if len(body) < 20 {
+				return errInvalidCapture
+			}
+			var iface int
+			if typ == blockEnhanced {
+				iface = int(order.Uint32(body))
+			} else {
+				iface = int(order.Uint16(body))
+			}
+			capLen, origLen := order.Uint32(body[12:]), order.Uint32(body[16:])
+			if iface >= len(links) || uint32(len(body)-20) < capLen {
+				return errInvalidCapture
+			}
+			c.packet(links[iface], body[20:20+capLen], capLen < origLen)
+		case blockSimplePacket:
+			if len(body) < 4 || len(links) == 0 {
+				return errInvalidCapture
+			}
+			origLen := order.Uint32(body)
+			data := body[4:]
+			if uint32(len(data)) > origLen {
+				data = data[:origLen]
+			}
+			c.packet(links[0], data, uint32(len(data)) < origLen)
+		}
+	}
+}
+
+// packet decodes the link layer of a captured packet.
+func (c *capture) packet(link int, b []byte, truncated bool) {
+	var ethertype uint16
+	switch link {
+	case linkEthernet:
+		if len(b) < 14 {
+			return
+		}
+		ethertype, b = binary.BigEndian.Uint16(b[12:]), b[14:]
+		// VLAN tags
+		for (ethertype == 0x8100 || ethertype == 0x88a8 || ethertype == 0x9100) && len(b) >= 4 {
+			ethertype, b = binary.BigEndian.Uint16(b[2:]), b[4:]
+		}
+	case linkNull, linkLoop:
+		if len(b) < 4 {
+			return
+		}
+		// The address family, in the byte order of the capturing host
+		family := binary.LittleEndian.Uint32(b)
+		if family > 0xffff {
+			family = binary.BigEndian.Uint32(b)
+		}
+		switch family {
+		case 2:
+			ethertype = 0x0800
+		case 10, 24, 28, 30:
+			ethertype = 0x86dd
+		}
+		b = b[4:]
+	case linkSLL:
+		if len(b) < 16 {
+			return
+		}
+		ethertype, b = binary.BigEndian.Uint16(b[14:]), b[16:]
+	case linkSLL2:
+		if len(b) < 20 {
+			return
+		}
+		ethertype, b = binary.BigEndian.Uint16(b), b[20:]
+	case linkRaw, linkIPv4, linkIPv6:
+		if len(b) == 0 {
+			return
+		}
+		switch b[0] >> 4 {
+		case 4:
+			ethertype = 0x0800
+		case 6:
+			ethertype = 0x86dd
+		}
+	default:
+		return
+	}
+
+	switch ethertype {
+	case 0x0800:
+		c.ipv4(b, truncated)
+	case 0x86dd:
+		c.ipv6(b, truncated)
+	}
+}
+
+func (c *capture) ipv4(b []byte, truncated bool) {
+	if len(b) < 20 || b[0]>>4 != 4 {
+		return
+	}
+	ihl := int(b[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(b[2:]))
+	if ihl < 20 || total < ihl || len(b) < ihl {
+		return
+	}
+	if frag := binary.BigEndian.Uint16(b[6:]); frag&0x3fff != 0 {
+		// More fragments, or an offset
+		c.fragments++
+		return
+	}
+	if len(b) > total {
+		// Link layer padding
+		b = b[:total]
+	}
+	c.transport(b[9], net.IP(b[12:16]), net.IP(b[16:20]), b[ihl:], truncated || len(b) < total)
+}
+
+func (c *capture) ipv6(b []byte, truncated bool) {
+	if len(b) < 40 || b[0]>>4 != 6 {
+		return
+	}
+	total := 40 + int(binary.BigEndian.Uint16(b[4:]))
+	if len(b) > total {
+		b = b[:total]
+	}
+	truncated = truncated || len(b) < total
+	src, dst := net.IP(b[8:24]), net.IP(b[24:40])
+	next, p := b[6], b[40:]
+	for {
+		switch next {
+		case 0, 43, 60: // hop-by-hop, routing and destination options
+			if len(p) < 8 || len(p) < (int(p[1])+1)*8 {
+				return
+			}
+			next, p = p[0], p[(int(p[1])+1)*8:]
+			continue
+		case 51: // authentication header
+			if len(p) < 8 || len(p) < (int(p[1])+2)*4 {
+				return
+			}
+			next, p = p[0], p[(int(p[1])+2)*4:]
+			continue
+		case 44:
+			c.fragments++
+			return
+		}
+		c.transport(next, src, dst, p, truncated)
+		return
+	}
+}
+
+func (c *capture) transport(proto byte, src, dst net.IP, b []byte, truncated bool) {
+	switch proto {
+	case ipProtoUDP:
+		if len(b) < 8 {
+			return
+		}
+		sport, dport := int(binary.BigEndian.Uint16(b)), int(binary.BigEndian.Uint16(b[2:]))
+		if !c.wanted(sport, dport) {
+			return
+		}
+		if n := int(binary.BigEndian.Uint16(b[4:])); n >= 8 && n < len(b) {
+			b = b[:n]
+		}
+		if truncated {
+			c.truncated++
+			return
+		}
+		f := c.flow("udp", src, dst, sport, dport)
+		f.datagrams = append(f.datagrams, append([]byte(nil), b[8:]...))
+	case ipProtoTCP:
+		if len(b) < 20 {
+			return
+		}
+		sport, dport := int(binary.BigEndian.Uint16(b)), int(binary.BigEndian.Uint16(b[2:]))
+		off := int(b[12]>>4) * 4
+		if !c.wanted(sport, dport) || off < 20 || len(b) < off {
+			return
+		}
+		if truncated {
+			c.truncated++
+		}
+		f := c.flow("tcp", src, dst, sport, dport)
+		f.addSegment(binary.BigEndian.Uint32(b[4:]), b[13], b[off:])
+	}
+}
+
+func (c *capture) wanted(sport, dport int) bool {
+	return len(c.ports) == 0 || c.ports[sport] || c.ports[dport]
+}
+
+// checkCapture validates the syslog messages carried by the UDP datagrams
+// and TCP streams of the pcap or pcapng file r, and reports them to w. It
+// returns the number of invalid messages.
+func checkCapture(r *bufio.Reader, name string, w io.Writer, quiet bool, ports map[int]bool) (int, error) {
+	c := newCapture(ports)
+	if err := c.read(r); err != nil {
+		return 0, fmt.Errorf("%s: %s", name, err)
+	}
+
+	var invalid int
+	for _, f := range c.flows {
+		fname := name + ": " + f.name
+		if f.udp {
+			// One message per datagram, without framing
+			for i, d := range f.datagrams {
+				if !report(w, fname, i+1, d, quiet) {
+					invalid++
+				}
+			}
+			continue
+		}
+		n, err := check(bytes.NewReader(f.stream), fname, w, quiet)
+		invalid += n
+		if err != nil {
+			return invalid, err
+		}
+		if len(f.pending) > 0 {
+			invalid++
+			fmt.Fprintf(w, "%s: segments missing from the capture, the rest of the stream isn't checked\n", fname)
+		}
+	}
+	if c.fragments > 0 {
+		fmt.Fprintf(w, "%s: %d IP fragments not checked\n", name, c.fragments)
+	}
+	if c.truncated > 0 {
+		fmt.Fprintf(w, "%s: %d packets truncated by the capture length\n", name, c.truncated)
+	}
+	return invalid, nil
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPacket struct {
+	data    []byte
+	origLen int // len(data) if zero
+}
+
+func ipv4Packet(proto byte, src, dst string, transport []byte) []byte {
+	b := make([]byte, 20, 20+len(transport))
+	b[0] = 0x45
+	binary.BigEndian.PutUint16(b[2:], uint16(20+len(transport)))
+	b[8], b[9] = 64, proto
+	copy(b[12:], net.ParseIP(src).To4())
+	copy(b[16:], net.ParseIP(dst).To4())
+	return append(b, transport...)
+}
+
+func ipv6Packet(proto byte, src, dst string, transport []byte) []byte {
+	b := make([]byte, 40, 40+len(transport))
+	b[0] = 0x60
+	binary.BigEndian.PutUint16(b[4:], uint16(len(transport)))
+	b[6], b[7] = proto, 64
+	copy(b[8:], net.ParseIP(src))
+	copy(b[24:], net.ParseIP(dst))
+	return append(b, transport...)
+}
+
+func udpDatagram(sport, dport int, payload string) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(b, uint16(sport))
+	binary.BigEndian.PutUint16(b[2:], uint16(dport))
+	binary.BigEndian.PutUint16(b[4:], uint16(8+len(payload)))
+	return append(b, payload...)
+}
+
+func tcpSegment(sport, dport int, seq uint32, flags byte, payload string) []byte {
+	b := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(b, uint16(sport))
+	binary.BigEndian.PutUint16(b[2:], uint16(dport))
+	binary.BigEndian.PutUint32(b[4:], seq)
+	b[12], b[13] = 5<<4, flags
+	return append(b, payload...)
+}
+
+func ethernetFrame(ethertype uint16, payload []byte) []byte {
+	b := make([]byte, 14, 14+len(payload)+60)
+	binary.BigEndian.PutUint16(b[12:], ethertype)
+	b = append(b, payload...)
+	for len(b) < 60 {
+		// Minimum frame size
+		b = append(b, 0)
+	}
+	return b
+}
+
+func sllFrame(ethertype uint16, payload []byte) []byte {
+	b := make([]byte, 16, 16+len(payload))
+	binary.BigEndian.PutUint16(b[14:], ethertype)
+	return append(b, payload...)
+}
+
+func pcapFile(order binary.ByteOrder, link int, packets []testPacket) []byte {
+	var buf bytes.Buffer
+	hdr := make([]byte, 24)
+	order.PutUint32(hdr, pcapMagic)
+	order.PutUint16(hdr[4:], 2)
+	order.PutUint16(hdr[6:], 4)
+	order.PutUint32(hdr[16:], 65535)
+	order.PutUint32(hdr[20:], uint32(link))
+	buf.Write(hdr)
+	for _, p := range packets {
+		rec := make([]byte, 16)
+		order.PutUint32(rec[8:], uint32(len(p.data)))
+		origLen := p.origLen
+		if origLen == 0 {
+			origLen = len(p.data)
+		}
+		order.PutUint32(rec[12:], uint32(origLen))
+		buf.Write(rec)
+		buf.Write(p.data)
+	}
+	return buf.Bytes()
+}
+
+func pcapngBlock(order binary.ByteOrder, typ uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	b := make([]byte, 8, 12+len(body))
+	order.PutUint32(b, typ)
+	order.PutUint32(b[4:], uint32(12+len(body)))
+	b = append(b, body...)
+	trailer := make([]byte, 4)
+	order.PutUint32(trailer, uint32(12+len(body)))
+	return append(b, trailer...)
+}
+
+func pcapngFile(order binary.ByteOrder, link int, packets []testPacket) []byte {
+	shb := make([]byte, 16)
+	order.PutUint32(shb, pcapngByteOrder)
+	order.PutUint16(shb[4:], 1)
+	binary.BigEndian.PutUint64(shb[8:], 0xffffffffffffffff)
+	idb := make([]byte, 8)
+	order.PutUint16(idb, uint16(link))
+	order.PutUint32(idb[4:], 65535)
+
+	b := pcapngBlock(order, pcapngMagic, shb)
+	b = append(b, pcapngBlock(order, blockInterface, idb)...)
+	for _, p := range packets {
+		epb := make([]byte, 20, 20+len(p.data))
+		order.PutUint32(epb[12:], uint32(len(p.data)))
+		origLen := p.origLen
+		if origLen == 0 {
+			origLen = len(p.data)
+		}
+		order.PutUint32(epb[16:], uint32(origLen))
+		b = append(b, pcapngBlock(order, blockEnhanced, append(epb, p.data...))...)
+	}
+	return b
+}
+
+func checkTestCapture(t *testing.T, b []byte) (int, string) {
+	var out bytes.Buffer
+	invalid, err := checkInput(bytes.NewReader(b), "c", &out, false, map[int]bool{514: true})
+	require.NoError(t, err)
+	return invalid, out.String()
+}
+
+func TestCheckCaptureUDP(t *testing.T) {
+	packets := []testPacket{
+		{data: ethernetFrame(0x0800, ipv4Packet(ipProtoUDP, "192.0.2.1", "192.0.2.2", udpDatagram(40000, 514, "<13>1 - - - - - -")))},
+		{data: ethernetFrame(0x0800, ipv4Packet(ipProtoUDP, "192.0.2.1", "192.0.2.3", udpDatagram(40001, 53, "not syslog")))},
+		{data: ethernetFrame(0x0800, ipv4Packet(ipProtoUDP, "192.0.2.1", "192.0.2.2", udpDatagram(40000, 514, "<13>1 - host app - - [k=v] hello")))},
+	}
+	for _, b := range [][]byte{
+		pcapFile(binary.LittleEndian, linkEthernet, packets),
+		pcapFile(binary.BigEndian, linkEthernet, packets),
+		pcapngFile(binary.LittleEndian, linkEthernet, packets),
+		pcapngFile(binary.BigEndian, linkEthernet, packets),
+	} {
+		invalid, out := checkTestCapture(t, b)
+		assert.Equal(t, 1, invalid)
+		assert.Equal(t, "c: udp 192.0.2.1:40000 > 192.0.2.2:514: message 1: ok\n"+
+			"c: udp 192.0.2.1:40000 > 192.0.2.2:514: message 2: syslog: invalid SD-ELEMENT at offset 23: expected ']'\n"+
+			"\t\"<13>1 - host app - - [k=v] hello\"\n", out, "Ethernet padding and other ports should be ignored.")
+	}
+}
+
+func TestCheckCaptureTCP(t *testing.T) {
+	const src, dst = "2001:db8::1", "2001:db8::2"
+	seg := func(seq uint32, flags byte, payload string) testPacket {
+		return testPacket{data: sllFrame(0x86dd, ipv6Packet(ipProtoTCP, src, dst, tcpSegment(40000, 601, seq, flags, payload)))}
+	}
+	// Frames split across segments, out of order and retransmitted
+	b := pcapngFile(binary.LittleEndian, linkSLL, []testPacket{
+		seg(999, tcpSYN, ""),
+		seg(1000, 0, "17 <13>1 - -"),
+		seg(1020, 0, "<13>1 - host app - - [k=v] hello\n"),
+		seg(1012, 0, " - - - -"),
+		seg(1012, 0, " - - - -"),
+	})
+	var out bytes.Buffer
+	invalid, err := checkInput(bytes.NewReader(b), "c", &out, false, map[int]bool{601: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, invalid)
+	assert.Equal(t, "c: tcp [2001:db8::1]:40000 > [2001:db8::2]:601: message 1: ok\n"+
+		"c: tcp [2001:db8::1]:40000 > [2001:db8::2]:601: message 2: syslog: invalid SD-ELEMENT at offset 23: expected ']'\n"+
+		"\t\"<13>1 - host app - - [k=v] hello\"\n", out.String())
+}
+
+func TestCheckCaptureIncomplete(t *testing.T) {
+	ip := func(transport []byte) []byte {
+		return ipv4Packet(ipProtoTCP, "192.0.2.1", "192.0.2.2", transport)
+	}
+	frag := ipv4Packet(ipProtoUDP, "192.0.2.1", "192.0.2.2", udpDatagram(40000, 514, "<13>1 - - - - - -"))
+	frag[6] = 0x20 // more fragments
+	b := pcapFile(binary.LittleEndian, linkRaw, []testPacket{
+		{data: ip(tcpSegment(40000, 514, 1, 0, "<13>1 - - - - - -\n"))},
+		{data: ip(tcpSegment(40000, 514, 40, 0, "<13>1 - - - - - -\n"))},
+		{data: frag},
+		{data: ipv4Packet(ipProtoUDP, "192.0.2.1", "192.0.2.2", udpDatagram(40000, 514, "<13>1")), origLen: 100},
+	})
+	invalid, out := checkTestCapture(t, b)
+	assert.Equal(t, 1, invalid)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, []string{
+		"c: tcp 192.0.2.1:40000 > 192.0.2.2:514: message 1: ok",
+		"c: tcp 192.0.2.1:40000 > 192.0.2.2:514: segments missing from the capture, the rest of the stream isn't checked",
+		"c: 1 IP fragments not checked",
+		"c: 1 packets truncated by the capture length",
+	}, lines)
+}
+
+func TestIsCapture(t *testing.T) {
+	for _, b := range [][]byte{
+		pcapFile(binary.LittleEndian, linkEthernet, nil),
+		pcapngFile(binary.BigEndian, linkEthernet, nil),
+	} {
+		assert.True(t, isCapture(bufio.NewReader(bytes.NewReader(b))))
+	}
+	assert.False(t, isCapture(bufio.NewReader(strings.NewReader("<13>1 - - - - - -\n"))))
+
+	_, err := checkInput(bytes.NewReader(pcapFile(binary.LittleEndian, linkEthernet, nil)[:20]), "c", &bytes.Buffer{}, true, nil)
+	assert.EqualError(t, err, "c: invalid capture file")
+}
+
+func TestParsePorts(t *testing.T) {
+	ports, err := parsePorts("514, 601,")
+	require.NoError(t, err)
+	assert.Equal(t, map[int]bool{514: true, 601: true}, ports)
+
+	ports, err = parsePorts("")
+	require.NoError(t, err)
+	assert.Empty(t, ports)
+
+	_, err = parsePorts("syslog")
+	assert.Error(t, err)
+}
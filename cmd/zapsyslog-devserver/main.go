@@ -0,0 +1,204 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command zapsyslog-devserver is a development syslog receiver, it decodes
+// the framing and the RFC5424 header of the messages it receives and prints
+// them, so that the output of a service can be seen without running a
+// syslog daemon.
+//
+//	zapsyslog-devserver -udp :5514 -tcp :5514
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+)
+
+const (
+	maxMessageSize = 1 << 20
+	timeFormat     = "15:04:05.000000"
+
+	colorReset  = "\x1b[0m"
+	colorFaint  = "\x1b[2m"
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorCyan   = "\x1b[36m"
+)
+
+// printer prints messages, one at a time.
+type printer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	color bool
+}
+
+func (p *printer) paint(color, s string) string {
+	if !p.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func severityColor(severity syslog.Priority) string {
+	switch {
+	case severity <= syslog.LOG_ERR:
+		return colorRed
+	case severity == syslog.LOG_WARNING:
+		return colorYellow
+	case severity == syslog.LOG_DEBUG:
+		return colorFaint
+	}
+	return colorBlue
+}
+
+// print prints the message b received from src.
+func (p *printer) print(src string, b []byte) {
+	var out bytes.Buffer
+	m, err := syslog.ParseMessage(b)
+	if err != nil {
+		fmt.Fprintf(&out, "%s\n\t%q\n", p.paint(colorRed, src+": "+err.Error()), b)
+	} else {
+		ts := "-"
+		if !m.Timestamp.IsZero() {
+			ts = m.Timestamp.Format(timeFormat)
+		}
+		severity := m.Severity()
+		fmt.Fprintf(&out, "%s %s %s %s\n",
+			p.paint(colorFaint, ts),
+			p.paint(severityColor(severity), fmt.Sprintf("%-7s", severity.Keyword())),
+			p.paint(colorCyan, fmt.Sprintf("%s %s[%s] %s", m.Hostname, m.AppName, m.ProcID, m.MsgID)),
+			bytes.TrimRight(m.Msg, "\n"))
+		for _, e := range m.StructuredData {
+			fmt.Fprintf(&out, "\t%s", p.paint(colorFaint, "["+e.ID+"]"))
+			for _, param := range e.Params {
+				fmt.Fprintf(&out, " %s=%q", param.Name, param.Value)
+			}
+			out.WriteByte('\n')
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.w.Write(out.Bytes())
+}
+
+// serveStream prints the framed messages read from r.
+func (p *printer) serveStream(r io.Reader, src string) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxMessageSize)
+	s.Split(syslog.ScanFrames)
+	for s.Scan() {
+		p.print(src, s.Bytes())
+	}
+	return s.Err()
+}
+
+func (p *printer) listenStream(network, addr string) error {
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("listening on %s %s", network, ln.Addr())
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Fatal(err)
+			}
+			go func() {
+				defer conn.Close()
+				src := network + " " + conn.RemoteAddr().String()
+				if err := p.serveStream(conn, src); err != nil {
+					log.Printf("%s: %s", src, err)
+				}
+			}()
+		}
+	}()
+	return nil
+}
+
+func (p *printer) listenPacket(network, addr string) error {
+	pc, err := net.ListenPacket(network, addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("listening on %s %s", network, pc.LocalAddr())
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				log.Fatal(err)
+			}
+			src := network
+			if from != nil {
+				src += " " + from.String()
+			}
+			p.print(src, bytes.TrimSuffix(buf[:n], []byte("\n")))
+		}
+	}()
+	return nil
+}
+
+func main() {
+	var (
+		udpAddr  = flag.String("udp", ":5514", "UDP address to listen on, empty to disable")
+		tcpAddr  = flag.String("tcp", ":5514", "TCP address to listen on, empty to disable")
+		unixPath = flag.String("unix", "", "path of a unix stream socket to listen on")
+		gramPath = flag.String("unixgram", "", "path of a unix datagram socket to listen on")
+		noColor  = flag.Bool("no-color", false, "disable colors")
+	)
+	flag.Parse()
+
+	p := &printer{w: os.Stdout, color: !*noColor}
+	var listening bool
+	for _, l := range []struct {
+		listen  func(network, addr string) error
+		network string
+		addr    string
+	}{
+		{p.listenPacket, "udp", *udpAddr},
+		{p.listenStream, "tcp", *tcpAddr},
+		{p.listenStream, "unix", *unixPath},
+		{p.listenPacket, "unixgram", *gramPath},
+	} {
+		if l.addr == "" {
+			continue
+		}
+		if err := l.listen(l.network, l.addr); err != nil {
+			log.Fatal(err)
+		}
+		listening = true
+	}
+	if !listening {
+		log.Fatal("nothing to listen on")
+	}
+	select {}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrinterServeStream(t *testing.T) {
+	var out bytes.Buffer
+	p := &printer{w: &out}
+	framed := "<12>1 2017-01-02T03:04:05.123456Z host app 42 ID1 - \xef\xbb\xbf{\"a\":1}"
+	in := strconv.Itoa(len(framed)) + " " + framed +
+		"<15>1 - host app 42 - [meta k=\"v\"] debug\n" +
+		"oops\n"
+	require.NoError(t, p.serveStream(strings.NewReader(in), "test"))
+
+	assert.Equal(t, "03:04:05.123456 warning host app[42] ID1 {\"a\":1}\n"+
+		"- debug   host app[42] - debug\n"+
+		"\t[meta] k=\"v\"\n"+
+		"test: syslog: invalid PRI at offset 0: expected '<'\n"+
+		"\t\"oops\"\n", out.String())
+}
+
+func TestPrinterColor(t *testing.T) {
+	var out bytes.Buffer
+	p := &printer{w: &out, color: true}
+	p.print("test", []byte("<11>1 - host app - - - failed"))
+	assert.Equal(t, colorFaint+"-"+colorReset+" "+colorRed+"err    "+colorReset+" "+
+		colorCyan+"host app[-] -"+colorReset+" failed\n", out.String())
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command zapsyslog-send sends crafted syslog messages, to verify the
+// configuration of a collector before deploying services.
+//
+//	zapsyslog-send -network tcp -addr localhost:514 -facility local0 \
+//		-level warn -sd 'meta@32473 env=dev' "Hello, world!"
+//
+// -severity sends any syslog severity, e.g. notice or alert which no zap
+// level maps to. The level in the JSON body is the syslog severity keyword.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	zapsyslog "github.com/imperfectgo/zap-syslog"
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const rfc3164TimestampFormat = "Jan _2 15:04:05"
+
+// sdFlags collects repeated -sd flags.
+type sdFlags []zapsyslog.SDElement
+
+func (f *sdFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *sdFlags) Set(s string) error {
+	e, err := parseSDElement(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, e)
+	return nil
+}
+
+// parseSDElement parses "ID name=value ...", e.g. "meta@32473 env=dev".
+func parseSDElement(s string) (zapsyslog.SDElement, error) {
+	parts := strings.Fields(s)
+	if len(parts) == 0 {
+		return zapsyslog.SDElement{}, errors.New("empty SD element")
+	}
+	e := zapsyslog.SDElement{ID: parts[0]}
+	for _, p := range parts[1:] {
+		i := strings.IndexByte(p, '=')
+		if i <= 0 {
+			return zapsyslog.SDElement{}, fmt.Errorf("invalid SD param %q, want name=value", p)
+		}
+		e.Params = append(e.Params, zapsyslog.SDParam{Name: p[:i], Value: p[i+1:]})
+	}
+	return e, nil
+}
+
+// severityFlag is a syslog severity given by name or number.
+type severityFlag struct {
+	severity syslog.Priority
+	set      bool
+}
+
+func (f *severityFlag) String() string {
+	if !f.set {
+		return ""
+	}
+	return strconv.Itoa(int(f.severity))
+}
+
+func (f *severityFlag) Set(s string) error {
+	severity, err := syslog.KeywordSeverity(s)
+	if err != nil {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < int(syslog.LOG_EMERG) || n > int(syslog.LOG_DEBUG) {
+			return fmt.Errorf("invalid severity %q, want a name or 0 to 7", s)
+		}
+		severity = syslog.Priority(n)
+	}
+	f.severity, f.set = severity, true
+	return nil
+}
+
+// formatRFC3164 formats a BSD syslog message, framed as requested.
+func formatRFC3164(facility, severity syslog.Priority, t time.Time, hostname, app string, pid int, msg string, framing zapsyslog.Framing) []byte {
+	s := fmt.Sprintf("<%d>%s %s %s[%d]: %s", facility|severity, t.Format(rfc3164TimestampFormat), hostname, app, pid, msg)
+	return frame(s, framing)
+}
+
+func frame(s string, framing zapsyslog.Framing) []byte {
+	if framing == zapsyslog.OctetCountingFraming {
+		return []byte(strconv.Itoa(len(s)) + " " + s)
+	}
+	return []byte(s + "\n")
+}
+
+// newEncoder returns the RFC5424 encoder of the messages. The body level is
+// the syslog severity keyword, so that it agrees with PRI when -severity
+// overrides the severity of -level.
+func newEncoder(o *options, framing zapsyslog.Framing, facility syslog.Priority) zapcore.Encoder {
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.LevelKey = ""
+	enc := zapsyslog.NewSyslogEncoder(zapsyslog.SyslogEncoderConfig{
+		EncoderConfig:    cfg,
+		Framing:          framing,
+		Facility:         facility,
+		Hostname:         o.hostname,
+		App:              o.app,
+		StructuredData:   o.sd,
+		SeverityKey:      "level",
+		PriorityKeywords: true,
+	})
+	if o.severity.set {
+		enc = zapsyslog.WithSeverity(enc, o.severity.severity)
+	}
+	return enc
+}
+
+func parseFraming(s string) (zapsyslog.Framing, error) {
+	switch s {
+	case "lf", "non-transparent":
+		return zapsyslog.NonTransparentFraming, nil
+	case "octet", "octet-counting":
+		return zapsyslog.OctetCountingFraming, nil
+	}
+	return 0, fmt.Errorf("invalid framing: %s", s)
+}
+
+func tlsConfig(caFile string, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	return cfg, nil
+}
+
+// options are the command line flags.
+type options struct {
+	network  string
+	addr     string
+	format   string
+	framing  string
+	facility string
+	level    zapcore.Level
+	severity severityFlag
+	hostname string
+	app      string
+	count    int
+	useTLS   bool
+	caFile   string
+	insecure bool
+	sd       sdFlags
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.network, "network", "udp", "transport: udp, tcp, unix or unixgram")
+	flag.StringVar(&o.addr, "addr", "localhost:514", "address of the collector")
+	flag.StringVar(&o.format, "format", "rfc5424", "message format: rfc5424 or rfc3164")
+	flag.StringVar(&o.framing, "framing", "lf", "framing: lf or octet")
+	flag.StringVar(&o.facility, "facility", "user", "syslog facility")
+	flag.Var(&o.level, "level", "zap level, mapped to the syslog severity")
+	flag.Var(&o.severity, "severity", "syslog severity, name or number, overriding the one of -level")
+	flag.StringVar(&o.hostname, "hostname", "", "HOSTNAME, defaults to the system hostname")
+	flag.StringVar(&o.app, "app", "zapsyslog-send", "APP-NAME")
+	flag.IntVar(&o.count, "n", 1, "number of messages to send")
+	flag.BoolVar(&o.useTLS, "tls", false, "connect with TLS")
+	flag.StringVar(&o.caFile, "tls-ca", "", "PEM file of the CA to verify the collector with")
+	flag.BoolVar(&o.insecure, "tls-insecure", false, "skip verification of the collector certificate")
+	flag.Var(&o.sd, "sd", `STRUCTURED-DATA element "ID name=value ...", may be repeated`)
+	flag.Parse()
+
+	msg := strings.Join(flag.Args(), " ")
+	if msg == "" {
+		msg = "zapsyslog-send test message"
+	}
+	if err := o.send(msg); err != nil {
+		fmt.Fprintln(os.Stderr, "zapsyslog-send:", err)
+		os.Exit(1)
+	}
+}
+
+func (o *options) send(msg string) (err error) {
+	framing, err := parseFraming(o.framing)
+	if err != nil {
+		return err
+	}
+	facility, err := syslog.FacilityPriority(o.facility)
+	if err != nil {
+		return err
+	}
+
+	var opts []zapsyslog.SyncerOption
+	if o.useTLS {
+		cfg, err := tlsConfig(o.caFile, o.insecure)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, zapsyslog.WithTLSConfig(cfg))
+	}
+	sink, err := zapsyslog.NewConnSyncer(o.network, o.addr, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := sink.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	severity := zapsyslog.PriorityFromLevel(o.level)
+	if o.severity.set {
+		severity = o.severity.severity
+	}
+
+	switch o.format {
+	case "rfc5424":
+		// Write to the core directly, so that fatal and panic levels don't
+		// terminate the command
+		core := zapcore.NewCore(newEncoder(o, framing, facility), sink, zapcore.DebugLevel)
+		for i := 0; i < o.count; i++ {
+			ent := zapcore.Entry{Level: o.level, Time: time.Now(), Message: msg}
+			if err := core.Write(ent, []zapcore.Field{zap.Int("seq", i)}); err != nil {
+				return err
+			}
+		}
+		return core.Sync()
+	case "rfc3164":
+		if len(o.sd) > 0 {
+			return errors.New("STRUCTURED-DATA is not supported by rfc3164")
+		}
+		hostname := o.hostname
+		if hostname == "" {
+			hostname, _ = os.Hostname()
+		}
+		for i := 0; i < o.count; i++ {
+			b := formatRFC3164(facility, severity, time.Now(), hostname, o.app, os.Getpid(), msg, framing)
+			if _, err := sink.Write(b); err != nil {
+				return err
+			}
+		}
+		return sink.Sync()
+	}
+	return fmt.Errorf("invalid format: %s", o.format)
+}
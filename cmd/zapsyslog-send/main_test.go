@@ -0,0 +1,107 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	zapsyslog "github.com/imperfectgo/zap-syslog"
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseSDElement(t *testing.T) {
+	e, err := parseSDElement("meta@32473 env=dev  empty= k=a=b")
+	require.NoError(t, err)
+	assert.Equal(t, zapsyslog.SDElement{
+		ID: "meta@32473",
+		Params: []zapsyslog.SDParam{
+			{Name: "env", Value: "dev"},
+			{Name: "empty", Value: ""},
+			{Name: "k", Value: "a=b"},
+		},
+	}, e)
+
+	_, err = parseSDElement(" ")
+	assert.Error(t, err)
+	_, err = parseSDElement("meta@32473 =v")
+	assert.Error(t, err)
+}
+
+func TestFormatRFC3164(t *testing.T) {
+	ts := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	b := formatRFC3164(syslog.LOG_LOCAL0, syslog.LOG_WARNING, ts, "host", "app", 42, "hello", zapsyslog.NonTransparentFraming)
+	assert.Equal(t, "<132>Jan  2 03:04:05 host app[42]: hello\n", string(b))
+
+	b = formatRFC3164(syslog.LOG_LOCAL0, syslog.LOG_WARNING, ts, "host", "app", 42, "hello", zapsyslog.OctetCountingFraming)
+	assert.Equal(t, "40 <132>Jan  2 03:04:05 host app[42]: hello", string(b))
+}
+
+func TestSeverityFlag(t *testing.T) {
+	for s, expected := range map[string]syslog.Priority{
+		"notice": syslog.LOG_NOTICE,
+		"ALERT":  syslog.LOG_ALERT,
+		"0":      syslog.LOG_EMERG,
+		"7":      syslog.LOG_DEBUG,
+	} {
+		var f severityFlag
+		require.NoError(t, f.Set(s), s)
+		assert.Equal(t, expected, f.severity, s)
+	}
+	for _, s := range []string{"loud", "8", "-1"} {
+		var f severityFlag
+		assert.Error(t, f.Set(s), s)
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	o := &options{hostname: "host", app: "app", level: zapcore.WarnLevel}
+	encode := func() string {
+		buf, err := newEncoder(o, zapsyslog.NonTransparentFraming, syslog.LOG_LOCAL0).EncodeEntry(
+			zapcore.Entry{Level: o.level, Message: "hi"}, nil)
+		require.NoError(t, err)
+		defer buf.Free()
+		return buf.String()
+	}
+
+	msg := encode()
+	assert.True(t, strings.HasPrefix(msg, "<132>1 "), "Unexpected output: %q", msg)
+	assert.Contains(t, msg, `"level":"warning"`)
+
+	require.NoError(t, o.severity.Set("notice"))
+	msg = encode()
+	assert.True(t, strings.HasPrefix(msg, "<133>1 "), "Unexpected output: %q", msg)
+	assert.Contains(t, msg, `"level":"notice"`, "The body level should agree with PRI.")
+	assert.NotContains(t, msg, `"warn"`)
+}
+
+func TestParseFraming(t *testing.T) {
+	f, err := parseFraming("octet")
+	require.NoError(t, err)
+	assert.Equal(t, zapsyslog.OctetCountingFraming, f)
+
+	_, err = parseFraming("crlf")
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	containerIDOnce sync.Once
+	containerIDVal  string
+
+	// Container cgroups of docker, containerd, cri-o and podman, with either
+	// the cgroupfs or the systemd driver
+	cgroupContainerIDPattern = regexp.MustCompile(`(?:/docker/|docker-|cri-containerd-|crio-|libpod-|/kubepods/.*/)([0-9a-f]{64})(?:\.scope)?$`)
+	// Root of the files docker bind mounts into its containers
+	mountContainerIDPattern = regexp.MustCompile(`/containers/([0-9a-f]{64})/`)
+)
+
+// getContainerID returns the ID of the container the process runs in, or an
+// empty string outside of containers. The CONTAINER_ID environment variable
+// takes precedence over /proc/self/cgroup and /proc/self/mountinfo.
+func getContainerID() string {
+	containerIDOnce.Do(func() {
+		if id := os.Getenv("CONTAINER_ID"); id != "" {
+			containerIDVal = id
+			return
+		}
+		if id := readContainerID("/proc/self/cgroup", parseCgroupContainerID); id != "" {
+			containerIDVal = id
+			return
+		}
+		containerIDVal = readContainerID("/proc/self/mountinfo", parseMountinfoContainerID)
+	})
+	return containerIDVal
+}
+
+func readContainerID(name string, parse func(io.Reader) string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+// parseCgroupContainerID finds the container ID in the cgroup paths of r,
+// as found in /proc/self/cgroup.
+func parseCgroupContainerID(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if m := cgroupContainerIDPattern.FindStringSubmatch(parts[2]); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// parseMountinfoContainerID finds the container ID in the mounts of the
+// files docker provides to its containers, as found in /proc/self/mountinfo
+// on cgroup v2 hosts. Mounts of other containers, seen from the host, don't
+// match.
+func parseMountinfoContainerID(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// mount-ID parent-ID major:minor root mount-point ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		switch fields[4] {
+		case "/etc/hostname", "/etc/hosts", "/etc/resolv.conf":
+		default:
+			continue
+		}
+		if m := mountContainerIDPattern.FindStringSubmatch(fields[3]); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
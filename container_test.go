@@ -0,0 +1,160 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testContainerID = "3f4b2d9d8c7e6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1b"
+
+func TestParseCgroupContainerID(t *testing.T) {
+	fixtures := []struct {
+		desc     string
+		content  string
+		expected string
+	}{
+		{
+			desc:     "docker",
+			content:  "12:memory:/docker/" + testContainerID + "\n11:cpu:/docker/" + testContainerID + "\n",
+			expected: testContainerID,
+		},
+		{
+			desc:     "docker systemd",
+			content:  "0::/system.slice/docker-" + testContainerID + ".scope\n",
+			expected: testContainerID,
+		},
+		{
+			desc:     "kubernetes systemd",
+			content:  "1:name=systemd:/kubepods.slice/kubepods-pod1.slice/cri-containerd-" + testContainerID + ".scope\n",
+			expected: testContainerID,
+		},
+		{
+			desc:     "kubernetes cgroupfs",
+			content:  "4:cpu:/kubepods/besteffort/pod1/" + testContainerID + "\n",
+			expected: testContainerID,
+		},
+		{
+			desc:     "host",
+			content:  "0::/user.slice/user-1000.slice/session-1.scope\n",
+			expected: "",
+		},
+		{
+			desc:     "unrelated hex",
+			content:  "0::/app/" + testContainerID + "/worker\n",
+			expected: "",
+		},
+	}
+
+	for _, f := range fixtures {
+		assert.Equal(t, f.expected, parseCgroupContainerID(strings.NewReader(f.content)), f.desc)
+	}
+}
+
+func TestParseMountinfoContainerID(t *testing.T) {
+	const other = "9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e4d3c2b1a0f9e8d"
+	fixtures := []struct {
+		desc     string
+		content  string
+		expected string
+	}{
+		{
+			desc: "container",
+			content: "1 0 0:1 / / rw - overlay overlay rw\n" +
+				"2 1 8:1 /var/lib/docker/containers/" + testContainerID + "/hostname /etc/hostname rw - ext4 /dev/sda1 rw\n",
+			expected: testContainerID,
+		},
+		{
+			desc: "docker host",
+			content: "1 0 8:1 / / rw - ext4 /dev/sda1 rw\n" +
+				"2 1 0:50 / /var/lib/docker/overlay2/" + other + "/merged rw - overlay overlay rw\n" +
+				"3 1 0:51 / /var/lib/docker/containers/" + other + "/mounts/shm rw - tmpfs shm rw\n",
+			expected: "",
+		},
+	}
+
+	for _, f := range fixtures {
+		assert.Equal(t, f.expected, parseMountinfoContainerID(strings.NewReader(f.content)), f.desc)
+	}
+}
+
+func TestSyslogEncoderContainerID(t *testing.T) {
+	os.Setenv("CONTAINER_ID", "abc123")
+	defer os.Unsetenv("CONTAINER_ID")
+	containerIDOnce = sync.Once{}
+	defer func() { containerIDOnce = sync.Once{} }()
+
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.ContainerIDKey = "container_id"
+	cfg.ContainerIDAsProcID = true
+	buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+	assert.NoError(t, err)
+	defer buf.Free()
+
+	assert.Contains(t, buf.String(), " localhost encoder_test abc123 - - ")
+	assert.Contains(t, buf.String(), `"container_id":"abc123"`)
+}
+
+func TestSyslogEncoderLongContainerID(t *testing.T) {
+	os.Setenv("CONTAINER_ID", strings.Repeat("a", 200))
+	defer os.Unsetenv("CONTAINER_ID")
+	containerIDOnce = sync.Once{}
+	defer func() { containerIDOnce = sync.Once{} }()
+
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.ContainerIDAsProcID = true
+	buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+	assert.NoError(t, err)
+	defer buf.Free()
+
+	assert.Contains(t, buf.String(), " localhost encoder_test "+strings.Repeat("a", maxProcIDLen)+" - - ")
+}
+
+func TestSyslogEncoderProcIDSources(t *testing.T) {
+	os.Setenv("ZAPSYSLOG_TEST_POD", "web 7")
+	defer os.Unsetenv("ZAPSYSLOG_TEST_POD")
+
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.ProcIDEnv = "ZAPSYSLOG_TEST_POD"
+	buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+	assert.NoError(t, err)
+	defer buf.Free()
+	assert.Contains(t, buf.String(), " localhost encoder_test web_7 - - ")
+
+	cfg.ProcIDFunc = func() string { return "worker-3" }
+	buf2, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+	assert.NoError(t, err)
+	defer buf2.Free()
+	assert.Contains(t, buf2.String(), " localhost encoder_test worker-3 - - ")
+
+	// Empty sources fall back to PID
+	cfg.ProcIDFunc = func() string { return "" }
+	cfg.ProcIDEnv = "ZAPSYSLOG_TEST_UNSET"
+	buf3, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+	assert.NoError(t, err)
+	defer buf3.Free()
+	assert.Contains(t, buf3.String(), " localhost encoder_test 9876 - - ")
+}
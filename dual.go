@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/zap/zapcore"
+)
+
+// DualConfig configures NewDualCore. App and Facility are used by both
+// destinations, replacing those of Journal and Encoder, so that they can't
+// disagree.
+type DualConfig struct {
+	// App sets SYSLOG_IDENTIFIER and APP-NAME, defaults to the executable
+	// name.
+	App      string          `json:"app" yaml:"app"`
+	Facility syslog.Priority `json:"facility" yaml:"facility"`
+
+	// Journal configures the local journald fields.
+	Journal JournalConfig `json:"journal" yaml:"journal"`
+
+	// Encoder configures the remote messages, e.g. NewRsyslogEncoderConfig().
+	Encoder SyslogEncoderConfig `json:"encoder" yaml:"encoder"`
+
+	// Network and Address locate the remote collector, Network defaults to
+	// tcp. It's reached over TLS with TLSConfig, by default verified against
+	// the system roots.
+	Network   string      `json:"network" yaml:"network"`
+	Address   string      `json:"address" yaml:"address"`
+	TLSConfig *tls.Config `json:"-" yaml:"-"`
+}
+
+// dualCore tees entries to journald and a remote collector.
+type dualCore struct {
+	zapcore.Core
+	journal io.Closer
+	remote  io.Closer
+}
+
+var _ io.Closer = &dualCore{}
+
+// NewDualCore returns a core sending each entry both to journald, with
+// native fields, and to a remote collector as RFC5424 over TLS. The syncer
+// options apply to the remote connection. The core is an io.Closer, closing
+// it closes both destinations.
+func NewDualCore(cfg DualConfig, enab zapcore.LevelEnabler, opts ...SyncerOption) (zapcore.Core, error) {
+	if cfg.App == "" {
+		cfg.App = filepath.Base(os.Args[0])
+	}
+	cfg.Journal.SyslogIdentifier = cfg.App
+	cfg.Journal.Facility = cfg.Facility
+	cfg.Encoder.App = cfg.App
+	cfg.Encoder.Facility = cfg.Facility
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
+	}
+	tlsConfig := cfg.TLSConfig
+	if tlsConfig == nil {
+		host, _, err := net.SplitHostPort(cfg.Address)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+
+	journal, err := NewJournalCore(cfg.Journal, enab)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := NewConnSyncer(cfg.Network, cfg.Address, append([]SyncerOption{WithTLSConfig(tlsConfig)}, opts...)...)
+	if err != nil {
+		journal.(io.Closer).Close()
+		return nil, err
+	}
+
+	return &dualCore{
+		Core:    zapcore.NewTee(journal, zapcore.NewCore(NewSyslogEncoder(cfg.Encoder), remote, enab)),
+		journal: journal.(io.Closer),
+		remote:  remote,
+	}, nil
+}
+
+func (c *dualCore) With(fields []zapcore.Field) zapcore.Core {
+	return &dualCore{Core: c.Core.With(fields), journal: c.journal, remote: c.remote}
+}
+
+// Close closes the journald socket and the remote connection.
+func (c *dualCore) Close() error {
+	err := c.journal.Close()
+	if rerr := c.remote.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
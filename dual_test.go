@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/tls"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestDualCore(t *testing.T) {
+	socket, l := startJournalServer(t)
+	defer os.Remove(socket)
+	defer l.Close()
+
+	cert, ca := generateTestCert()
+	done := make(chan string, 1)
+	addr, sock, srvWG := startTLSServer(&tls.Config{Certificates: []tls.Certificate{cert}}, done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	encCfg := NewRsyslogEncoderConfig()
+	encCfg.Hostname = "localhost"
+	encCfg.App = "ignored"
+	core, err := NewDualCore(DualConfig{
+		App:       "dual_test",
+		Facility:  syslog.LOG_LOCAL0,
+		Journal:   JournalConfig{Socket: socket, FieldMap: map[string]string{"user_id": "USER_ID"}},
+		Encoder:   encCfg,
+		Address:   addr,
+		TLSConfig: testClientTLSConfig(ca),
+	}, zapcore.InfoLevel)
+	require.NoError(t, err)
+	defer core.(io.Closer).Close()
+
+	logger := zap.New(core).With(zap.String("user_id", "42"))
+	logger.Debug("disabled")
+	logger.Warn("hello")
+
+	fields := readJournalFields(t, l)
+	assert.Equal(t, "dual_test", fields["SYSLOG_IDENTIFIER"])
+	assert.Equal(t, "16", fields["SYSLOG_FACILITY"])
+	assert.Equal(t, "42", fields["USER_ID"])
+	assert.Equal(t, "hello", fields["MESSAGE"])
+
+	msg := <-done
+	assert.True(t, strings.HasPrefix(msg, "<132>1 "), "Unexpected message: %q", msg)
+	assert.Contains(t, msg, " localhost dual_test ")
+	assert.Contains(t, msg, `"msg":"hello","user_id":"42"}`)
+}
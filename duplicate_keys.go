@@ -0,0 +1,176 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import "strconv"
+
+// DuplicateKeyPolicy controls what happens to JSON body keys written more
+// than once, e.g. by With() chains adding the same key twice.
+type DuplicateKeyPolicy int
+
+const (
+	// AllowDuplicateKeys writes every field as is.
+	AllowDuplicateKeys DuplicateKeyPolicy = iota
+	// KeepFirstKey drops the fields whose key was already written.
+	KeepFirstKey
+	// KeepLastKey drops the fields whose key is written again later.
+	KeepLastKey
+	// SuffixDuplicateKeys renames the second occurrence of a key to key_2,
+	// the third to key_3 and so on.
+	SuffixDuplicateKeys
+)
+
+// jsonMember is a top-level member of a JSON object, key includes the quotes.
+type jsonMember struct {
+	key   []byte
+	value []byte
+}
+
+// applyDuplicateKeyPolicy rewrites the top-level members of the JSON object
+// b, as encoded by zap, according to policy. Nested objects are left as is,
+// and so is b if it can't be parsed.
+func applyDuplicateKeyPolicy(b []byte, policy DuplicateKeyPolicy) []byte {
+	members, rest, ok := splitJSONObject(b)
+	if !ok {
+		return b
+	}
+
+	seen := make(map[string]int, len(members))
+	dup := false
+	for _, m := range members {
+		seen[string(m.key)]++
+		dup = dup || seen[string(m.key)] > 1
+	}
+	if !dup {
+		return b
+	}
+
+	out := make([]byte, 0, len(b)+8)
+	out = append(out, '{')
+	count := make(map[string]int, len(members))
+	for _, m := range members {
+		k := string(m.key)
+		count[k]++
+		key := m.key
+		switch policy {
+		case KeepFirstKey:
+			if count[k] > 1 {
+				continue
+			}
+		case KeepLastKey:
+			if count[k] < seen[k] {
+				continue
+			}
+		case SuffixDuplicateKeys:
+			if count[k] > 1 {
+				key = append(append(key[:len(key)-1:len(key)-1], '_'), strconv.Itoa(count[k])...)
+				key = append(key, '"')
+			}
+		}
+		if len(out) > 1 {
+			out = append(out, ',')
+		}
+		out = append(out, key...)
+		out = append(out, ':')
+		out = append(out, m.value...)
+	}
+	out = append(out, '}')
+	return append(out, rest...)
+}
+
+// splitJSONObject splits the JSON object b into its top-level members, rest
+// is what follows the object, e.g. the line ending.
+func splitJSONObject(b []byte) (members []jsonMember, rest []byte, ok bool) {
+	if len(b) == 0 || b[0] != '{' {
+		return nil, nil, false
+	}
+	i := 1
+	for i < len(b) && b[i] != '}' {
+		if b[i] == ',' && len(members) > 0 {
+			i++
+		}
+		keyEnd := skipJSONString(b, i)
+		if keyEnd < 0 || keyEnd >= len(b) || b[keyEnd] != ':' {
+			return nil, nil, false
+		}
+		valueEnd := skipJSONValue(b, keyEnd+1)
+		if valueEnd < 0 {
+			return nil, nil, false
+		}
+		members = append(members, jsonMember{key: b[i:keyEnd], value: b[keyEnd+1 : valueEnd]})
+		i = valueEnd
+	}
+	if i >= len(b) {
+		return nil, nil, false
+	}
+	return members, b[i+1:], true
+}
+
+// skipJSONString returns the index following the JSON string starting at i,
+// or -1.
+func skipJSONString(b []byte, i int) int {
+	if i >= len(b) || b[i] != '"' {
+		return -1
+	}
+	for i++; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// skipJSONValue returns the index following the JSON value starting at i, or
+// -1.
+func skipJSONValue(b []byte, i int) int {
+	depth := 0
+	for i < len(b) {
+		switch c := b[i]; c {
+		case '"':
+			if i = skipJSONString(b, i); i < 0 {
+				return -1
+			}
+			if depth == 0 {
+				return i
+			}
+			continue
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case ',':
+			if depth == 0 {
+				return i
+			}
+		}
+		i++
+	}
+	return -1
+}
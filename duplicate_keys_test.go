@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestApplyDuplicateKeyPolicy(t *testing.T) {
+	const body = `{"k":1,"o":{"k":"}],\"","k":2},"a":[1,{"k":3}],"k":"x,y"}` + "\n"
+	fixtures := []struct {
+		policy   DuplicateKeyPolicy
+		expected string
+	}{
+		{KeepFirstKey, `{"k":1,"o":{"k":"}],\"","k":2},"a":[1,{"k":3}]}` + "\n"},
+		{KeepLastKey, `{"o":{"k":"}],\"","k":2},"a":[1,{"k":3}],"k":"x,y"}` + "\n"},
+		{SuffixDuplicateKeys, `{"k":1,"o":{"k":"}],\"","k":2},"a":[1,{"k":3}],"k_2":"x,y"}` + "\n"},
+	}
+	for _, f := range fixtures {
+		assert.Equal(t, f.expected, string(applyDuplicateKeyPolicy([]byte(body), f.policy)), "policy %d", f.policy)
+	}
+
+	for _, b := range []string{`{}`, `{"k":1}`, `not json`, `{"k":1`} {
+		assert.Equal(t, b, string(applyDuplicateKeyPolicy([]byte(b), KeepFirstKey)))
+	}
+}
+
+func TestSyslogEncoderDuplicateKeys(t *testing.T) {
+	for _, framing := range []Framing{NonTransparentFraming, OctetCountingFraming} {
+		cfg := testEncoderConfig(framing)
+		cfg.DuplicateKeys = SuffixDuplicateKeys
+		enc := NewSyslogEncoder(cfg)
+		enc.AddString("k", "first")
+		enc = enc.Clone()
+		enc.AddString("k", "second")
+
+		buf, err := enc.EncodeEntry(testEntry, []zapcore.Field{zap.String("k", "third")})
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), `"k":"first","k_2":"second","k_3":"third"}`)
+		buf.Free()
+	}
+}
@@ -21,10 +21,15 @@
 package zapsyslog
 
 import (
+	"bytes"
 	"os"
-	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/imperfectgo/zap-syslog/internal"
 	"github.com/imperfectgo/zap-syslog/internal/bufferpool"
@@ -42,6 +47,10 @@ const (
 	timestampFormat = "2006-01-02T15:04:05.000000Z07:00" // RFC3339 with micro fraction seconds
 	maxHostnameLen  = 255
 	maxAppNameLen   = 48
+	maxProcIDLen    = 128
+	maxMsgLenDigits = 19 // MSG-LEN of octet counting, up to math.MaxInt64
+
+	encodingErrorKey = "encodingError"
 )
 
 var (
@@ -73,11 +82,184 @@ type SyslogEncoderConfig struct {
 	Hostname string          `json:"hostname" yaml:"hostname"`
 	PID      int             `json:"pid" yaml:"pid"`
 	App      string          `json:"app" yaml:"app"`
+
+	// AppNameTruncation controls how App is shortened to fit APP-NAME,
+	// keeping its first characters by default.
+	AppNameTruncation AppNameTruncation `json:"appNameTruncation" yaml:"appNameTruncation"`
+
+	// HostnameNormalization controls how Hostname is made a valid HOSTNAME,
+	// non-ASCII characters are replaced with '_' by default.
+	HostnameNormalization HostnameNormalization `json:"hostnameNormalization" yaml:"hostnameNormalization"`
+
+	// InvalidChars controls how the characters of Hostname and App outside
+	// of printable US-ASCII are written, replaced with InvalidCharRune by
+	// default. InvalidCharRune defaults to '_', as do runes that aren't
+	// printable US-ASCII themselves.
+	InvalidChars    InvalidCharReplacement `json:"invalidChars" yaml:"invalidChars"`
+	InvalidCharRune rune                   `json:"invalidCharRune" yaml:"invalidCharRune"`
+
+	// AtomicFacility, when set with NewAtomicFacility, overrides Facility
+	// with its current value for each entry.
+	AtomicFacility AtomicFacility `json:"-" yaml:"-"`
+
+	// AtomicFraming, when set with NewAtomicFraming, overrides Framing with
+	// its current value for each entry.
+	AtomicFraming AtomicFraming `json:"-" yaml:"-"`
+
+	// ErrorLogger, when set, receives the encoder's own problems, i.e. the
+	// entries failing to encode. It must not log through the encoder.
+	ErrorLogger *zap.Logger `json:"-" yaml:"-"`
+
+	// CallerSDID moves the entry caller out of the JSON body and into a
+	// STRUCTURED-DATA element with this SD-ID, e.g. "src@32473".
+	CallerSDID string `json:"callerSDID" yaml:"callerSDID"`
+
+	// OmitLevelKey drops EncoderConfig.LevelKey from the JSON body, the
+	// severity is already carried by PRI.
+	OmitLevelKey bool `json:"omitLevelKey" yaml:"omitLevelKey"`
+
+	// OmitTimeKey drops EncoderConfig.TimeKey from the JSON body, the
+	// timestamp is already carried by the header.
+	OmitTimeKey bool `json:"omitTimeKey" yaml:"omitTimeKey"`
+
+	// SeverityKey and FacilityKey, when set, add the numeric syslog severity
+	// and facility codes to the JSON body, for backends that strip the header.
+	SeverityKey string `json:"severityKey" yaml:"severityKey"`
+	FacilityKey string `json:"facilityKey" yaml:"facilityKey"`
+
+	// PriorityKeywords writes the severity and facility under SeverityKey
+	// and FacilityKey as syslog.conf keywords, e.g. "warning" and "local0",
+	// instead of codes. The unnamed facility 15 is written as "15".
+	PriorityKeywords bool `json:"priorityKeywords" yaml:"priorityKeywords"`
+
+	// HostMetadataKey and HostMetadataSDID opt in to host metadata (IP
+	// addresses, OS, kernel version and architecture) gathered once at
+	// startup, as a JSON object under this key and/or as a STRUCTURED-DATA
+	// element with this SD-ID.
+	HostMetadataKey  string `json:"hostMetadataKey" yaml:"hostMetadataKey"`
+	HostMetadataSDID string `json:"hostMetadataSDID" yaml:"hostMetadataSDID"`
+
+	// ContainerIDKey adds the detected container ID to the JSON body under
+	// this key, ContainerIDAsProcID uses it as PROCID instead of PID.
+	ContainerIDKey      string `json:"containerIDKey" yaml:"containerIDKey"`
+	ContainerIDAsProcID bool   `json:"containerIDAsProcID" yaml:"containerIDAsProcID"`
+
+	// ProcIDEnv uses the value of this environment variable as PROCID, e.g.
+	// a pod name set with the downward API, and ProcIDFunc the value it
+	// returns, which takes precedence. Both are called once, by
+	// NewSyslogEncoder, and fall back to the container ID or PID when empty.
+	ProcIDEnv  string        `json:"procIDEnv" yaml:"procIDEnv"`
+	ProcIDFunc func() string `json:"-" yaml:"-"`
+
+	// CEECookie prefixes the JSON body with the "@cee:" cookie, as expected by
+	// rsyslog's mmjsonparse, instead of the BOM which would hide the cookie.
+	CEECookie bool `json:"ceeCookie" yaml:"ceeCookie"`
+
+	// ASCIIOnly escapes non-ASCII characters of the JSON body as \uXXXX and
+	// omits the BOM, for receivers mangling multi-byte UTF-8.
+	ASCIIOnly bool `json:"asciiOnly" yaml:"asciiOnly"`
+
+	// HybridDelimiter, when set, makes MSG start with the plain message text,
+	// followed by this delimiter and the JSON body of the other fields, e.g.
+	// `hello | {"k":"v"}` for " | ". Line breaks in the text are escaped as
+	// \n and \r, CEECookie is ignored.
+	HybridDelimiter string `json:"hybridDelimiter" yaml:"hybridDelimiter"`
+
+	// DuplicateKeys controls the top-level JSON body keys written more than
+	// once, they're all kept by default.
+	DuplicateKeys DuplicateKeyPolicy `json:"duplicateKeys" yaml:"duplicateKeys"`
+
+	// PseudonymizedKeys are the JSON body keys, at any depth, whose values
+	// are replaced with the hex encoded HMAC-SHA256 of their JSON encoding,
+	// truncated to 16 bytes and keyed with PseudonymKey. The values stay
+	// correlatable across messages, as long as the key doesn't change,
+	// without being exposed. PseudonymKey can't be loaded from JSON or YAML
+	// configs: without it, the values are replaced with "redacted" instead.
+	// Bodies that can't be parsed are replaced with an empty object.
+	PseudonymizedKeys []string `json:"pseudonymizedKeys" yaml:"pseudonymizedKeys"`
+	PseudonymKey      []byte   `json:"-" yaml:"-"`
+
+	// MonotonicTimestamps makes the entry times strictly increasing, at the
+	// microsecond precision of the header, for collectors assuming ordering:
+	// a time not after the previous one, e.g. following a clock step back,
+	// is moved to the next microsecond. It's moved by MaxTimestampDrift at
+	// most, 1s by default, larger steps are kept as is.
+	MonotonicTimestamps bool          `json:"monotonicTimestamps" yaml:"monotonicTimestamps"`
+	MaxTimestampDrift   time.Duration `json:"maxTimestampDrift" yaml:"maxTimestampDrift"`
+
+	// MessageIDs sets the MSGID of each message to a new ULID, unique and
+	// sortable by time, e.g. 01ARZ3NDEKTSV4RRFFQ69G5FAV, so that collectors
+	// can deduplicate messages delivered more than once.
+	MessageIDs bool `json:"messageIDs" yaml:"messageIDs"`
+
+	// SequenceIDs adds the RFC5424 meta sequenceId parameter, numbering the
+	// messages of the encoder and its clones from 1.
+	SequenceIDs bool `json:"sequenceIDs" yaml:"sequenceIDs"`
+
+	// IntegrityKey, when set, adds a last SD-ELEMENT with IntegritySDID,
+	// hmac@32473 by default, e.g. [hmac@32473 sha256="..."], holding the hex
+	// encoded HMAC-SHA256 of the message with this element removed, without
+	// transport framing. Collectors can detect altered messages with it.
+	IntegrityKey  []byte `json:"-" yaml:"-"`
+	IntegritySDID string `json:"integritySDID" yaml:"integritySDID"`
+
+	// SortKeys writes the JSON body keys, those of nested objects included,
+	// and the parameters of StructuredData sorted, so that the output
+	// doesn't depend on the order fields are added in, e.g. for
+	// content-based deduplication. Duplicate keys keep their order.
+	SortKeys bool `json:"sortKeys" yaml:"sortKeys"`
+
+	// SanitizeKeys replaces the characters of the JSON body keys, those of
+	// nested objects included, that aren't ASCII letters, digits or
+	// underscores with underscores, e.g. "http.status code" is written as
+	// "http_status_code", for collectors that rewrite or split such keys.
+	// It's applied after PseudonymizedKeys and before DuplicateKeys.
+	SanitizeKeys bool `json:"sanitizeKeys" yaml:"sanitizeKeys"`
+
+	// HostnameKey, AppKey and PIDKey, when set, repeat the corresponding
+	// header values in the JSON body.
+	HostnameKey string `json:"hostnameKey" yaml:"hostnameKey"`
+	AppKey      string `json:"appKey" yaml:"appKey"`
+	PIDKey      string `json:"pidKey" yaml:"pidKey"`
+
+	// InitialFields are added to the JSON body of every entry, like
+	// zap.Config.InitialFields.
+	InitialFields map[string]interface{} `json:"initialFields" yaml:"initialFields"`
+
+	// StructuredData is added to the STRUCTURED-DATA of every message, e.g.
+	// the token element of a hosted provider, see NewTokenSDElement.
+	StructuredData []SDElement `json:"structuredData" yaml:"structuredData"`
+
+	// MaxSDParamValueLen, when set, caps the STRUCTURED-DATA parameter values
+	// to this many bytes, before escaping. Longer values are cut at a
+	// character boundary and end with "…", their element gets an
+	// sd_truncated="1" parameter.
+	MaxSDParamValueLen int `json:"maxSDParamValueLen" yaml:"maxSDParamValueLen"`
+
+	// BufferSizeHint is the typical size of encoded messages, when larger
+	// than the default pooled buffers are grown to it at once, instead of
+	// repeatedly as messages are appended.
+	BufferSizeHint int `json:"bufferSizeHint" yaml:"bufferSizeHint"`
 }
 
 type syslogEncoder struct {
 	*SyslogEncoderConfig
-	je jsonEncoder
+	je       jsonEncoder
+	fallback jsonEncoder // context free, for entries failing to encode
+	procID   string
+	staticSD string
+	pseudo   *pseudonymizer
+	sequence *sequence // shared by the clones
+	rawSD    string    // added with With, see RawSD
+	clock    *monotonicClock
+	msgIDs   *ulidGenerator
+
+	// severity replaces the one mapped from the entry level, see WithSeverity
+	severity    syslog.Priority
+	hasSeverity bool
+
+	// timestamps is shared by the clones, as they encode the same entries
+	timestamps *timestampCache
 }
 
 func rfc5424CompliantASCIIMapper(r rune) rune {
@@ -92,43 +274,133 @@ func toRFC5424CompliantASCIIString(s string) string {
 	return strings.Map(rfc5424CompliantASCIIMapper, s)
 }
 
+// charMapper returns the mapper of invalid HOSTNAME and APP-NAME characters.
+func (cfg *SyslogEncoderConfig) charMapper() charMapper {
+	return newCharMapper(cfg.InvalidChars, cfg.InvalidCharRune)
+}
+
+// procID returns PROCID, from the first source of ProcIDFunc, ProcIDEnv,
+// the container ID and PID giving a value.
+func (cfg *SyslogEncoderConfig) procID() string {
+	var id string
+	if cfg.ProcIDFunc != nil {
+		id = cfg.ProcIDFunc()
+	}
+	if id == "" && cfg.ProcIDEnv != "" {
+		id = os.Getenv(cfg.ProcIDEnv)
+	}
+	if id == "" && cfg.ContainerIDAsProcID {
+		id = getContainerID()
+	}
+	if id == "" {
+		return strconv.Itoa(cfg.PID)
+	}
+
+	id = toRFC5424CompliantASCIIString(id)
+	if len(id) > maxProcIDLen {
+		id = id[:maxProcIDLen]
+	}
+	return id
+}
+
 // NewSyslogEncoder creates a syslogEncoder.
 func NewSyslogEncoder(cfg SyslogEncoderConfig) zapcore.Encoder {
 	if cfg.Hostname == "" {
 		hostname, _ := os.Hostname()
 		cfg.Hostname = hostname
 	}
-	if cfg.Hostname == "" {
-		cfg.Hostname = nilValue
-	} else {
-		hostname := toRFC5424CompliantASCIIString(cfg.Hostname)
-		if len(hostname) > maxHostnameLen {
-			hostname = hostname[:maxHostnameLen]
-		}
-		cfg.Hostname = hostname
-	}
+	cfg.Hostname = normalizeHostname(cfg.Hostname, cfg.HostnameNormalization, cfg.charMapper())
 
 	if cfg.PID == 0 {
 		cfg.PID = os.Getpid()
 	}
-	if cfg.App == "" {
-		cfg.App = nilValue
-	} else {
-		app := cfg.App
-		if len(app) > maxAppNameLen {
-			app = path.Base(app)
+	procID := cfg.procID()
+	cfg.App = normalizeAppName(cfg.App, cfg.AppNameTruncation, cfg.charMapper())
+
+	if cfg.CallerSDID != "" {
+		cfg.CallerSDID = toSDID(cfg.CallerSDID)
+	}
+	if cfg.IntegritySDID == "" {
+		cfg.IntegritySDID = defaultIntegritySDID
+	}
+	cfg.IntegritySDID = toSDID(cfg.IntegritySDID)
+	var seq *sequence
+	if cfg.SequenceIDs {
+		seq = &sequence{}
+	}
+	var msgIDs *ulidGenerator
+	if cfg.MessageIDs {
+		msgIDs = newULIDGenerator()
+	}
+	var clock *monotonicClock
+	if cfg.MonotonicTimestamps {
+		if cfg.MaxTimestampDrift <= 0 {
+			cfg.MaxTimestampDrift = defaultMaxTimestampDrift
 		}
-		if len(app) > maxAppNameLen {
-			app = app[:maxAppNameLen]
+		clock = &monotonicClock{maxDrift: cfg.MaxTimestampDrift}
+	}
+
+	staticSD := bufferpool.Get()
+	defer staticSD.Free()
+	for _, e := range cfg.StructuredData {
+		if cfg.SortKeys {
+			e.Params = sortedSDParams(e.Params)
 		}
-		app = toRFC5424CompliantASCIIString(app)
+		e.appendTo(staticSD, cfg.MaxSDParamValueLen)
+	}
+	if cfg.HostMetadataSDID != "" {
+		cfg.HostMetadataSDID = toSDID(cfg.HostMetadataSDID)
+		getHostMetadata().appendSDElement(staticSD, cfg.HostMetadataSDID, cfg.MaxSDParamValueLen)
 	}
 
 	cfg.EncoderConfig.LineEnding = "\n"
-	je := zapcore.NewJSONEncoder(cfg.EncoderConfig).(jsonEncoder)
+	jeCfg := cfg.EncoderConfig
+	if cfg.CallerSDID != "" {
+		jeCfg.CallerKey = ""
+	}
+	if cfg.OmitLevelKey {
+		jeCfg.LevelKey = ""
+	}
+	if cfg.OmitTimeKey {
+		jeCfg.TimeKey = ""
+	}
+	if cfg.HybridDelimiter != "" {
+		jeCfg.MessageKey = ""
+	}
+	je := zapcore.NewJSONEncoder(jeCfg).(jsonEncoder)
+	fallback := je.Clone().(jsonEncoder)
+	if cfg.HostMetadataKey != "" {
+		je.AddObject(cfg.HostMetadataKey, getHostMetadata())
+	}
+	if cfg.ContainerIDKey != "" {
+		if id := getContainerID(); id != "" {
+			je.AddString(cfg.ContainerIDKey, id)
+		}
+	}
+	addInitialFields(je, cfg.InitialFields)
 	return &syslogEncoder{
 		SyslogEncoderConfig: &cfg,
 		je:                  je,
+		fallback:            fallback,
+		procID:              procID,
+		staticSD:            staticSD.String(),
+		pseudo:              newPseudonymizer(cfg.PseudonymKey, cfg.PseudonymizedKeys),
+		sequence:            seq,
+		msgIDs:              msgIDs,
+		clock:               clock,
+		timestamps:          &timestampCache{},
+	}
+}
+
+// addInitialFields adds fields to enc, sorted by key for a stable output.
+func addInitialFields(enc zapcore.ObjectEncoder, fields map[string]interface{}) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		zap.Any(k, fields[k]).AddTo(enc)
 	}
 }
 
@@ -137,6 +409,14 @@ func (enc *syslogEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error
 }
 
 func (enc *syslogEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	if sd, ok := obj.(rawSD); ok {
+		if !validRawSD(string(sd)) {
+			enc.je.AddString(key, string(sd))
+			return nil
+		}
+		enc.rawSD += string(sd)
+		return nil
+	}
 	return enc.je.AddObject(key, obj)
 }
 
@@ -207,18 +487,96 @@ func (enc *syslogEncoder) Clone() zapcore.Encoder {
 }
 
 func (enc *syslogEncoder) clone() *syslogEncoder {
+	// The config is never modified once built, derived encoders copy it
+	// before overriding header values, see deriveEncoder
 	clone := &syslogEncoder{
 		SyslogEncoderConfig: enc.SyslogEncoderConfig,
 		je:                  enc.je.Clone().(jsonEncoder),
+		fallback:            enc.fallback,
+		procID:              enc.procID,
+		staticSD:            enc.staticSD,
+		pseudo:              enc.pseudo,
+		sequence:            enc.sequence,
+		msgIDs:              enc.msgIDs,
+		rawSD:               enc.rawSD,
+		clock:               enc.clock,
+		timestamps:          enc.timestamps,
+		severity:            enc.severity,
+		hasSeverity:         enc.hasSeverity,
 	}
 	return clone
 }
 
-func (enc *syslogEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
-	msg := bufferpool.Get()
+// WithApp returns a copy of enc, which must have been created by
+// NewSyslogEncoder, using app as APP-NAME. Fields already added to enc are
+// kept, enc itself is left untouched.
+func WithApp(enc zapcore.Encoder, app string) zapcore.Encoder {
+	return deriveEncoder(enc, func(cfg *SyslogEncoderConfig) {
+		cfg.App = normalizeAppName(app, cfg.AppNameTruncation, cfg.charMapper())
+	})
+}
+
+// WithHostname returns a copy of enc, which must have been created by
+// NewSyslogEncoder, using hostname as HOSTNAME, the nil value if empty, e.g.
+// for messages relayed on behalf of another host. Fields already added to enc
+// are kept, enc itself is left untouched.
+func WithHostname(enc zapcore.Encoder, hostname string) zapcore.Encoder {
+	return deriveEncoder(enc, func(cfg *SyslogEncoderConfig) {
+		cfg.Hostname = normalizeHostname(hostname, cfg.HostnameNormalization, cfg.charMapper())
+	})
+}
+
+// WithFacility returns a copy of enc, which must have been created by
+// NewSyslogEncoder, logging to the given facility. Fields already added to
+// enc are kept, enc itself is left untouched. enc is returned as is if the
+// facility isn't valid, see syslog.Valid. The copy doesn't follow the
+// AtomicFacility of enc, if any.
+func WithFacility(enc zapcore.Encoder, facility syslog.Priority) zapcore.Encoder {
+	if syslog.Valid(facility) != nil {
+		return enc
+	}
+	return deriveEncoder(enc, func(cfg *SyslogEncoderConfig) {
+		cfg.Facility = facility
+		cfg.AtomicFacility = AtomicFacility{}
+	})
+}
+
+// WithSeverity returns a copy of enc, which must have been created by
+// NewSyslogEncoder, giving all entries the syslog severity instead of the one
+// mapped from their level, e.g. LOG_NOTICE or LOG_ALERT which no zap level
+// maps to. Fields already added to enc are kept, enc itself is left
+// untouched. enc is returned as is if severity isn't one of LOG_EMERG to
+// LOG_DEBUG.
+func WithSeverity(enc zapcore.Encoder, severity syslog.Priority) zapcore.Encoder {
+	se, ok := enc.(*syslogEncoder)
+	if !ok || severity < syslog.LOG_EMERG || severity > syslog.LOG_DEBUG {
+		return enc
+	}
+	clone := se.clone()
+	clone.severity, clone.hasSeverity = severity, true
+	return clone
+}
+
+// deriveEncoder clones enc and applies fn to a copy of its config, other
+// encoders are returned as is.
+func deriveEncoder(enc zapcore.Encoder, fn func(*SyslogEncoderConfig)) zapcore.Encoder {
+	se, ok := enc.(*syslogEncoder)
+	if !ok {
+		return enc
+	}
+	clone := se.clone()
+	cfg := *clone.SyslogEncoderConfig
+	fn(&cfg)
+	clone.SyslogEncoderConfig = &cfg
+	return clone
+}
 
+// PriorityFromLevel maps a zap level to the syslog severity the encoder
+// uses, e.g. LOG_WARNING for zapcore.WarnLevel and LOG_EMERG for
+// zapcore.FatalLevel. Unknown levels map to LOG_EMERG.
+func PriorityFromLevel(l zapcore.Level) syslog.Priority {
 	var p syslog.Priority
-	switch ent.Level {
+	switch l {
 	case zapcore.FatalLevel:
 		p = syslog.LOG_EMERG
 	case zapcore.PanicLevel:
@@ -234,7 +592,75 @@ func (enc *syslogEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field)
 	case zapcore.DebugLevel:
 		p = syslog.LOG_DEBUG
 	}
-	pr := int64((enc.Facility & facilityMask) | (p & severityMask))
+	return p
+}
+
+// headerFields returns the configured fields repeating header values. They are
+// added per entry so that they follow the overrides of derived encoders.
+func (enc *syslogEncoder) headerFields(severity syslog.Priority) []zapcore.Field {
+	var fields []zapcore.Field
+	if enc.HostnameKey != "" {
+		fields = append(fields, zap.String(enc.HostnameKey, enc.Hostname))
+	}
+	if enc.AppKey != "" {
+		fields = append(fields, zap.String(enc.AppKey, enc.App))
+	}
+	if enc.PIDKey != "" {
+		fields = append(fields, zap.Int(enc.PIDKey, enc.PID))
+	}
+	if enc.SeverityKey != "" {
+		if enc.PriorityKeywords {
+			fields = append(fields, zap.String(enc.SeverityKey, severity.Keyword()))
+		} else {
+			fields = append(fields, zap.Int(enc.SeverityKey, int(severity&severityMask)))
+		}
+	}
+	if enc.FacilityKey != "" {
+		facility := enc.facility() & facilityMask
+		if !enc.PriorityKeywords {
+			fields = append(fields, zap.Int(enc.FacilityKey, int(facility)>>3))
+		} else if keyword := facility.FacilityKeyword(); keyword != "" {
+			fields = append(fields, zap.String(enc.FacilityKey, keyword))
+		} else {
+			fields = append(fields, zap.String(enc.FacilityKey, strconv.Itoa(int(facility)>>3)))
+		}
+	}
+	return fields
+}
+
+// framing returns the framing of the next entry.
+func (enc *syslogEncoder) framing() Framing {
+	if enc.AtomicFraming.f != nil {
+		return enc.AtomicFraming.Framing()
+	}
+	return enc.Framing
+}
+
+// facility returns the facility of the next entry.
+func (enc *syslogEncoder) facility() syslog.Priority {
+	if enc.AtomicFacility.f != nil {
+		return enc.AtomicFacility.Facility()
+	}
+	return enc.Facility
+}
+
+func (enc *syslogEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	msg := bufferpool.Get()
+	growBuffer(msg, enc.BufferSizeHint)
+	framing := enc.framing()
+	if enc.clock != nil && !ent.Time.IsZero() {
+		ent.Time = enc.clock.next(ent.Time)
+	}
+
+	p := PriorityFromLevel(ent.Level)
+	if enc.hasSeverity {
+		p = enc.severity
+	}
+	pr := int64((enc.facility() & facilityMask) | (p & severityMask))
+
+	if hf := enc.headerFields(p); len(hf) > 0 {
+		fields = append(fields[:len(fields):len(fields)], hf...)
+	}
 
 	// <PRI>version
 	msg.AppendByte('<')
@@ -247,7 +673,7 @@ func (enc *syslogEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field)
 	if ent.Time.IsZero() {
 		msg.AppendString(nilValue)
 	} else {
-		msg.AppendString(ent.Time.Format(timestampFormat))
+		enc.timestamps.appendTimestamp(msg, ent.Time)
 	}
 
 	// SP HOSTNAME
@@ -260,32 +686,198 @@ func (enc *syslogEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field)
 
 	// SP PROCID
 	msg.AppendByte(' ')
-	msg.AppendInt(int64(enc.PID))
+	msg.AppendString(enc.procID)
+
+	// SP MSGID
+	msg.AppendByte(' ')
+	if enc.msgIDs != nil {
+		enc.msgIDs.appendMessageID(msg, ent.Time)
+	} else {
+		msg.AppendString(nilValue)
+	}
 
-	// SP MSGID SP STRUCTURED-DATA (just ignore)
-	msg.AppendString(" - -")
+	// SP STRUCTURED-DATA
+	msg.AppendByte(' ')
+	sdStart := msg.Len()
+	msg.AppendString(enc.staticSD)
+	if enc.CallerSDID != "" && ent.Caller.Defined {
+		appendCallerSDElement(msg, enc.CallerSDID, ent.Caller, enc.MaxSDParamValueLen)
+	}
+	msg.AppendString(enc.rawSD)
+	fields = extractRawSD(msg, fields)
+	if enc.sequence != nil {
+		appendSequenceSDElement(msg, enc.sequence.next())
+	}
+	signAt := msg.Len()
+	if msg.Len() == sdStart && enc.IntegrityKey == nil {
+		msg.AppendString(nilValue)
+	}
 
 	// SP UTF8 MSG
 	json, err := enc.je.EncodeEntry(ent, fields)
-	if json.Len() > 0 {
-		msg.AppendString(" \xef\xbb\xbf")
-		bs := json.Bytes()
-		if enc.Framing == OctetCountingFraming {
+	if err != nil {
+		// Emit a well-formed entry carrying the failure instead, zap's core
+		// would drop the whole entry if the error was returned
+		if json != nil {
+			json.Free()
+		}
+		if enc.ErrorLogger != nil {
+			enc.ErrorLogger.Warn("zapsyslog: entry encoding failed", zap.String("message", ent.Message), zap.Error(err))
+		}
+		json, err = enc.fallback.EncodeEntry(ent, []zapcore.Field{zap.String(encodingErrorKey, err.Error())})
+		if err != nil {
+			msg.Free()
+			return nil, err
+		}
+	}
+	body := json.Bytes()
+	if enc.pseudo != nil {
+		body = enc.pseudo.apply(body)
+	}
+	if enc.SanitizeKeys {
+		body = sanitizeJSONKeys(body)
+	}
+	if enc.DuplicateKeys != AllowDuplicateKeys {
+		body = applyDuplicateKeyPolicy(body, enc.DuplicateKeys)
+	}
+	if enc.SortKeys {
+		body = sortJSONKeys(body)
+	}
+	if enc.HybridDelimiter != "" {
+		enc.appendHybridMsg(msg, ent.Message, body, framing)
+	} else if json.Len() > 0 {
+		switch {
+		case enc.CEECookie:
+			msg.AppendString(" @cee:")
+		case enc.ASCIIOnly:
+			msg.AppendByte(' ')
+		default:
+			msg.AppendString(" \xef\xbb\xbf")
+		}
+		bs := body
+		if framing == OctetCountingFraming {
 			// Strip trailing line feed
 			bs = bs[:len(bs)-1]
 		}
-		msg.AppendString(internal.BytesToString(bs))
+		if enc.ASCIIOnly {
+			appendASCIIEscaped(msg, bs)
+		} else {
+			msg.AppendString(internal.BytesToString(bs))
+		}
 	}
+	json.Free()
 
-	if enc.Framing != OctetCountingFraming {
-		return msg, err
+	if enc.IntegrityKey != nil {
+		msg = signMessage(msg, signAt, enc.IntegritySDID, enc.IntegrityKey, framing)
+	}
+	if framing != OctetCountingFraming {
+		return msg, nil
 	}
 
 	// SYSLOG-FRAME = MSG-LEN SP SYSLOG-MSG
 	out := bufferpool.Get()
+	growBuffer(out, msg.Len()+maxMsgLenDigits+1)
 	out.AppendInt(int64(msg.Len()))
 	out.AppendByte(' ')
 	out.AppendString(internal.BytesToString(msg.Bytes()))
 	msg.Free()
-	return out, err
+	return out, nil
+}
+
+// extractRawSD appends the well-formed RawSD fields to buf and returns the
+// other fields, with the malformed RawSD fields as strings. fields is
+// returned as is if there's no RawSD field.
+func extractRawSD(buf *buffer.Buffer, fields []zapcore.Field) []zapcore.Field {
+	var rest []zapcore.Field
+	for i, f := range fields {
+		sd, ok := f.Interface.(rawSD)
+		if !ok || f.Type != zapcore.ObjectMarshalerType {
+			if rest != nil {
+				rest = append(rest, f)
+			}
+			continue
+		}
+		if rest == nil {
+			rest = append(make([]zapcore.Field, 0, len(fields)), fields[:i]...)
+		}
+		if validRawSD(string(sd)) {
+			buf.AppendString(string(sd))
+		} else {
+			rest = append(rest, zap.String(f.Key, string(sd)))
+		}
+	}
+	if rest == nil {
+		return fields
+	}
+	return rest
+}
+
+// growBuffer makes sure the empty buffer buf can hold n bytes. Pooled buffers
+// keep their capacity, so this only allocates once per buffer.
+func growBuffer(buf *buffer.Buffer, n int) {
+	if buf.Cap() >= n {
+		return
+	}
+	buf.Write(make([]byte, n))
+	buf.Reset()
+}
+
+// lineBreakEscaper keeps the text of hybrid messages on a single line.
+var lineBreakEscaper = strings.NewReplacer("\n", `\n`, "\r", `\r`)
+
+// appendHybridMsg appends MSG as the message text, followed by the delimiter
+// and the JSON body unless it's empty.
+func (enc *syslogEncoder) appendHybridMsg(msg *buffer.Buffer, text string, body []byte, framing Framing) {
+	if enc.ASCIIOnly {
+		msg.AppendByte(' ')
+	} else {
+		msg.AppendString(" \xef\xbb\xbf")
+	}
+
+	appendText := func(b []byte) {
+		if enc.ASCIIOnly {
+			appendASCIIEscaped(msg, b)
+		} else {
+			msg.Write(b)
+		}
+	}
+	appendText([]byte(lineBreakEscaper.Replace(text)))
+	body = bytes.TrimSuffix(body, []byte("\n"))
+	if string(body) != "{}" {
+		msg.AppendString(enc.HybridDelimiter)
+		appendText(body)
+	}
+	if framing != OctetCountingFraming {
+		msg.AppendByte('\n')
+	}
+}
+
+// appendASCIIEscaped appends the JSON b to buf, with non-ASCII characters
+// escaped as \uXXXX, using surrogate pairs outside the BMP. Such characters
+// only occur in JSON strings, where the escapes are equivalent.
+func appendASCIIEscaped(buf *buffer.Buffer, b []byte) {
+	const hex = "0123456789abcdef"
+	appendEscape := func(r rune) {
+		buf.AppendString(`\u`)
+		buf.AppendByte(hex[r>>12&0xf])
+		buf.AppendByte(hex[r>>8&0xf])
+		buf.AppendByte(hex[r>>4&0xf])
+		buf.AppendByte(hex[r&0xf])
+	}
+
+	for len(b) > 0 {
+		if b[0] < utf8.RuneSelf {
+			buf.AppendByte(b[0])
+			b = b[1:]
+			continue
+		}
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+			appendEscape(r1)
+			appendEscape(r2)
+			continue
+		}
+		appendEscape(r)
+	}
 }
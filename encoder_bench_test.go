@@ -21,9 +21,13 @@
 package zapsyslog
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -48,3 +52,54 @@ func BenchmarkSyslogEncoder(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkSyslogEncoderLargeEntry(b *testing.B) {
+	for _, hint := range []int{0, 16 << 10} {
+		cfg := testEncoderConfig(DefaultFraming)
+		cfg.BufferSizeHint = hint
+		enc := NewSyslogEncoder(cfg)
+		fields := []zapcore.Field{zap.String("payload", strings.Repeat("x", 12<<10))}
+		b.Run(fmt.Sprintf("hint=%d", hint), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf, _ := enc.EncodeEntry(zapcore.Entry{Message: "fake", Level: zap.DebugLevel}, fields)
+				buf.Free()
+			}
+		})
+	}
+}
+
+func BenchmarkHeaderTimestamp(b *testing.B) {
+	// One entry every 10µs, crossing second boundaries and switching zones
+	// every second
+	base := time.Date(2021, 3, 14, 6, 59, 58, 0, time.UTC)
+	zones := []*time.Location{time.UTC, time.FixedZone("", 2*3600)}
+	times := make([]time.Time, 300000)
+	for i := range times {
+		ts := base.Add(time.Duration(i) * 10 * time.Microsecond)
+		times[i] = ts.In(zones[ts.Unix()%2])
+	}
+
+	var c timestampCache
+	buf := &buffer.Buffer{}
+	for _, ts := range times {
+		buf.Reset()
+		c.appendTimestamp(buf, ts)
+		if buf.String() != ts.Format(timestampFormat) {
+			b.Fatalf("expected %s, got %s", ts.Format(timestampFormat), buf.String())
+		}
+	}
+
+	b.Run("Format", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			buf.AppendString(times[i%len(times)].Format(timestampFormat))
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			c.appendTimestamp(buf, times[i%len(times)])
+		}
+	})
+}
@@ -22,20 +22,26 @@
 package zapsyslog
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/imperfectgo/zap-syslog/syslog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
 	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 var (
@@ -438,3 +444,350 @@ func TestSyslogEncoder(t *testing.T) {
 		testSyslogEncoderFraming(t, framing)
 	}
 }
+
+func TestSyslogEncoderConformance(t *testing.T) {
+	cfg := testEncoderConfig(OctetCountingFraming)
+	cfg.CallerSDID = "src@32473"
+	cfg.StructuredData = []SDElement{{ID: "meta", Params: []SDParam{{Name: "k", Value: `a"b]c\\`}}}}
+	enc := NewSyslogEncoder(cfg)
+
+	ent := testEntry
+	ent.Caller = zapcore.NewEntryCaller(0, "bar/baz.go", 42, true)
+	buf, err := enc.EncodeEntry(ent, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+
+	s := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	s.Split(syslog.ScanFrames)
+	require.True(t, s.Scan())
+	m, err := syslog.ParseMessage(s.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, syslog.LOG_LOCAL0|syslog.LOG_DEBUG, m.Priority)
+	assert.Equal(t, "encoder_test", m.AppName)
+	assert.Equal(t, []syslog.SDElement{
+		{ID: "meta", Params: []syslog.SDParam{{Name: "k", Value: `a"b]c\\`}}},
+		{ID: "src@32473", Params: []syslog.SDParam{{Name: "file", Value: "bar/baz.go"}, {Name: "line", Value: "42"}}},
+	}, m.StructuredData)
+	assert.True(t, m.BOM)
+	assert.True(t, json.Valid(m.Msg))
+	assert.False(t, s.Scan())
+}
+
+func TestSyslogEncoderCallerSD(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.CallerSDID = "src@32473"
+	enc := NewSyslogEncoder(cfg)
+
+	ent := testEntry
+	ent.Caller = zapcore.NewEntryCaller(0, "/go/src/github.com/foo/bar/baz.go", 42, true)
+	buf, err := enc.EncodeEntry(ent, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+
+	msg := buf.String()
+	assert.Contains(t, msg, ` 9876 - [src@32473 file="bar/baz.go" line="42"] `+"\xef\xbb\xbf")
+	assert.NotContains(t, msg, `"caller":`)
+
+	ent.Caller = zapcore.EntryCaller{}
+	buf2, err := enc.EncodeEntry(ent, nil)
+	require.NoError(t, err)
+	defer buf2.Free()
+	assert.Contains(t, buf2.String(), " 9876 - - \xef\xbb\xbf")
+}
+
+func TestSyslogEncoderOmitLevelKey(t *testing.T) {
+	for _, omit := range []bool{false, true} {
+		cfg := testEncoderConfig(DefaultFraming)
+		cfg.LevelKey = "level"
+		cfg.OmitLevelKey = omit
+		buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+		require.NoError(t, err)
+
+		if omit {
+			assert.NotContains(t, buf.String(), `"level":`)
+		} else {
+			assert.Contains(t, buf.String(), `"level":"debug"`)
+		}
+		buf.Free()
+	}
+}
+
+func TestSyslogEncoderOmitTimeKey(t *testing.T) {
+	for _, omit := range []bool{false, true} {
+		cfg := testEncoderConfig(DefaultFraming)
+		cfg.TimeKey = "ts"
+		cfg.OmitTimeKey = omit
+		buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+		require.NoError(t, err)
+
+		assert.Contains(t, buf.String(), " 2017-01-02T03:04:05.123456Z ")
+		if omit {
+			assert.NotContains(t, buf.String(), `"ts":`)
+		} else {
+			assert.Contains(t, buf.String(), `"ts":`)
+		}
+		buf.Free()
+	}
+}
+
+func TestSyslogEncoderPriorityFields(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.SeverityKey = "syslog_severity"
+	cfg.FacilityKey = "syslog_facility"
+	enc := NewSyslogEncoder(cfg)
+
+	ent := testEntry
+	ent.Level = zap.WarnLevel
+	fields := []zapcore.Field{zap.String("k", "v")}
+	buf, err := enc.EncodeEntry(ent, fields)
+	require.NoError(t, err)
+	defer buf.Free()
+
+	assert.Len(t, fields, 1, "Caller's fields must not be modified.")
+	assert.Contains(t, buf.String(), `"k":"v","syslog_severity":4,"syslog_facility":16}`)
+}
+
+func TestSyslogEncoderPriorityKeywords(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.SeverityKey = "severity"
+	cfg.FacilityKey = "facility"
+	cfg.PriorityKeywords = true
+	enc := NewSyslogEncoder(cfg)
+
+	ent := testEntry
+	ent.Level = zap.WarnLevel
+	buf, err := enc.EncodeEntry(ent, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.Contains(t, buf.String(), `"severity":"warning","facility":"local0"}`)
+
+	buf2, err := WithFacility(enc, 15<<3).EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf2.Free()
+	assert.Contains(t, buf2.String(), `"severity":"debug","facility":"15"}`)
+}
+
+func TestSyslogEncoderHostMetadata(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.HostMetadataKey = "host"
+	cfg.HostMetadataSDID = "host@32473"
+	cfg.CallerSDID = "src@32473"
+	enc := NewSyslogEncoder(cfg)
+
+	ent := testEntry
+	ent.Caller = zapcore.NewEntryCaller(0, "bar/baz.go", 42, true)
+	buf, err := enc.Clone().EncodeEntry(ent, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+
+	msg := buf.String()
+	assert.Contains(t, msg, " 9876 - [host@32473 ")
+	assert.Contains(t, msg, fmt.Sprintf(`os="%s"`, runtime.GOOS))
+	assert.Contains(t, msg, fmt.Sprintf(`arch="%s"][src@32473 file="bar/baz.go" line="42"] `, runtime.GOARCH))
+	assert.Contains(t, msg, `"host":{`)
+	assert.Contains(t, msg, fmt.Sprintf(`"arch":"%s"}`, runtime.GOARCH))
+}
+
+func TestSyslogEncoderHeaderAndInitialFields(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.HostnameKey = "host"
+	cfg.AppKey = "app"
+	cfg.PIDKey = "pid"
+	cfg.InitialFields = map[string]interface{}{"b": 2, "a": "1"}
+	buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+
+	assert.Contains(t, buf.String(), `"a":"1","b":2,"host":"localhost","app":"encoder_test","pid":9876}`)
+}
+
+func TestSyslogEncoderWithAppAndFacility(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.AppKey = "app"
+	parent := NewSyslogEncoder(cfg)
+	parent.AddString("k", "v")
+
+	child := WithFacility(WithApp(parent, "plugin"), syslog.LOG_DAEMON)
+	child.AddString("child", "only")
+
+	buf, err := child.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.True(t, strings.HasPrefix(buf.String(), "<31>1 2017-01-02T03:04:05.123456Z localhost plugin 9876 - - "))
+	assert.Contains(t, buf.String(), `"k":"v","child":"only","app":"plugin"}`)
+
+	buf2, err := parent.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf2.Free()
+	assert.True(t, strings.HasPrefix(buf2.String(), "<135>1 2017-01-02T03:04:05.123456Z localhost encoder_test 9876 - - "))
+	assert.Contains(t, buf2.String(), `"k":"v","app":"encoder_test"}`)
+
+	buf3, err := WithApp(parent, "my sub system").EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf3.Free()
+	assert.Contains(t, buf3.String(), " localhost my_sub_system 9876 - - ")
+
+	assert.Equal(t, parent, WithFacility(parent, -8))
+}
+
+func TestSyslogEncoderWithSeverity(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.SeverityKey = "severity"
+	cfg.PriorityKeywords = true
+	parent := NewSyslogEncoder(cfg)
+	child := WithSeverity(parent, syslog.LOG_NOTICE).Clone()
+
+	buf, err := child.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.True(t, strings.HasPrefix(buf.String(), "<133>1 "), "Unexpected output: %q", buf.String())
+	assert.Contains(t, buf.String(), `"severity":"notice"`)
+
+	buf2, err := parent.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf2.Free()
+	assert.True(t, strings.HasPrefix(buf2.String(), "<135>1 "), "Unexpected output: %q", buf2.String())
+
+	assert.Equal(t, parent, WithSeverity(parent, 8))
+}
+
+func TestSyslogEncoderWithHostname(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.HostnameKey = "host"
+	parent := NewSyslogEncoder(cfg)
+
+	// Derived encoders share the core's syncer
+	var out bytes.Buffer
+	ws := zapcore.AddSync(&out)
+	logger := zap.New(zapcore.NewTee(
+		zapcore.NewCore(parent, ws, zapcore.DebugLevel),
+		zapcore.NewCore(WithHostname(WithApp(parent, "plugin"), "edge 1"), ws, zapcore.DebugLevel),
+	))
+	logger.Info("hi")
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], " localhost encoder_test 9876 - - ")
+	assert.Contains(t, lines[0], `"host":"localhost"}`)
+	assert.Contains(t, lines[1], " edge_1 plugin 9876 - - ")
+	assert.Contains(t, lines[1], `"host":"edge_1"}`)
+
+	buf, err := WithHostname(parent, "").EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.Contains(t, buf.String(), " - encoder_test 9876 - - ")
+}
+
+func TestSyslogEncoderBufferSizeHint(t *testing.T) {
+	large := strings.Repeat("x", 10000)
+	for _, framing := range []Framing{NonTransparentFraming, OctetCountingFraming} {
+		expected, err := NewSyslogEncoder(testEncoderConfig(framing)).EncodeEntry(testEntry, []zapcore.Field{zap.String("k", large)})
+		require.NoError(t, err)
+
+		cfg := testEncoderConfig(framing)
+		cfg.BufferSizeHint = 16 << 10
+		buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, []zapcore.Field{zap.String("k", large)})
+		require.NoError(t, err)
+		assert.Equal(t, expected.String(), buf.String())
+		assert.True(t, buf.Cap() >= buf.Len(), "framing %d", framing)
+		if framing == NonTransparentFraming {
+			assert.True(t, buf.Cap() >= cfg.BufferSizeHint, "buffer should be grown to the hint, cap: %d", buf.Cap())
+		}
+		expected.Free()
+		buf.Free()
+	}
+}
+
+// failingJSONEncoder fails to encode entries, like a broken inner encoder would.
+type failingJSONEncoder struct {
+	jsonEncoder
+}
+
+func (enc failingJSONEncoder) EncodeEntry(zapcore.Entry, []zapcore.Field) (*buffer.Buffer, error) {
+	return nil, errors.New("can't encode")
+}
+
+func TestSyslogEncoderEncodingErrorFallback(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	errCore, errLogs := observer.New(zapcore.DebugLevel)
+	cfg.ErrorLogger = zap.New(errCore)
+	enc := NewSyslogEncoder(cfg).(*syslogEncoder)
+	enc.AddString("context", "lost")
+	enc.je = failingJSONEncoder{enc.je}
+
+	var out bytes.Buffer
+	core := zapcore.NewCore(enc, zapcore.AddSync(&out), zapcore.DebugLevel)
+	require.NoError(t, core.Write(testEntry, []zapcore.Field{zap.String("k", "v")}))
+
+	assert.Equal(t, "<135>1 2017-01-02T03:04:05.123456Z localhost encoder_test 9876 - - \xef\xbb\xbf"+
+		`{"msg":"fake","encodingError":"can't encode"}`+"\n", out.String())
+	require.Equal(t, 1, errLogs.Len())
+	assert.Equal(t, "zapsyslog: entry encoding failed", errLogs.All()[0].Message)
+}
+
+func TestPriorityFromLevel(t *testing.T) {
+	for level, expected := range map[zapcore.Level]syslog.Priority{
+		zapcore.DebugLevel:  syslog.LOG_DEBUG,
+		zapcore.InfoLevel:   syslog.LOG_INFO,
+		zapcore.WarnLevel:   syslog.LOG_WARNING,
+		zapcore.ErrorLevel:  syslog.LOG_ERR,
+		zapcore.DPanicLevel: syslog.LOG_CRIT,
+		zapcore.PanicLevel:  syslog.LOG_CRIT,
+		zapcore.FatalLevel:  syslog.LOG_EMERG,
+	} {
+		assert.Equal(t, expected, PriorityFromLevel(level), "level %s", level)
+	}
+}
+
+func TestSyslogEncoderASCIIOnly(t *testing.T) {
+	for _, framing := range []Framing{NonTransparentFraming, OctetCountingFraming} {
+		cfg := testEncoderConfig(framing)
+		cfg.ASCIIOnly = true
+		enc := NewSyslogEncoder(cfg)
+
+		ent := testEntry
+		ent.Message = "héllo 日本 🎉"
+		buf, err := enc.EncodeEntry(ent, []zapcore.Field{zap.String("k", "ü")})
+		require.NoError(t, err)
+
+		msg := buf.String()
+		assert.NotContains(t, msg, "\xef\xbb\xbf")
+		for i := 0; i < len(msg); i++ {
+			require.True(t, msg[i] < utf8.RuneSelf, "Non-ASCII output: %q", msg)
+		}
+
+		i := strings.Index(msg, "{")
+		require.True(t, i > 0, "Unexpected output: %q", msg)
+		assert.Equal(t, " - - ", msg[i-5:i])
+		var m map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(msg[i:]), &m))
+		assert.Equal(t, "héllo 日本 🎉", m["msg"])
+		assert.Equal(t, "ü", m["k"])
+		buf.Free()
+	}
+}
+
+func TestSyslogEncoderHybrid(t *testing.T) {
+	cfg := testEncoderConfig(NonTransparentFraming)
+	cfg.HybridDelimiter = " | "
+	cfg.OmitTimeKey = true
+	cfg.OmitLevelKey = true
+	enc := NewSyslogEncoder(cfg)
+
+	ent := testEntry
+	ent.Message = "hello\nworld"
+	buf, err := enc.EncodeEntry(ent, []zapcore.Field{zap.String("k", "v")})
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.Equal(t, "<135>1 2017-01-02T03:04:05.123456Z localhost encoder_test 9876 - - \xef\xbb\xbfhello\\nworld | {\"k\":\"v\"}\n", buf.String())
+
+	cfg = testEncoderConfig(OctetCountingFraming)
+	cfg.HybridDelimiter = " | "
+	cfg.OmitTimeKey = true
+	cfg.OmitLevelKey = true
+	cfg.ASCIIOnly = true
+	buf2, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf2.Free()
+	assert.Equal(t, "71 <135>1 2017-01-02T03:04:05.123456Z localhost encoder_test 9876 - - fake", buf2.String())
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Environment variables read by NewFromEnv.
+const (
+	EnvAddress               = "SYSLOG_ADDRESS"
+	EnvProto                 = "SYSLOG_PROTO"
+	EnvFacility              = "SYSLOG_FACILITY"
+	EnvApp                   = "SYSLOG_APP"
+	EnvLevel                 = "SYSLOG_LEVEL"
+	EnvFraming               = "SYSLOG_FRAMING"
+	EnvTLS                   = "SYSLOG_TLS"
+	EnvTLSCA                 = "SYSLOG_TLS_CA"
+	EnvTLSCert               = "SYSLOG_TLS_CERT"
+	EnvTLSKey                = "SYSLOG_TLS_KEY"
+	EnvTLSServerName         = "SYSLOG_TLS_SERVER_NAME"
+	EnvTLSInsecureSkipVerify = "SYSLOG_TLS_INSECURE_SKIP_VERIFY"
+)
+
+// NewFromEnv returns a core configured by the environment only, for
+// containers without config files:
+//
+//	SYSLOG_ADDRESS   address of the syslog server, localhost:514 by default
+//	SYSLOG_PROTO     udp (default, tcp with TLS), tcp, unix or unixgram
+//	SYSLOG_FACILITY  facility name, user by default
+//	SYSLOG_APP       APP-NAME, the executable name by default
+//	SYSLOG_LEVEL     minimum level, info by default
+//	SYSLOG_FRAMING   lf (default) or octet
+//
+// TLS is enabled by SYSLOG_TLS=true, or by any of SYSLOG_TLS_CA (PEM file of
+// the CAs to verify the server with), SYSLOG_TLS_CERT and SYSLOG_TLS_KEY
+// (PEM files of the client certificate), SYSLOG_TLS_SERVER_NAME and
+// SYSLOG_TLS_INSECURE_SKIP_VERIFY, unless SYSLOG_TLS=false. TLS requires a
+// stream transport. opts are applied to the syncer.
+func NewFromEnv(opts ...SyncerOption) (zapcore.Core, error) {
+	return newFromEnv(os.Getenv, opts...)
+}
+
+func newFromEnv(getenv func(string) string, opts ...SyncerOption) (zapcore.Core, error) {
+	envOr := func(key, def string) string {
+		if v := getenv(key); v != "" {
+			return v
+		}
+		return def
+	}
+
+	facility, err := syslog.FacilityPriority(envOr(EnvFacility, "user"))
+	if err != nil {
+		return nil, err
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(envOr(EnvLevel, "info"))); err != nil {
+		return nil, fmt.Errorf("zapsyslog: invalid %s: %s", EnvLevel, err)
+	}
+	var framing Framing
+	switch f := envOr(EnvFraming, "lf"); f {
+	case "lf":
+		framing = NonTransparentFraming
+	case "octet":
+		framing = OctetCountingFraming
+	default:
+		return nil, fmt.Errorf("zapsyslog: invalid %s: %s", EnvFraming, f)
+	}
+
+	tlsConfig, err := tlsConfigFromEnv(getenv)
+	if err != nil {
+		return nil, err
+	}
+	network := envOr(EnvProto, "udp")
+	if tlsConfig != nil {
+		switch network = envOr(EnvProto, "tcp"); network {
+		case "udp", "udp4", "udp6", "unixgram":
+			return nil, fmt.Errorf("zapsyslog: invalid %s: %s can't be used with TLS", EnvProto, network)
+		}
+		opts = append([]SyncerOption{WithTLSConfig(tlsConfig)}, opts...)
+	}
+	sink, err := NewConnSyncer(network, envOr(EnvAddress, "localhost:514"), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := NewSyslogEncoder(SyslogEncoderConfig{
+		EncoderConfig: zap.NewProductionEncoderConfig(),
+		Framing:       framing,
+		Facility:      facility,
+		App:           envOr(EnvApp, filepath.Base(os.Args[0])),
+	})
+	return zapcore.NewCore(enc, sink, level), nil
+}
+
+// tlsConfigFromEnv returns nil if TLS isn't configured or is disabled.
+func tlsConfigFromEnv(getenv func(string) string) (*tls.Config, error) {
+	enabled := false
+	if v := getenv(EnvTLS); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("zapsyslog: invalid %s: %s", EnvTLS, v)
+		}
+		if !b {
+			return nil, nil
+		}
+		enabled = true
+	}
+	ca, cert, key := getenv(EnvTLSCA), getenv(EnvTLSCert), getenv(EnvTLSKey)
+	serverName, insecure := getenv(EnvTLSServerName), getenv(EnvTLSInsecureSkipVerify)
+	if !enabled && ca == "" && cert == "" && key == "" && serverName == "" && insecure == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{ServerName: serverName}
+	if insecure != "" {
+		b, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return nil, fmt.Errorf("zapsyslog: invalid %s: %s", EnvTLSInsecureSkipVerify, insecure)
+		}
+		cfg.InsecureSkipVerify = b
+	}
+	if ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("zapsyslog: invalid %s: no certificates found in %s", EnvTLSCA, ca)
+		}
+	}
+	if cert != "" || key != "" {
+		c, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{c}
+	}
+	return cfg, nil
+}
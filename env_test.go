@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func testEnv(env map[string]string) func(string) string {
+	return func(key string) string { return env[key] }
+}
+
+func TestNewFromEnv(t *testing.T) {
+	done := make(chan string)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	core, err := newFromEnv(testEnv(map[string]string{
+		EnvAddress:  addr,
+		EnvProto:    "tcp",
+		EnvFacility: "local1",
+		EnvApp:      "envtest",
+		EnvLevel:    "warn",
+	}))
+	require.NoError(t, err)
+
+	logger := zap.New(core)
+	logger.Info("dropped")
+	logger.Warn("hello")
+	require.NoError(t, logger.Sync())
+
+	rcvd := <-done
+	assert.True(t, strings.HasPrefix(rcvd, "<140>1 "), rcvd)
+	assert.Contains(t, rcvd, " envtest ")
+	assert.Contains(t, rcvd, `"msg":"hello"`)
+}
+
+func TestNewFromEnvTLS(t *testing.T) {
+	cert, ca := generateTestCert()
+	f, err := ioutil.TempFile("", "zapsyslog-ca")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	require.NoError(t, pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}))
+	f.Close()
+
+	done := make(chan string)
+	addr, sock, srvWG := startTLSServer(&tls.Config{Certificates: []tls.Certificate{cert}}, done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	// tcp by default with TLS
+	core, err := newFromEnv(testEnv(map[string]string{
+		EnvAddress: addr,
+		EnvTLSCA:   f.Name(),
+	}))
+	require.NoError(t, err)
+
+	logger := zap.New(core)
+	logger.Info("over tls")
+	require.NoError(t, logger.Sync())
+	assert.Contains(t, <-done, `"msg":"over tls"`)
+}
+
+func TestNewFromEnvErrors(t *testing.T) {
+	for _, env := range []map[string]string{
+		{EnvFacility: "nope"},
+		{EnvLevel: "loud"},
+		{EnvFraming: "crlf"},
+		{EnvTLS: "maybe"},
+		{EnvTLSInsecureSkipVerify: "maybe"},
+		{EnvTLSCA: "/nonexistent/ca.pem"},
+		{EnvTLSCert: "/nonexistent/cert.pem"},
+		{EnvTLS: "true", EnvProto: "udp"},
+		{EnvTLS: "true", EnvProto: "unixgram"},
+	} {
+		_, err := newFromEnv(testEnv(env))
+		assert.Error(t, err, "env: %v", env)
+	}
+}
+
+func TestTLSConfigFromEnvDisabled(t *testing.T) {
+	cfg, err := tlsConfigFromEnv(testEnv(map[string]string{
+		EnvTLS:           "false",
+		EnvTLSServerName: "syslog.example.com",
+		EnvTLSCA:         "/nonexistent/ca.pem",
+	}))
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	cfg, err = tlsConfigFromEnv(testEnv(map[string]string{EnvTLSServerName: "syslog.example.com"}))
+	require.NoError(t, err)
+	assert.Equal(t, "syslog.example.com", cfg.ServerName)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// Errors returned by syncer writes, test for them with errors.Is.
+var (
+	// ErrNotConnected is returned when the syslog server can't be (re)connected.
+	ErrNotConnected = errors.New("zapsyslog: not connected")
+	// ErrDropped is returned when a message is discarded after all write attempts failed.
+	ErrDropped = errors.New("zapsyslog: message dropped")
+	// ErrMessageTooLarge is returned when a message exceeds the maximum message size.
+	ErrMessageTooLarge = errors.New("zapsyslog: message too large")
+	// ErrCircuitOpen is returned when reconnecting is suspended, e.g. because
+	// the retry budget is exhausted.
+	ErrCircuitOpen = errors.New("zapsyslog: circuit open")
+)
+
+// syncerError annotates the underlying error with one of the sentinel errors above.
+type syncerError struct {
+	kind error
+	err  error
+}
+
+func newSyncerError(kind, err error) error {
+	return &syncerError{kind: kind, err: err}
+}
+
+func (e *syncerError) Error() string {
+	if e.err == nil {
+		return e.kind.Error()
+	}
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *syncerError) Unwrap() error {
+	return e.err
+}
+
+func (e *syncerError) Is(target error) bool {
+	return target == e.kind
+}
+
+// errSyncerClosed is the underlying error of writes after Close.
+var errSyncerClosed = errors.New("syncer closed")
+
+// IsPermanent reports whether err, as returned by a syncer or its
+// constructor, is due to a problem that retrying won't fix: an unknown host,
+// an invalid address, a rejected certificate or a denied permission.
+// Others, e.g. refused or reset connections, are taken as transient.
+//
+// ConnSyncer doesn't retry writes in-line after permanent reconnection
+// errors, so that they reach the caller, e.g. a FallbackSyncer, at once.
+func IsPermanent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsNotFound
+	}
+	var (
+		addrErr      *net.AddrError
+		netErr       net.UnknownNetworkError
+		authorityErr x509.UnknownAuthorityError
+		invalidErr   x509.CertificateInvalidError
+		hostnameErr  x509.HostnameError
+	)
+	switch {
+	case errors.As(err, &addrErr), errors.As(err, &netErr),
+		errors.As(err, &authorityErr), errors.As(err, &invalidErr), errors.As(err, &hostnameErr):
+		return true
+	}
+	return errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM)
+}
+
+// ErrorClass groups the errors of write attempts, see WithClassRetries.
+type ErrorClass int
+
+const (
+	// ResetErrors are broken connections, e.g. EPIPE or ECONNRESET after the
+	// server restarted, which a new connection likely fixes.
+	ResetErrors ErrorClass = iota
+	// TimeoutErrors are timed out dials and writes, an unresponsive server
+	// is unlikely to answer an immediate retry.
+	TimeoutErrors
+	// OtherErrors are the errors of neither class.
+	OtherErrors
+
+	numErrorClasses = iota
+)
+
+// ClassifyError returns the class of err, as returned by a write attempt.
+func ClassifyError(err error) ErrorClass {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return TimeoutErrors
+	}
+	for _, reset := range []error{syscall.EPIPE, syscall.ECONNRESET, syscall.ECONNABORTED, io.EOF, io.ErrShortWrite} {
+		if errors.Is(err, reset) {
+			return ResetErrors
+		}
+	}
+	return OtherErrors
+}
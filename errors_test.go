@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPermanent(t *testing.T) {
+	opErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: err}
+	}
+	tests := []struct {
+		err       error
+		permanent bool
+	}{
+		{&net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}, true},
+		{&net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, false},
+		{&net.AddrError{Err: "missing port in address", Addr: "localhost"}, true},
+		{net.UnknownNetworkError("sctp"), true},
+		{fmt.Errorf("tls: %w", x509.UnknownAuthorityError{}), true},
+		{x509.HostnameError{Host: "example.com"}, true},
+		{opErr(os.NewSyscallError("connect", syscall.EACCES)), true},
+		{opErr(os.NewSyscallError("connect", syscall.ECONNREFUSED)), false},
+		{opErr(os.NewSyscallError("write", syscall.EPIPE)), false},
+		{newSyncerError(ErrNotConnected, &net.DNSError{IsNotFound: true}), true},
+		{newSyncerError(ErrDropped, errors.New("boom")), false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.permanent, IsPermanent(tt.err), "%v", tt.err)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	opErr := func(err error) error {
+		return &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", err)}
+	}
+	tests := []struct {
+		err   error
+		class ErrorClass
+	}{
+		{opErr(syscall.EPIPE), ResetErrors},
+		{opErr(syscall.ECONNRESET), ResetErrors},
+		{newSyncerError(ErrDropped, io.ErrShortWrite), ResetErrors},
+		{newSyncerError(ErrDropped, io.EOF), ResetErrors},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, TimeoutErrors},
+		{&net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, TimeoutErrors},
+		{opErr(syscall.ECONNREFUSED), OtherErrors},
+		{errors.New("boom"), OtherErrors},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.class, ClassifyError(tt.err), "%v", tt.err)
+	}
+}
@@ -36,9 +36,10 @@ func main() {
 	}
 
 	atom := zap.NewAtomicLevel()
+	// The syncer serializes writes itself, no need for zapcore.Lock
 	logger := zap.New(zapcore.NewCore(
 		enc,
-		zapcore.Lock(sink),
+		sink,
 		atom,
 	))
 
@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"expvar"
+	"time"
+)
+
+var _ LatencyStats = &ExpvarStats{}
+
+// ExpvarStats publishes syncer counters as expvar variables, for services
+// already exposing /debug/vars. Use it with WithStats, and with
+// WithQueueStats to count the messages dropped by asynchronous syncers as
+// well:
+//
+//	st := zapsyslog.NewExpvarStats("syslog")
+//	sink, err := zapsyslog.NewConnSyncer("tcp", addr, zapsyslog.WithStats(st))
+//	...
+//	async := zapsyslog.NewAsyncSyncer(sink, zapsyslog.WithQueueStats(st))
+//	st.PublishQueueDepth(async)
+type ExpvarStats struct {
+	prefix     string
+	sent       *expvar.Int
+	sentBytes  *expvar.Int
+	dropped    *expvar.Int
+	reconnects *expvar.Int
+}
+
+// NewExpvarStats publishes the counters prefix.sent, prefix.sent_bytes,
+// prefix.dropped and prefix.reconnects. Like expvar.Publish, it panics if
+// any of them is already published.
+func NewExpvarStats(prefix string) *ExpvarStats {
+	return &ExpvarStats{
+		prefix:     prefix,
+		sent:       expvar.NewInt(prefix + ".sent"),
+		sentBytes:  expvar.NewInt(prefix + ".sent_bytes"),
+		dropped:    expvar.NewInt(prefix + ".dropped"),
+		reconnects: expvar.NewInt(prefix + ".reconnects"),
+	}
+}
+
+// PublishQueueDepth publishes prefix.queue_depth, the number of messages
+// queued by s. It panics if the variable is already published.
+func (st *ExpvarStats) PublishQueueDepth(s *AsyncSyncer) {
+	expvar.Publish(st.prefix+".queue_depth", expvar.Func(func() interface{} {
+		return s.QueueDepth()
+	}))
+}
+
+// Written implements Stats.
+func (st *ExpvarStats) Written(n int) {
+	st.sent.Add(1)
+	st.sentBytes.Add(int64(n))
+}
+
+// Dropped implements Stats.
+func (st *ExpvarStats) Dropped(err error) {
+	st.dropped.Add(1)
+}
+
+// Reconnected implements Stats.
+func (st *ExpvarStats) Reconnected() {
+	st.reconnects.Add(1)
+}
+
+// ObserveEncode implements LatencyStats, latencies aren't published.
+func (st *ExpvarStats) ObserveEncode(d time.Duration) {}
+
+// ObserveWrite implements LatencyStats, latencies aren't published.
+func (st *ExpvarStats) ObserveWrite(d time.Duration) {}
+
+// ObserveQueue implements LatencyStats, latencies aren't published.
+func (st *ExpvarStats) ObserveQueue(d time.Duration) {}
@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpvarStats(t *testing.T) {
+	done := make(chan string)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	st := NewExpvarStats("zapsyslog_test")
+	s, err := NewConnSyncer("tcp", addr, WithStats(st), WithMaxMessageSize(10))
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	<-done
+	_, err = s.Write([]byte("too large message\n"))
+	require.Error(t, err)
+	s.mu.Lock()
+	s.closeConn()
+	s.mu.Unlock()
+	_, err = s.Write([]byte("again\n"))
+	require.NoError(t, err)
+	<-done
+
+	ws := newGatedSyncer()
+	async := NewAsyncSyncer(ws, WithQueueSize(1), WithQueueStats(st))
+	st.PublishQueueDepth(async)
+	_, err = async.Write([]byte("held"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return async.QueueDepth() == 0
+	}, time.Second, time.Millisecond)
+	_, err = async.Write([]byte("queued"))
+	require.NoError(t, err)
+	_, err = async.Write([]byte("dropped"))
+	require.Error(t, err)
+
+	for name, expected := range map[string]string{
+		"zapsyslog_test.sent":        "2",
+		"zapsyslog_test.sent_bytes":  "12",
+		"zapsyslog_test.dropped":     "2",
+		"zapsyslog_test.reconnects":  "1",
+		"zapsyslog_test.queue_depth": "1",
+	} {
+		v := expvar.Get(name)
+		if assert.NotNil(t, v, name) {
+			assert.Equal(t, expected, v.String(), name)
+		}
+	}
+
+	ws.open()
+	require.NoError(t, async.Close())
+}
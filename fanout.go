@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"go.uber.org/zap/zapcore"
+)
+
+// Destination is a syncer of a fan-out core, with the levels it receives.
+type Destination struct {
+	WriteSyncer zapcore.WriteSyncer
+	Level       zapcore.LevelEnabler
+}
+
+// fanOutCore encodes each entry once and writes it to the destinations
+// enabled for its level.
+type fanOutCore struct {
+	enc   zapcore.Encoder
+	dests []Destination
+}
+
+// NewFanOutCore returns a core writing entries encoded with enc to several
+// destinations, each enabled for its own levels, e.g. warnings and above to
+// a SIEM and everything to a local relay. Entries are encoded once, however
+// many destinations they go to. Destinations may be FallbackSyncers for
+// failover. Writes go on to the other destinations when one fails, the
+// first error is returned.
+func NewFanOutCore(enc zapcore.Encoder, dests ...Destination) zapcore.Core {
+	return &fanOutCore{enc: enc, dests: dests}
+}
+
+func (c *fanOutCore) Enabled(l zapcore.Level) bool {
+	for _, d := range c.dests {
+		if d.Level.Enabled(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *fanOutCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &fanOutCore{enc: enc, dests: c.dests}
+}
+
+func (c *fanOutCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *fanOutCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	for _, d := range c.dests {
+		if !d.Level.Enabled(ent.Level) {
+			continue
+		}
+		if _, werr := d.WriteSyncer.Write(buf.Bytes()); werr != nil && err == nil {
+			err = werr
+		}
+		if ent.Level > zapcore.ErrorLevel {
+			// Like zap's own cores, sync as the process is likely to exit
+			d.WriteSyncer.Sync()
+		}
+	}
+	return err
+}
+
+func (c *fanOutCore) Sync() error {
+	var err error
+	for _, d := range c.dests {
+		if serr := d.WriteSyncer.Sync(); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// failingSyncer fails every write.
+type failingSyncer struct{}
+
+func (failingSyncer) Write(p []byte) (int, error) { return 0, errors.New("boom") }
+func (failingSyncer) Sync() error                 { return nil }
+
+func TestFanOutCore(t *testing.T) {
+	var siem, local bytes.Buffer
+	core := NewFanOutCore(NewSyslogEncoder(testEncoderConfig(NonTransparentFraming)),
+		Destination{WriteSyncer: zapcore.AddSync(&siem), Level: zapcore.WarnLevel},
+		Destination{WriteSyncer: zapcore.AddSync(&local), Level: zapcore.DebugLevel},
+	)
+	assert.True(t, core.Enabled(zapcore.DebugLevel))
+
+	logger := zap.New(core).With(zap.String("k", "v"))
+	logger.Debug("debug")
+	logger.Warn("warn")
+
+	assert.Equal(t, 1, strings.Count(siem.String(), "\n"))
+	assert.Contains(t, siem.String(), `"msg":"warn","k":"v"}`)
+	assert.Equal(t, 2, strings.Count(local.String(), "\n"))
+	assert.Contains(t, local.String(), `"msg":"debug","k":"v"}`)
+
+	core = NewFanOutCore(NewSyslogEncoder(testEncoderConfig(NonTransparentFraming)),
+		Destination{WriteSyncer: failingSyncer{}, Level: zapcore.InfoLevel},
+		Destination{WriteSyncer: zapcore.AddSync(&local), Level: zapcore.InfoLevel},
+	)
+	local.Reset()
+	assert.False(t, core.Enabled(zapcore.DebugLevel))
+	assert.Error(t, core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "info"}, nil))
+	assert.Contains(t, local.String(), `"msg":"info"}`, "A failed destination shouldn't stop the others.")
+}
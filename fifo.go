@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build !windows
+// +build !windows
+
+package zapsyslog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	_ zapcore.WriteSyncer = &FIFOSyncer{}
+)
+
+// FIFOSyncer writes to a named pipe consumed by a log shipper. The pipe is
+// opened without blocking and reopened when the reader goes away.
+type FIFOSyncer struct {
+	mu           sync.Mutex
+	path         string
+	dropNoReader bool
+	f            *os.File
+}
+
+// NewFIFOSyncer returns a syncer writing to the named pipe at path. When
+// dropNoReader is set, messages written while no process reads the pipe are
+// silently dropped, otherwise writes fail with ErrNotConnected.
+func NewFIFOSyncer(path string, dropNoReader bool) (*FIFOSyncer, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		return nil, fmt.Errorf("zapsyslog: %s is not a named pipe", path)
+	}
+
+	s := &FIFOSyncer{
+		path:         path,
+		dropNoReader: dropNoReader,
+	}
+	if err := s.open(); err != nil && !isNoReader(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the pipe for writing, it fails with ENXIO when there is no reader.
+func (s *FIFOSyncer) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	s.f = f
+	return nil
+}
+
+func (s *FIFOSyncer) close() {
+	if s.f != nil {
+		s.f.Close()
+		s.f = nil
+	}
+}
+
+func isNoReader(err error) bool {
+	return errors.Is(err, syscall.ENXIO)
+}
+
+// Write writes p to the pipe, reopening it once if the reader went away.
+func (s *FIFOSyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < 2; i++ {
+		if s.f == nil {
+			if err := s.open(); err != nil {
+				if isNoReader(err) && s.dropNoReader {
+					return len(p), nil
+				}
+				return 0, newSyncerError(ErrNotConnected, err)
+			}
+		}
+
+		n, err := s.f.Write(p)
+		if err == nil || !errors.Is(err, syscall.EPIPE) {
+			return n, err
+		}
+		// The reader went away, reopen for the next one
+		s.close()
+	}
+	return 0, newSyncerError(ErrNotConnected, syscall.EPIPE)
+}
+
+// Sync implements zapcore.WriteSyncer interface, pipes have nothing to flush.
+func (s *FIFOSyncer) Sync() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build !windows
+// +build !windows
+
+package zapsyslog
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFIFOSyncer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fifotest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.fifo")
+	require.NoError(t, syscall.Mkfifo(path, 0600))
+
+	dropping, err := NewFIFOSyncer(path, true)
+	require.NoError(t, err)
+	failing, err := NewFIFOSyncer(path, false)
+	require.NoError(t, err)
+
+	// No reader yet
+	n, err := io.WriteString(dropping, testMessage)
+	assert.NoError(t, err)
+	assert.Equal(t, len(testMessage), n)
+	_, err = io.WriteString(failing, testMessage)
+	assert.True(t, errors.Is(err, ErrNotConnected), "Unexpected error: %v", err)
+
+	for i := 0; i < 2; i++ {
+		r, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+		require.NoError(t, err)
+
+		_, err = io.WriteString(failing, testMessage)
+		require.NoError(t, err)
+		buf := make([]byte, len(testMessage))
+		_, err = io.ReadFull(r, buf)
+		require.NoError(t, err)
+		assert.Equal(t, testMessage, string(buf))
+
+		// The reader goes away, the next one gets a reopened pipe
+		r.Close()
+	}
+
+	_, err = io.WriteString(failing, testMessage)
+	assert.True(t, errors.Is(err, ErrNotConnected), "Unexpected error: %v", err)
+
+	_, err = NewFIFOSyncer(dir, true)
+	assert.Error(t, err, "Directories should be rejected.")
+}
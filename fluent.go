@@ -0,0 +1,253 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultFluentAddress    = "127.0.0.1:24224"
+	defaultFluentAckTimeout = 5 * time.Second
+)
+
+// FluentConfig configures the Fluentd forward protocol core.
+type FluentConfig struct {
+	// Network and Address of the Fluentd or Fluent Bit forward input,
+	// default to "tcp" and "127.0.0.1:24224".
+	Network string `json:"network" yaml:"network"`
+	Address string `json:"address" yaml:"address"`
+	// Tag of the entries, defaults to the executable name. Entries of named
+	// loggers are tagged Tag.LoggerName.
+	Tag string `json:"tag" yaml:"tag"`
+	// RequireAck waits for the server to acknowledge each entry, and sends
+	// it again once after reconnecting if it doesn't.
+	RequireAck bool `json:"requireAck" yaml:"requireAck"`
+	// AckTimeout bounds the wait for acks, defaults to 5s.
+	AckTimeout time.Duration `json:"ackTimeout" yaml:"ackTimeout"`
+}
+
+// fluentConn is the connection shared by a core and its clones.
+type fluentConn struct {
+	mu     sync.Mutex
+	cfg    *FluentConfig
+	conn   net.Conn
+	br     *bufio.Reader
+	buf    []byte
+	closed bool
+}
+
+type fluentCore struct {
+	zapcore.LevelEnabler
+	conn   *fluentConn
+	fields []zapcore.Field
+}
+
+var _ io.Closer = &fluentCore{}
+
+// NewFluentCore creates a core writing entries to Fluentd with its forward
+// protocol, in message mode. Each entry is a record holding the entry's
+// level, msg, logger, caller and stacktrace alongside its fields, under the
+// same keys as zap's production config. The core is an io.Closer, closing
+// it closes the connection shared with the cores derived from it.
+//
+// Write errors match ErrNotConnected or ErrDropped with errors.Is.
+func NewFluentCore(cfg FluentConfig, enab zapcore.LevelEnabler) (zapcore.Core, error) {
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
+	}
+	if cfg.Address == "" {
+		cfg.Address = defaultFluentAddress
+	}
+	if cfg.Tag == "" {
+		cfg.Tag = filepath.Base(os.Args[0])
+	}
+	if cfg.AckTimeout <= 0 {
+		cfg.AckTimeout = defaultFluentAckTimeout
+	}
+
+	c := &fluentConn{cfg: &cfg}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return &fluentCore{LevelEnabler: enab, conn: c}, nil
+}
+
+func (c *fluentCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	return &clone
+}
+
+func (c *fluentCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *fluentCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	menc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(menc)
+	}
+	for _, f := range fields {
+		f.AddTo(menc)
+	}
+
+	record := menc.Fields
+	record["level"] = ent.Level.String()
+	record["msg"] = ent.Message
+	if ent.LoggerName != "" {
+		record["logger"] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		record["caller"] = ent.Caller.TrimmedPath()
+	}
+	if ent.Stack != "" {
+		record["stacktrace"] = ent.Stack
+	}
+
+	tag := c.conn.cfg.Tag
+	if ent.LoggerName != "" {
+		tag += "." + ent.LoggerName
+	}
+	return c.conn.post(tag, ent.Time, record)
+}
+
+func (c *fluentCore) Sync() error {
+	return nil
+}
+
+// Close closes the connection to Fluentd.
+func (c *fluentCore) Close() error {
+	return c.conn.close()
+}
+
+func (c *fluentConn) connect() error {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	conn, err := net.Dial(c.cfg.Network, c.cfg.Address)
+	if err != nil {
+		c.conn = nil
+		return err
+	}
+	c.conn = conn
+	c.br = bufio.NewReader(conn)
+	return nil
+}
+
+// post sends an entry, reconnecting and retrying once on failure.
+func (c *fluentConn) post(tag string, t time.Time, record map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var chunk string
+	if c.cfg.RequireAck {
+		var id [16]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return newSyncerError(ErrDropped, err)
+		}
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+	}
+
+	// [tag, time, record] or [tag, time, record, {"chunk": id}]
+	b := c.buf[:0]
+	if chunk == "" {
+		b = append(b, 0x93)
+	} else {
+		b = append(b, 0x94)
+	}
+	b = appendMsgpackString(b, tag)
+	b = appendMsgpackEventTime(b, t)
+	b = appendMsgpack(b, record)
+	if chunk != "" {
+		b = appendMsgpack(b, map[string]interface{}{"chunk": chunk})
+	}
+	c.buf = b
+
+	var err error
+	for i := 0; i <= defaultWriteRetries; i++ {
+		if c.conn == nil {
+			if c.closed {
+				return newSyncerError(ErrNotConnected, errSyncerClosed)
+			}
+			if err = c.connect(); err != nil {
+				err = newSyncerError(ErrNotConnected, err)
+				continue
+			}
+		}
+		if err = c.send(b, chunk); err == nil {
+			return nil
+		}
+		err = newSyncerError(ErrDropped, err)
+		c.conn.Close()
+		c.conn = nil
+	}
+	return err
+}
+
+// send writes an encoded entry, and waits for its ack if chunk is set.
+func (c *fluentConn) send(b []byte, chunk string) error {
+	if _, err := c.conn.Write(b); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(c.cfg.AckTimeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	v, err := readMsgpack(c.br)
+	if err != nil {
+		return err
+	}
+	resp, _ := v.(map[string]interface{})
+	if ack, _ := resp["ack"].(string); ack != chunk {
+		return fmt.Errorf("zapsyslog: unexpected fluentd ack %v", v)
+	}
+	return nil
+}
+
+func (c *fluentConn) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// startFluentServer accepts forward protocol connections and sends the
+// decoded messages to the returned channel. With ack, received chunks are
+// acknowledged, except on the first connection if dropFirst is set, which
+// is closed on its first message instead.
+func startFluentServer(t *testing.T, ack, dropFirst bool) (string, <-chan []interface{}) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	msgs := make(chan []interface{}, 10)
+	go func() {
+		for first := true; ; first = false {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn, drop bool) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					v, err := readMsgpack(r)
+					if err != nil {
+						return
+					}
+					if drop {
+						return
+					}
+					msg := v.([]interface{})
+					msgs <- msg
+					if ack && len(msg) == 4 {
+						chunk := msg[3].(map[string]interface{})["chunk"]
+						conn.Write(appendMsgpack(nil, map[string]interface{}{"ack": chunk}))
+					}
+				}
+			}(conn, first && dropFirst)
+		}
+	}()
+	return l.Addr().String(), msgs
+}
+
+func TestFluentCore(t *testing.T) {
+	addr, msgs := startFluentServer(t, false, false)
+	core, err := NewFluentCore(FluentConfig{Address: addr, Tag: "app"}, zapcore.InfoLevel)
+	require.NoError(t, err)
+	defer core.(io.Closer).Close()
+
+	logger := zap.New(core).Named("http").With(zap.String("id", "42"))
+	logger.Debug("ignored")
+	logger.Info("hello", zap.Int("status", -200), zap.Bool("ok", true))
+
+	msg := <-msgs
+	require.Len(t, msg, 3)
+	assert.Equal(t, "app.http", msg[0])
+	ts, ok := msg[1].(msgpackExt)
+	require.True(t, ok, "time should be an EventTime, got: %#v", msg[1])
+	assert.Equal(t, int8(0), ts.Type)
+	sec := int64(binary.BigEndian.Uint32(ts.Data))
+	assert.InDelta(t, time.Now().Unix(), sec, 5)
+	assert.Equal(t, map[string]interface{}{
+		"level":  "info",
+		"msg":    "hello",
+		"logger": "http",
+		"id":     "42",
+		"status": int64(-200),
+		"ok":     true,
+	}, msg[2])
+}
+
+func TestFluentCoreAck(t *testing.T) {
+	addr, msgs := startFluentServer(t, true, true)
+	core, err := NewFluentCore(FluentConfig{
+		Address:    addr,
+		Tag:        "app",
+		RequireAck: true,
+		AckTimeout: time.Second,
+	}, zapcore.InfoLevel)
+	require.NoError(t, err)
+	defer core.(io.Closer).Close()
+
+	// The first connection is dropped without an ack, the entry is sent
+	// again on a new one
+	require.NoError(t, core.Write(zapcore.Entry{Message: "hello", Time: time.Now()}, nil))
+	msg := <-msgs
+	require.Len(t, msg, 4)
+	assert.Equal(t, "hello", msg[2].(map[string]interface{})["msg"])
+
+	require.NoError(t, core.(io.Closer).Close())
+	err = core.Write(zapcore.Entry{Message: "late"}, nil)
+	assert.True(t, errors.Is(err, ErrNotConnected), "unexpected error: %v", err)
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	long := string(make([]byte, 300))
+	for _, tt := range []struct {
+		in, out interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{int8(-33), int64(-33)},
+		{int16(-300), int64(-300)},
+		{int32(-70000), int64(-70000)},
+		{int64(-1 << 40), int64(-1 << 40)},
+		{-5, int64(-5)},
+		{127, int64(127)},
+		{uint8(200), uint64(200)},
+		{uint16(60000), uint64(60000)},
+		{uint32(1 << 31), uint64(1 << 31)},
+		{uint64(1 << 63), uint64(1 << 63)},
+		{float32(1.5), float64(1.5)},
+		{2.25, 2.25},
+		{"short", "short"},
+		{long, long},
+		{[]byte{1, 2}, []byte{1, 2}},
+		{3 * time.Second, "3s"},
+		{time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC), "2017-01-02T03:04:05Z"},
+		{make([]interface{}, 20), make([]interface{}, 20)},
+		{map[string]interface{}{"k": []interface{}{"v"}}, map[string]interface{}{"k": []interface{}{"v"}}},
+		{struct{ A int }{1}, map[string]interface{}{"A": float64(1)}},
+	} {
+		v, err := readMsgpack(bufio.NewReader(bytes.NewReader(appendMsgpack(nil, tt.in))))
+		if assert.NoError(t, err, "%#v", tt.in) {
+			assert.Equal(t, tt.out, v, "%#v", tt.in)
+		}
+	}
+}
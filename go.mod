@@ -0,0 +1,19 @@
+module github.com/imperfectgo/zap-syslog
+
+go 1.18
+
+require (
+	github.com/stretchr/testify v1.8.2
+	go.uber.org/fx v1.18.2
+	go.uber.org/multierr v1.5.0
+	go.uber.org/zap v1.16.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.uber.org/atomic v1.6.0 // indirect
+	go.uber.org/dig v1.15.0 // indirect
+	golang.org/x/sys v0.12.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ LatencyStats = &HealthHandler{}
+	_ http.Handler = &HealthHandler{}
+)
+
+// HealthHandler is an http.Handler reporting the state of the logging
+// pipeline as JSON, e.g. for /healthz: whether the syncer is connected, the
+// queue depth, the counts of messages sent and dropped and the last error.
+// It responds with 503 Service Unavailable when the syncer isn't connected
+// or its last write failed. It counts messages as a Stats:
+//
+//	h := zapsyslog.NewHealthHandler()
+//	sink, err := zapsyslog.NewConnSyncer("tcp", addr, zapsyslog.WithStats(h))
+//	...
+//	async := zapsyslog.NewAsyncSyncer(sink, zapsyslog.WithQueueStats(h))
+//	h.Watch(sink, async)
+//	http.Handle("/healthz/logging", h)
+type HealthHandler struct {
+	sent       int64
+	dropped    int64
+	reconnects int64
+
+	mu    sync.Mutex
+	conn  *ConnSyncer
+	async *AsyncSyncer
+}
+
+// NewHealthHandler returns a handler to be passed to WithStats, and
+// WithQueueStats for asynchronous syncers.
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{}
+}
+
+// Watch sets the syncers whose state is reported, async may be nil.
+func (h *HealthHandler) Watch(s *ConnSyncer, async *AsyncSyncer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conn = s
+	h.async = async
+}
+
+type healthPayload struct {
+	Healthy     bool       `json:"healthy"`
+	Connected   bool       `json:"connected"`
+	QueueDepth  int        `json:"queueDepth"`
+	Sent        int64      `json:"sent"`
+	Dropped     int64      `json:"dropped"`
+	Reconnects  int64      `json:"reconnects"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+}
+
+// ServeHTTP is a simple JSON endpoint that reports the pipeline state.
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	s, async := h.conn, h.async
+	h.mu.Unlock()
+
+	p := healthPayload{
+		Sent:       atomic.LoadInt64(&h.sent),
+		Dropped:    atomic.LoadInt64(&h.dropped),
+		Reconnects: atomic.LoadInt64(&h.reconnects),
+	}
+	if async != nil {
+		p.QueueDepth = async.QueueDepth()
+	}
+	if s != nil {
+		s.mu.Lock()
+		p.Connected = s.conn != nil && !s.closed
+		lastErr, lastErrAt, lastSuccess := s.lastErr, s.lastErrAt, s.lastSuccess
+		s.mu.Unlock()
+
+		p.Healthy = p.Connected
+		if lastErr != nil {
+			p.LastError = lastErr.Error()
+			p.LastErrorAt = &lastErrAt
+			p.Healthy = p.Healthy && lastSuccess.After(lastErrAt)
+		}
+		if !lastSuccess.IsZero() {
+			p.LastSuccess = &lastSuccess
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !p.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(p)
+}
+
+// Written implements Stats.
+func (h *HealthHandler) Written(n int) {
+	atomic.AddInt64(&h.sent, 1)
+}
+
+// Dropped implements Stats.
+func (h *HealthHandler) Dropped(err error) {
+	atomic.AddInt64(&h.dropped, 1)
+}
+
+// Reconnected implements Stats.
+func (h *HealthHandler) Reconnected() {
+	atomic.AddInt64(&h.reconnects, 1)
+}
+
+// ObserveEncode implements LatencyStats, latencies aren't reported.
+func (h *HealthHandler) ObserveEncode(d time.Duration) {}
+
+// ObserveWrite implements LatencyStats, latencies aren't reported.
+func (h *HealthHandler) ObserveWrite(d time.Duration) {}
+
+// ObserveQueue implements LatencyStats, latencies aren't reported.
+func (h *HealthHandler) ObserveQueue(d time.Duration) {}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthHandler(t *testing.T) {
+	done := make(chan string)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	h := NewHealthHandler()
+	s, err := NewConnSyncer("tcp", addr, WithStats(h), WithMaxMessageSize(10))
+	require.NoError(t, err)
+	defer s.Close()
+	ws := newGatedSyncer()
+	async := NewAsyncSyncer(ws, WithQueueSize(1), WithQueueStats(h))
+	h.Watch(s, async)
+
+	check := func(status int) map[string]interface{} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(t, status, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		var p map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		return p
+	}
+
+	p := check(http.StatusOK)
+	assert.Equal(t, true, p["connected"])
+	assert.Nil(t, p["lastSuccess"], "Nothing has been written yet.")
+
+	_, err = s.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	<-done
+	p = check(http.StatusOK)
+	assert.Equal(t, true, p["healthy"])
+	assert.Equal(t, float64(1), p["sent"])
+	assert.NotNil(t, p["lastSuccess"])
+
+	_, err = s.Write([]byte("too large message\n"))
+	require.Error(t, err)
+	p = check(http.StatusServiceUnavailable)
+	assert.Equal(t, false, p["healthy"])
+	assert.Equal(t, float64(1), p["dropped"])
+	assert.Equal(t, err.Error(), p["lastError"])
+
+	_, err = async.Write([]byte("held"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return async.QueueDepth() == 0
+	}, time.Second, time.Millisecond)
+	_, err = async.Write([]byte("queued"))
+	require.NoError(t, err)
+	_, err = s.Write([]byte("again\n"))
+	require.NoError(t, err)
+	<-done
+	p = check(http.StatusOK)
+	assert.Equal(t, float64(1), p["queueDepth"])
+	assert.Equal(t, float64(2), p["sent"])
+
+	require.NoError(t, s.Close())
+	p = check(http.StatusServiceUnavailable)
+	assert.Equal(t, false, p["connected"])
+}
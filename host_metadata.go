@@ -0,0 +1,119 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"io/ioutil"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	hostMetadataOnce sync.Once
+	hostMetadataVal  *hostMetadata
+)
+
+// hostMetadata describes the host the process runs on.
+type hostMetadata struct {
+	IPs    []string
+	OS     string
+	Kernel string
+	Arch   string
+}
+
+// getHostMetadata gathers host metadata once and returns the cached result afterwards.
+func getHostMetadata() *hostMetadata {
+	hostMetadataOnce.Do(func() {
+		hostMetadataVal = &hostMetadata{
+			IPs:    hostIPs(),
+			OS:     runtime.GOOS,
+			Kernel: kernelVersion(),
+			Arch:   runtime.GOARCH,
+		}
+	})
+	return hostMetadataVal
+}
+
+// hostIPs returns the non-loopback unicast addresses of the host.
+func hostIPs() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	var ips []string
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ips = append(ips, ipnet.IP.String())
+	}
+	return ips
+}
+
+// kernelVersion returns the kernel release, it's only available on Linux.
+func kernelVersion() string {
+	b, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (m *hostMetadata) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if len(m.IPs) > 0 {
+		enc.AddArray("ip", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			for _, ip := range m.IPs {
+				arr.AppendString(ip)
+			}
+			return nil
+		}))
+	}
+	enc.AddString("os", m.OS)
+	if m.Kernel != "" {
+		enc.AddString("kernel", m.Kernel)
+	}
+	enc.AddString("arch", m.Arch)
+	return nil
+}
+
+// appendSDElement appends the metadata as an SD-ELEMENT with the given SD-ID,
+// "ip" is repeated for every address like the "origin" SD-ID of RFC5424 does.
+func (m *hostMetadata) appendSDElement(buf *buffer.Buffer, id string, maxValueLen int) {
+	buf.AppendByte('[')
+	buf.AppendString(id)
+	truncated := false
+	for _, ip := range m.IPs {
+		truncated = appendSDParam(buf, "ip", ip, maxValueLen) || truncated
+	}
+	truncated = appendSDParam(buf, "os", m.OS, maxValueLen) || truncated
+	if m.Kernel != "" {
+		truncated = appendSDParam(buf, "kernel", m.Kernel, maxValueLen) || truncated
+	}
+	truncated = appendSDParam(buf, "arch", m.Arch, maxValueLen) || truncated
+	closeSDElement(buf, truncated)
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// HostnameNormalization controls how the characters of HOSTNAME outside of
+// RFC5424's printable US-ASCII are written.
+type HostnameNormalization int
+
+const (
+	// StrictHostname replaces each of them with '_', the default, or as set
+	// by InvalidChars.
+	StrictHostname HostnameNormalization = iota
+	// PercentEncodeHostname percent-encodes their UTF-8 bytes, and '%'
+	// itself, so that the hostname can be decoded back.
+	PercentEncodeHostname
+	// PassThroughHostname keeps printable Unicode characters as is, for
+	// collectors accepting UTF-8 hostnames. Spaces, control characters and
+	// invalid UTF-8 are still replaced with '_'.
+	PassThroughHostname
+	// PunycodeHostname converts the labels of internationalized hostnames
+	// to their ASCII "xn--" form, e.g. "xn--bcher-kva.example" for
+	// "bücher.example", after lowercasing them. Other characters outside of
+	// printable US-ASCII are replaced with '_'. Unicode normalization isn't
+	// applied, hostnames are expected in NFC form.
+	PunycodeHostname
+)
+
+// Punycode parameters, see RFC3492 section 5.
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 0x80
+	punyPrefix      = "xn--"
+)
+
+// normalizeHostname makes hostname a valid HOSTNAME with the strategy n,
+// truncated to 255 bytes without splitting characters or escapes. m applies
+// to the characters left invalid by StrictHostname and PunycodeHostname.
+func normalizeHostname(hostname string, n HostnameNormalization, m charMapper) string {
+	if hostname == "" {
+		return nilValue
+	}
+	switch n {
+	case PercentEncodeHostname:
+		return percentEncodeHostname(hostname, maxHostnameLen)
+	case PassThroughHostname:
+		hostname = strings.Map(func(r rune) rune {
+			if r == utf8.RuneError || r <= ' ' || r == 0x7f || !unicode.IsPrint(r) {
+				return '_'
+			}
+			return r
+		}, hostname)
+		if len(hostname) > maxHostnameLen {
+			cut := maxHostnameLen
+			for !utf8.RuneStart(hostname[cut]) {
+				cut--
+			}
+			hostname = hostname[:cut]
+		}
+		return hostname
+	case PunycodeHostname:
+		hostname = toASCIIHostname(hostname)
+	}
+
+	hostname = m.apply(hostname, maxHostnameLen)
+	if hostname == "" {
+		return nilValue
+	}
+	if len(hostname) > maxHostnameLen {
+		hostname = hostname[:maxHostnameLen]
+	}
+	return hostname
+}
+
+// percentEncodeHostname percent-encodes the bytes of s outside of printable
+// US-ASCII, and '%', up to the last character fitting in maxLen bytes.
+func percentEncodeHostname(s string, maxLen int) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for len(s) > 0 {
+		_, n := utf8.DecodeRuneInString(s)
+		if c := s[0]; c >= 33 && c <= 126 && c != '%' {
+			if b.Len()+1 > maxLen {
+				break
+			}
+			b.WriteByte(c)
+		} else {
+			if b.Len()+3*n > maxLen {
+				break
+			}
+			for j := 0; j < n; j++ {
+				b.WriteByte('%')
+				b.WriteByte(hex[s[j]>>4])
+				b.WriteByte(hex[s[j]&0xf])
+			}
+		}
+		s = s[n:]
+	}
+	return b.String()
+}
+
+// toASCIIHostname converts the non-ASCII labels of hostname to punycode.
+func toASCIIHostname(hostname string) string {
+	labels := strings.Split(hostname, ".")
+	for i, label := range labels {
+		for j := 0; j < len(label); j++ {
+			if label[j] >= utf8.RuneSelf {
+				labels[i] = punyPrefix + punycode(strings.ToLower(label))
+				break
+			}
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// punycode encodes s with the Punycode algorithm of RFC3492.
+func punycode(s string) string {
+	runes := []rune(s)
+	out := make([]byte, 0, 2*len(s))
+	for _, r := range runes {
+		if r < punyInitialN {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for handled < len(runes) {
+		// The smallest code point not handled yet
+		m := rune(utf8.MaxRune + 1)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > (punyBase-punyTMin)*punyTMax/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		n        HostnameNormalization
+		expected string
+	}{
+		{"", StrictHostname, "-"},
+		{"bücher.example", StrictHostname, "b_cher.example"},
+		{"bücher.example", PercentEncodeHostname, "b%C3%BCcher.example"},
+		{"100%host", PercentEncodeHostname, "100%25host"},
+		{"bad\xff", PercentEncodeHostname, "bad%FF"},
+		{"bücher.example", PassThroughHostname, "bücher.example"},
+		{"edge 1\x00\xff", PassThroughHostname, "edge_1__"},
+		{"Bücher.example", PunycodeHostname, "xn--bcher-kva.example"},
+		{"例え.テスト", PunycodeHostname, "xn--r8jz45g.xn--zckzah"},
+		{"edge 1.münchen", PunycodeHostname, "edge_1.xn--mnchen-3ya"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, normalizeHostname(tt.hostname, tt.n, charMapper{}), "%q with %d", tt.hostname, tt.n)
+	}
+}
+
+func TestPunycode(t *testing.T) {
+	// Samples of RFC3492 section 7.1
+	tests := map[string]string{
+		"他们为什么不说中文":              "ihqwcrb4cv8a8dqg056pqjye",
+		"Pročprostěnemluvíčesky": "Proprostnemluvesky-uyb24dma41a",
+		"3年B組金八先生":               "3B-ww4c5e180e575a65lsy2b",
+		"そのスピードで":                "d9juau41awczczp",
+		"\u0644\u064a\u0647\u0645\u0627\u0628\u062a\u0643\u0644\u0645\u0648\u0634\u0639\u0631\u0628\u064a\u061f": "egbpdaj6bu4bxfgehfvwxn",
+	}
+	for in, expected := range tests {
+		assert.Equal(t, expected, punycode(in), in)
+	}
+}
+
+func TestNormalizeHostnameTruncation(t *testing.T) {
+	// An escape or a character crossing the limit is dropped whole
+	for _, prefix := range []string{strings.Repeat("a", 251), strings.Repeat("a", 253), strings.Repeat("a", 254)} {
+		h := normalizeHostname(prefix+"ü", PercentEncodeHostname, charMapper{})
+		assert.Equal(t, prefix, h)
+	}
+	for _, prefix := range []string{strings.Repeat("a", 254)} {
+		h := normalizeHostname(prefix+"ü", PassThroughHostname, charMapper{})
+		assert.Equal(t, prefix, h)
+	}
+	assert.Len(t, normalizeHostname(strings.Repeat("ü", 300), StrictHostname, charMapper{}), maxHostnameLen)
+}
+
+func TestSyslogEncoderHostnameNormalization(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.Hostname = "bücher"
+	cfg.HostnameNormalization = PercentEncodeHostname
+	enc := NewSyslogEncoder(cfg)
+
+	buf, err := enc.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.Contains(t, buf.String(), " b%C3%BCcher encoder_test ")
+
+	buf2, err := WithHostname(enc, "例え").EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf2.Free()
+	assert.Contains(t, buf2.String(), " %E4%BE%8B%E3%81%88 encoder_test ")
+}
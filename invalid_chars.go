@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"strings"
+)
+
+// InvalidCharReplacement controls how the characters of HOSTNAME and
+// APP-NAME outside of RFC5424's printable US-ASCII are written.
+type InvalidCharReplacement int
+
+const (
+	// ReplaceInvalidChars, the default, replaces each of them with a single
+	// character, '_' unless set otherwise.
+	ReplaceInvalidChars InvalidCharReplacement = iota
+	// PercentEncodeInvalidChars percent-encodes their UTF-8 bytes, and '%'
+	// itself, so that the values can be decoded back.
+	PercentEncodeInvalidChars
+	// RemoveInvalidChars drops them.
+	RemoveInvalidChars
+)
+
+// charMapper makes strings printable US-ASCII, its zero value replaces
+// other characters with '_'.
+type charMapper struct {
+	mode        InvalidCharReplacement
+	replacement rune
+}
+
+func newCharMapper(mode InvalidCharReplacement, replacement rune) charMapper {
+	if replacement < 33 || replacement > 126 {
+		replacement = '_'
+	}
+	return charMapper{mode: mode, replacement: replacement}
+}
+
+// apply returns s made printable US-ASCII, possibly empty once invalid
+// characters are removed. Percent-encoded values are truncated to maxLen
+// bytes, if positive, without splitting characters.
+func (m charMapper) apply(s string, maxLen int) string {
+	if m.mode == PercentEncodeInvalidChars {
+		if maxLen <= 0 {
+			maxLen = 3 * len(s)
+		}
+		return percentEncodeHostname(s, maxLen)
+	}
+	replacement := m.replacement
+	switch {
+	case m.mode == RemoveInvalidChars:
+		replacement = -1
+	case replacement == 0:
+		replacement = '_'
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return replacement
+		}
+		return r
+	}, s)
+}
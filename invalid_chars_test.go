@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCharMapper(t *testing.T) {
+	tests := []struct {
+		s           string
+		mode        InvalidCharReplacement
+		replacement rune
+		expected    string
+	}{
+		{"my app", ReplaceInvalidChars, 0, "my_app"},
+		{"my app", ReplaceInvalidChars, '-', "my-app"},
+		{"my app", ReplaceInvalidChars, 'é', "my_app"},
+		{"my app", ReplaceInvalidChars, ' ', "my_app"},
+		{"bücher 1", RemoveInvalidChars, 0, "bcher1"},
+		{"bücher 1", PercentEncodeInvalidChars, 0, "b%C3%BCcher%201"},
+		{"100%", PercentEncodeInvalidChars, 0, "100%25"},
+	}
+	for _, tt := range tests {
+		m := newCharMapper(tt.mode, tt.replacement)
+		assert.Equal(t, tt.expected, m.apply(tt.s, 0), "%q with %d and %q", tt.s, tt.mode, tt.replacement)
+	}
+	assert.Equal(t, "a%C3%BC", newCharMapper(PercentEncodeInvalidChars, 0).apply("aüü", 8), "Escapes shouldn't be split.")
+}
+
+func TestNormalizeInvalidChars(t *testing.T) {
+	remove := newCharMapper(RemoveInvalidChars, 0)
+	assert.Equal(t, "-", normalizeHostname("例え", StrictHostname, remove), "Empty values should be nil.")
+	assert.Equal(t, "-", normalizeAppName("例え", KeepAppNameHead, remove))
+	assert.Equal(t, "edge1.xn--mnchen-3ya", normalizeHostname("edge 1.münchen", PunycodeHostname, remove))
+	assert.Equal(t, "bücher", normalizeHostname("bücher", PassThroughHostname, remove), "Other normalizations should be kept.")
+
+	percent := newCharMapper(PercentEncodeInvalidChars, 0)
+	app := normalizeAppName(string(make([]byte, 60)), KeepAppNameHead, percent)
+	assert.Len(t, app, maxAppNameLen)
+	assert.Equal(t, "%00", app[len(app)-3:])
+}
+
+func TestSyslogEncoderInvalidChars(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.Hostname = "edge_1 ü"
+	cfg.App = "my app"
+	cfg.InvalidChars = ReplaceInvalidChars
+	cfg.InvalidCharRune = '.'
+	enc := NewSyslogEncoder(cfg)
+
+	buf, err := enc.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.Contains(t, buf.String(), " edge_1.. my.app ")
+
+	buf2, err := WithApp(WithHostname(enc, "b ü"), "app ü").EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf2.Free()
+	assert.Contains(t, buf2.String(), " b.. app.. ")
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultJournalSocket = "/run/systemd/journal/socket"
+	maxJournalFieldLen   = 64
+)
+
+// JournalFieldPolicy controls what happens to fields missing from JournalConfig.FieldMap.
+type JournalFieldPolicy int
+
+const (
+	// FoldUnmappedFields appends the unmapped fields as a JSON object to MESSAGE.
+	FoldUnmappedFields JournalFieldPolicy = iota
+	// IndexUnmappedFields sends each unmapped field as an indexed journal
+	// field named after its uppercased key.
+	IndexUnmappedFields
+)
+
+// JournalConfig configures the journald core.
+type JournalConfig struct {
+	// Socket is the journald native protocol socket, defaults to
+	// /run/systemd/journal/socket.
+	Socket string `json:"socket" yaml:"socket"`
+	// SyslogIdentifier sets SYSLOG_IDENTIFIER, defaults to the executable name.
+	SyslogIdentifier string `json:"syslogIdentifier" yaml:"syslogIdentifier"`
+	// Facility sets SYSLOG_FACILITY.
+	Facility syslog.Priority `json:"facility" yaml:"facility"`
+	// FieldMap maps zap field keys to journal field names, e.g. "user_id" to
+	// "USER_ID". Mapped fields are always sent as indexed journal fields.
+	FieldMap map[string]string `json:"fieldMap" yaml:"fieldMap"`
+	// Unmapped controls the fields missing from FieldMap.
+	Unmapped JournalFieldPolicy `json:"unmapped" yaml:"unmapped"`
+}
+
+type journalCore struct {
+	zapcore.LevelEnabler
+	cfg    *JournalConfig
+	conn   net.Conn
+	fields []zapcore.Field
+}
+
+var _ io.Closer = &journalCore{}
+
+// NewJournalCore creates a core writing entries to journald with its native
+// protocol, mapping fields to journal fields as configured. The core is an
+// io.Closer, closing it closes the socket shared with the cores derived from
+// it.
+func NewJournalCore(cfg JournalConfig, enab zapcore.LevelEnabler) (zapcore.Core, error) {
+	if cfg.Socket == "" {
+		cfg.Socket = defaultJournalSocket
+	}
+	if cfg.SyslogIdentifier == "" {
+		cfg.SyslogIdentifier = filepath.Base(os.Args[0])
+	}
+	for k, name := range cfg.FieldMap {
+		if !isValidJournalField(name) {
+			return nil, fmt.Errorf("zapsyslog: invalid journal field name %q for %q", name, k)
+		}
+	}
+
+	conn, err := net.Dial("unixgram", cfg.Socket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &journalCore{
+		LevelEnabler: enab,
+		cfg:          &cfg,
+		conn:         conn,
+	}, nil
+}
+
+// isValidJournalField reports whether name is a valid, non-trusted journal
+// field name: uppercase letters, digits and underscores starting with a
+// letter.
+func isValidJournalField(name string) bool {
+	if name == "" || len(name) > maxJournalFieldLen || name[0] < 'A' || name[0] > 'Z' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// toJournalField derives a journal field name from a zap field key, it
+// returns an empty string if none could be derived, e.g. from keys starting
+// with a digit, whose fields are then folded.
+func toJournalField(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		return ""
+	}
+	if len(name) > maxJournalFieldLen {
+		name = name[:maxJournalFieldLen]
+	}
+	return name
+}
+
+func (c *journalCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	return &clone
+}
+
+func (c *journalCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *journalCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	menc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(menc)
+	}
+	for _, f := range fields {
+		f.AddTo(menc)
+	}
+
+	keys := make([]string, 0, len(menc.Fields))
+	for k := range menc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	folded := make(map[string]interface{})
+	for _, k := range keys {
+		name, ok := c.cfg.FieldMap[k]
+		if !ok && c.cfg.Unmapped == IndexUnmappedFields {
+			name = toJournalField(k)
+			ok = name != ""
+		}
+		if ok {
+			appendJournalField(&buf, name, journalValue(menc.Fields[k]))
+		} else {
+			folded[k] = menc.Fields[k]
+		}
+	}
+
+	message := ent.Message
+	if len(folded) > 0 {
+		b, err := json.Marshal(folded)
+		if err != nil {
+			return err
+		}
+		message += " " + string(b)
+	}
+	appendJournalField(&buf, "MESSAGE", message)
+	appendJournalField(&buf, "PRIORITY", strconv.Itoa(int(PriorityFromLevel(ent.Level))))
+	appendJournalField(&buf, "SYSLOG_FACILITY", strconv.Itoa(int(c.cfg.Facility&facilityMask)>>3))
+	appendJournalField(&buf, "SYSLOG_IDENTIFIER", c.cfg.SyslogIdentifier)
+	if ent.LoggerName != "" {
+		appendJournalField(&buf, "LOGGER", ent.LoggerName)
+	}
+	if ent.Caller.Defined {
+		appendJournalField(&buf, "CODE_FILE", ent.Caller.File)
+		appendJournalField(&buf, "CODE_LINE", strconv.Itoa(ent.Caller.Line))
+		if fn := runtime.FuncForPC(ent.Caller.PC); fn != nil {
+			appendJournalField(&buf, "CODE_FUNC", fn.Name())
+		}
+	}
+	if ent.Stack != "" {
+		appendJournalField(&buf, "STACKTRACE", ent.Stack)
+	}
+
+	_, err := c.conn.Write(buf.Bytes())
+	return err
+}
+
+func (c *journalCore) Sync() error {
+	return nil
+}
+
+// Close closes the journald socket.
+func (c *journalCore) Close() error {
+	return c.conn.Close()
+}
+
+// appendJournalField appends a field in the journald native protocol format,
+// values containing line feeds are sent length-prefixed.
+func appendJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if strings.IndexByte(value, '\n') == -1 {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.WriteByte('\n')
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalValue renders a value collected by zapcore.MapObjectEncoder.
+func journalValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64:
+		return fmt.Sprint(v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// parseJournalFields decodes a journald native protocol datagram.
+func parseJournalFields(t testing.TB, b []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		require.True(t, i > 0, "malformed datagram")
+		line := b[:i]
+		b = b[i+1:]
+		if eq := bytes.IndexByte(line, '='); eq >= 0 {
+			fields[string(line[:eq])] = string(line[eq+1:])
+			continue
+		}
+		size := binary.LittleEndian.Uint64(b[:8])
+		fields[string(line)] = string(b[8 : 8+size])
+		b = b[8+size+1:]
+	}
+	return fields
+}
+
+func startJournalServer(t testing.TB) (string, net.PacketConn) {
+	f, err := ioutil.TempFile("", "journaltest")
+	require.NoError(t, err)
+	f.Close()
+	os.Remove(f.Name())
+
+	l, err := net.ListenPacket("unixgram", f.Name())
+	require.NoError(t, err)
+	return f.Name(), l
+}
+
+func readJournalFields(t testing.TB, l net.PacketConn) map[string]string {
+	var buf [65536]byte
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := l.ReadFrom(buf[:])
+	require.NoError(t, err)
+	return parseJournalFields(t, buf[:n])
+}
+
+func TestJournalCore(t *testing.T) {
+	socket, l := startJournalServer(t)
+	defer os.Remove(socket)
+	defer l.Close()
+
+	for _, policy := range []JournalFieldPolicy{FoldUnmappedFields, IndexUnmappedFields} {
+		core, err := NewJournalCore(JournalConfig{
+			Socket:           socket,
+			SyslogIdentifier: "journal_test",
+			Facility:         syslog.LOG_LOCAL0,
+			FieldMap:         map[string]string{"user_id": "USER_ID"},
+			Unmapped:         policy,
+		}, zapcore.DebugLevel)
+		require.NoError(t, err)
+
+		logger := zap.New(core).With(zap.String("user_id", "42"))
+		logger.Warn("hello\nworld", zap.Int("count", 3), zap.Bool("ok", true))
+
+		fields := readJournalFields(t, l)
+		assert.Equal(t, "42", fields["USER_ID"])
+		assert.Equal(t, "4", fields["PRIORITY"])
+		assert.Equal(t, "16", fields["SYSLOG_FACILITY"])
+		assert.Equal(t, "journal_test", fields["SYSLOG_IDENTIFIER"])
+		if policy == FoldUnmappedFields {
+			assert.Equal(t, "hello\nworld {\"count\":3,\"ok\":true}", fields["MESSAGE"])
+			assert.NotContains(t, fields, "COUNT")
+		} else {
+			assert.Equal(t, "hello\nworld", fields["MESSAGE"])
+			assert.Equal(t, "3", fields["COUNT"])
+			assert.Equal(t, "true", fields["OK"])
+		}
+	}
+}
+
+func TestJournalCoreInvalidFieldMap(t *testing.T) {
+	for _, name := range []string{"", "lower", "_TRUSTED", "WITH-DASH", "2FA"} {
+		_, err := NewJournalCore(JournalConfig{FieldMap: map[string]string{"k": name}}, zapcore.DebugLevel)
+		assert.Error(t, err, "journal field name %q should be rejected", name)
+	}
+}
+
+func TestToJournalField(t *testing.T) {
+	assert.Equal(t, "USER_ID", toJournalField("user.id"))
+	assert.Equal(t, "HTTP_STATUS", toJournalField("_http-status"))
+	assert.Equal(t, "", toJournalField("__"))
+	assert.Equal(t, "", toJournalField("2fa"))
+	assert.Equal(t, "", toJournalField("_2fa"))
+}
+
+func TestJournalCoreFoldsUnderivableFields(t *testing.T) {
+	socket, l := startJournalServer(t)
+	defer os.Remove(socket)
+	defer l.Close()
+
+	core, err := NewJournalCore(JournalConfig{Socket: socket, Unmapped: IndexUnmappedFields}, zapcore.DebugLevel)
+	require.NoError(t, err)
+	defer core.(io.Closer).Close()
+
+	zap.New(core).Info("hello", zap.Bool("2fa", true))
+	fields := readJournalFields(t, l)
+	assert.Equal(t, `hello {"2fa":true}`, fields["MESSAGE"])
+}
+
+func TestJournalCoreClose(t *testing.T) {
+	socket, l := startJournalServer(t)
+	defer os.Remove(socket)
+	defer l.Close()
+
+	core, err := NewJournalCore(JournalConfig{Socket: socket}, zapcore.DebugLevel)
+	require.NoError(t, err)
+	child := core.With([]zapcore.Field{zap.String("k", "v")})
+
+	require.NoError(t, core.(io.Closer).Close())
+	assert.Error(t, child.Write(zapcore.Entry{Message: "closed"}, nil))
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/imperfectgo/zap-syslog/internal/bufferpool"
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/zap/zapcore"
+)
+
+const kmsgPath = "/dev/kmsg"
+
+type kmsgCore struct {
+	zapcore.LevelEnabler
+	facility syslog.Priority
+	tag      string
+	enc      zapcore.Encoder
+	f        *os.File
+}
+
+// NewKmsgCore creates a core writing entries to /dev/kmsg as PRI-prefixed
+// records tagged "app[pid]:", enc formats the message. It allows init-like
+// programs to log before any syslog daemon or journald is available. The
+// kernel truncates records longer than about 1KB.
+func NewKmsgCore(facility syslog.Priority, app string, enc zapcore.Encoder, enab zapcore.LevelEnabler) (zapcore.Core, error) {
+	return newKmsgCore(kmsgPath, facility, app, enc, enab)
+}
+
+func newKmsgCore(path string, facility syslog.Priority, app string, enc zapcore.Encoder, enab zapcore.LevelEnabler) (zapcore.Core, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsgCore{
+		LevelEnabler: enab,
+		facility:     facility,
+		tag:          app + "[" + strconv.Itoa(os.Getpid()) + "]: ",
+		enc:          enc,
+		f:            f,
+	}, nil
+}
+
+func (c *kmsgCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *kmsgCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *kmsgCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	// Every write(2) to /dev/kmsg is a single record
+	rec := bufferpool.Get()
+	defer rec.Free()
+	rec.AppendByte('<')
+	rec.AppendInt(int64((c.facility & facilityMask) | (PriorityFromLevel(ent.Level) & severityMask)))
+	rec.AppendByte('>')
+	rec.AppendString(c.tag)
+	rec.Write(buf.Bytes())
+	_, err = c.f.Write(rec.Bytes())
+	return err
+}
+
+func (c *kmsgCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/rand"
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/buffer"
+)
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidLen is the length of an encoded ULID, within the 32 characters of
+// MSGID.
+const ulidLen = 26
+
+// ulidGenerator generates ULIDs, https://github.com/ulid/spec, for the
+// entries of an encoder and its clones. ULIDs of the same millisecond are
+// monotonic, so that the order of MSGIDs follows the order of messages.
+type ulidGenerator struct {
+	mu      sync.Mutex
+	rand    io.Reader
+	lastMs  uint64
+	entropy [10]byte
+}
+
+func newULIDGenerator() *ulidGenerator {
+	return &ulidGenerator{rand: rand.Reader}
+}
+
+// next returns the ULID of an entry logged at t. Within the last
+// millisecond, or before it following a clock step back, the random part of
+// the previous ULID is incremented instead.
+func (g *ulidGenerator) next(t time.Time) [ulidLen]byte {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+
+	g.mu.Lock()
+	if ms > g.lastMs || !g.increment() {
+		if ms <= g.lastMs {
+			// The random part overflowed, move on to the next millisecond
+			ms = g.lastMs + 1
+		}
+		if _, err := io.ReadFull(g.rand, g.entropy[:]); err != nil {
+			// Uniqueness still holds in-process with the incremented value
+			g.increment()
+		}
+		g.lastMs = ms
+	}
+	ms, entropy := g.lastMs, g.entropy
+	g.mu.Unlock()
+
+	return encodeULID(ms, entropy)
+}
+
+// increment adds one to the random part, returning false on overflow.
+func (g *ulidGenerator) increment() bool {
+	for i := len(g.entropy) - 1; i >= 0; i-- {
+		g.entropy[i]++
+		if g.entropy[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID encodes the 48-bit timestamp ms and the 80-bit random part as
+// 26 base32 characters, most significant bits first.
+func encodeULID(ms uint64, entropy [10]byte) [ulidLen]byte {
+	var id [ulidLen]byte
+	for i := 9; i >= 0; i-- {
+		id[i] = crockford[ms&31]
+		ms >>= 5
+	}
+	// 80 bits are 16 characters, 5 bytes at a time
+	for i := 0; i < 2; i++ {
+		var v uint64
+		for _, b := range entropy[i*5 : i*5+5] {
+			v = v<<8 | uint64(b)
+		}
+		for j := 7; j >= 0; j-- {
+			id[10+i*8+j] = crockford[v&31]
+			v >>= 5
+		}
+	}
+	return id
+}
+
+// appendMessageID appends the MSGID of an entry logged at t.
+func (g *ulidGenerator) appendMessageID(buf *buffer.Buffer, t time.Time) {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	id := g.next(t)
+	buf.Write(id[:])
+}
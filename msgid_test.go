@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("no entropy")
+}
+
+func TestEncodeULID(t *testing.T) {
+	// The timestamp of the spec's example, 01ARZ3NDEK
+	id := encodeULID(1469922850259, [10]byte{})
+	assert.Equal(t, "01ARZ3NDEK0000000000000000", string(id[:]))
+	id = encodeULID(1<<48-1, [10]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", string(id[:]))
+}
+
+func TestULIDGeneratorMonotonic(t *testing.T) {
+	g := newULIDGenerator()
+	now := time.Now()
+	var prev string
+	for i, at := range []time.Time{now, now, now.Add(-time.Second), now.Add(time.Millisecond)} {
+		id := g.next(at)
+		assert.True(t, string(id[:]) > prev, "ULID %d should sort after the previous one: %s <= %s", i, id[:], prev)
+		prev = string(id[:])
+	}
+
+	g.entropy = [10]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	last := g.lastMs
+	id := g.next(now)
+	assert.Equal(t, last+1, g.lastMs, "Overflow should move to the next millisecond.")
+	assert.True(t, string(id[:]) > prev)
+
+	g.rand = failingReader{}
+	prev = string(id[:])
+	id = g.next(now.Add(time.Hour))
+	assert.True(t, string(id[:]) > prev, "ULIDs should stay unique without entropy.")
+}
+
+func TestSyslogEncoderMessageIDs(t *testing.T) {
+	cfg := testEncoderConfig(NonTransparentFraming)
+	cfg.MessageIDs = true
+	enc := NewSyslogEncoder(cfg)
+	clone := WithApp(enc.Clone(), "other")
+
+	seen := map[string]bool{}
+	var prev string
+	for i := 0; i < 100; i++ {
+		e := enc
+		if i%2 == 1 {
+			e = clone
+		}
+		buf, err := e.EncodeEntry(testEntry, nil)
+		require.NoError(t, err)
+		m, err := syslog.ParseMessage(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+		require.NoError(t, err)
+		buf.Free()
+
+		require.Len(t, m.MsgID, ulidLen)
+		assert.False(t, seen[m.MsgID], "Duplicate MSGID %s", m.MsgID)
+		assert.True(t, m.MsgID > prev, "MSGIDs should be sorted, clones included.")
+		seen[m.MsgID] = true
+		prev = m.MsgID
+	}
+	ts := encodeULID(uint64(testEntry.Time.UnixNano()/int64(time.Millisecond)), [10]byte{})
+	assert.Equal(t, string(ts[:10]), prev[:10], "The timestamp should be the entry's.")
+}
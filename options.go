@@ -0,0 +1,174 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// A SyncerOption configures a ConnSyncer.
+type SyncerOption interface {
+	apply(*ConnSyncer)
+}
+
+// syncerOptionFunc wraps a func so it satisfies the SyncerOption interface.
+type syncerOptionFunc func(*ConnSyncer)
+
+func (f syncerOptionFunc) apply(s *ConnSyncer) {
+	f(s)
+}
+
+// WithRetryBudget limits reconnect attempts with the given budget, which may be
+// shared by several syncers. Writes fail fast once the budget is exhausted.
+func WithRetryBudget(b *RetryBudget) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.budget = b
+	})
+}
+
+// WithBudgetReset refills the retry budget once a connection has been up for
+// d, on its next successful write, so that a budget drained by an outage is
+// whole again for the next one instead of refilling at its slow rate.
+func WithBudgetReset(d time.Duration) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.budgetResetAfter = d
+	})
+}
+
+// WithWriteRetries sets how many times a failed Write is retried in-line
+// after reconnecting, zero disables retrying. The default is one. Timeouts
+// aren't retried unless set with WithClassRetries.
+func WithWriteRetries(n int) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		if n < 0 {
+			n = 0
+		}
+		s.retries = n
+	})
+}
+
+// WithClassRetries sets how many times a write failing with an error of the
+// given class is retried in-line, overriding WithWriteRetries. By default
+// ResetErrors and OtherErrors follow WithWriteRetries, so that a reset
+// connection is re-dialed at once, and TimeoutErrors aren't retried, so
+// that the caller backs off straight away. The class of
+// the latest error decides, e.g. a reset followed by a timed out re-dial
+// isn't retried further.
+func WithClassRetries(class ErrorClass, n int) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		if class < 0 || class >= numErrorClasses {
+			return
+		}
+		if n < 0 {
+			n = 0
+		}
+		s.classRetries[class] = n
+	})
+}
+
+// WithMaxMessageSize makes writes of messages longer than n bytes fail with
+// ErrMessageTooLarge instead of being sent, zero means no limit.
+func WithMaxMessageSize(n int) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.maxSize = n
+	})
+}
+
+// WithWriteBuffer buffers writes to stream connections (TCP, TLS and unix
+// sockets) so that small messages coalesce into fewer segments. The buffer
+// holds size bytes and is flushed once flushThreshold bytes are pending, a
+// threshold of zero or above size flushes only when the buffer is full.
+//
+// Messages still buffered when the connection breaks are lost.
+func WithWriteBuffer(size, flushThreshold int) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		if flushThreshold <= 0 || flushThreshold > size {
+			flushThreshold = size
+		}
+		s.bufSize = size
+		s.flushAt = flushThreshold
+	})
+}
+
+// WithSendBuffer sets the socket send buffer (SO_SNDBUF) of the connections
+// to size bytes, e.g. so that bursts of UDP or unixgram messages aren't
+// silently dropped by the kernel once the default buffer is full. The kernel
+// may adjust the size, Linux doubles it and caps it to net.core.wmem_max.
+// Failing to set it is reported to the error logger only.
+func WithSendBuffer(size int) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.sendBuf = size
+	})
+}
+
+// WithMaxConnAge makes the syncer close and re-dial connections older than d,
+// so that connections through a load balancer spread across its backends.
+func WithMaxConnAge(d time.Duration) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.maxAge = d
+	})
+}
+
+// WithMaxConnMessages makes the syncer close and re-dial connections once n
+// messages were written on them. For UDP, this rebinds the socket to a new
+// source port, so that a producer doesn't stay pinned to one collector behind
+// a load balancer or anycast address hashing flows by their 5-tuple. Combine
+// it with WithMaxConnAge to also rebind periodically.
+func WithMaxConnMessages(n int) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.maxMsgs = n
+	})
+}
+
+// WithIPv6Zone sets the zone, an interface name or index, of the IPv6
+// address raddr, as required to reach link-local collectors, e.g. "eth0" for
+// fe80::1. It's kept for reconnections. NewConnSyncer fails if raddr isn't an
+// IPv6 address or already has another zone.
+func WithIPv6Zone(zone string) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.zone = zone
+	})
+}
+
+// A Dialer connects to raddr on network, e.g. over a transport the syncer
+// doesn't implement itself.
+type Dialer func(network, raddr string) (net.Conn, error)
+
+// WithDialer makes the syncer connect with dial, for the first connection and
+// the reconnections. TLS settings and the PROXY protocol don't apply to the
+// connections it returns.
+func WithDialer(dial Dialer) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.dialer = dial
+	})
+}
+
+// WithErrorLogger reports the syncer's own problems, failed reconnections and
+// dropped messages, to l, e.g. a sampled stderr console logger. l must not
+// write to the syncer.
+func WithErrorLogger(l *zap.Logger) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.errLog = l
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build cgo
+// +build cgo
+
+package zapsyslog
+
+/*
+#include <os/log.h>
+#include <stdlib.h>
+
+static void zapsyslog_os_log(os_log_t log, os_log_type_t type, const char *msg) {
+	os_log_with_type(log, type, "%{public}s", msg);
+}
+*/
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// osLogHandles caches os_log_t handles by subsystem and category, handles
+// are never released as recommended by os_log_create(3).
+var osLogHandles sync.Map
+
+type osLogKey struct {
+	subsystem string
+	category  string
+}
+
+func osLogHandle(subsystem, category string) C.os_log_t {
+	key := osLogKey{subsystem, category}
+	if h, ok := osLogHandles.Load(key); ok {
+		return h.(C.os_log_t)
+	}
+
+	cSubsystem := C.CString(subsystem)
+	defer C.free(unsafe.Pointer(cSubsystem))
+	cCategory := C.CString(category)
+	defer C.free(unsafe.Pointer(cCategory))
+
+	h, _ := osLogHandles.LoadOrStore(key, C.os_log_create(cSubsystem, cCategory))
+	return h.(C.os_log_t)
+}
+
+func levelToOSLogType(l zapcore.Level) C.os_log_type_t {
+	switch l {
+	case zapcore.DebugLevel:
+		return C.OS_LOG_TYPE_DEBUG
+	case zapcore.InfoLevel:
+		return C.OS_LOG_TYPE_INFO
+	case zapcore.WarnLevel:
+		return C.OS_LOG_TYPE_DEFAULT
+	case zapcore.ErrorLevel:
+		return C.OS_LOG_TYPE_ERROR
+	}
+	return C.OS_LOG_TYPE_FAULT
+}
+
+type osLogCore struct {
+	zapcore.LevelEnabler
+	subsystem string
+	enc       zapcore.Encoder
+}
+
+// NewOSLogCore creates a core forwarding entries to the macOS unified logging
+// system, so that no local syslogd is needed. Entries are logged in the given
+// subsystem (e.g. "com.example.agent") with the logger name as category, enc
+// formats the message, e.g. a zapcore.NewJSONEncoder.
+func NewOSLogCore(subsystem string, enc zapcore.Encoder, enab zapcore.LevelEnabler) zapcore.Core {
+	return &osLogCore{
+		LevelEnabler: enab,
+		subsystem:    subsystem,
+		enc:          enc,
+	}
+}
+
+func (c *osLogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *osLogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *osLogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	msg := C.CString(buf.String())
+	defer C.free(unsafe.Pointer(msg))
+	C.zapsyslog_os_log(osLogHandle(c.subsystem, ent.LoggerName), levelToOSLogType(ent.Level), msg)
+	return nil
+}
+
+func (c *osLogCore) Sync() error {
+	return nil
+}
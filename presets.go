@@ -0,0 +1,227 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewRsyslogEncoderConfig returns a config whose MSG is parseable by rsyslog's
+// mmjsonparse out of the box: the JSON body starts with the "@cee:" cookie
+// and no BOM, and the standard keys are flat. Keys are written once, the last
+// field wins as it would in mmjsonparse. The timestamp is left to the header.
+func NewRsyslogEncoderConfig() SyslogEncoderConfig {
+	return SyslogEncoderConfig{
+		EncoderConfig: zapcore.EncoderConfig{
+			LevelKey:       "level",
+			NameKey:        "logger",
+			CallerKey:      "caller",
+			MessageKey:     "msg",
+			StacktraceKey:  "stacktrace",
+			EncodeLevel:    zapcore.LowercaseLevelEncoder,
+			EncodeTime:     zapcore.ISO8601TimeEncoder,
+			EncodeDuration: zapcore.SecondsDurationEncoder,
+			EncodeCaller:   zapcore.ShortCallerEncoder,
+		},
+
+		Facility:      syslog.LOG_USER,
+		CEECookie:     true,
+		DuplicateKeys: KeepLastKey,
+	}
+}
+
+// NewSplunkEncoderConfig returns a config following Splunk CIM naming: the
+// header values are repeated as host, source and sourcetype, and the level
+// as severity. The standard keys are plain lowercase words, and field keys
+// are sanitized: Splunk reads dots as nested fields and replaces the other
+// characters that aren't letters, digits or underscores at search time.
+func NewSplunkEncoderConfig(sourcetype string) SyslogEncoderConfig {
+	return SyslogEncoderConfig{
+		EncoderConfig: zapcore.EncoderConfig{
+			LevelKey:       "severity",
+			NameKey:        "logger",
+			CallerKey:      "caller",
+			MessageKey:     "message",
+			StacktraceKey:  "stacktrace",
+			EncodeLevel:    zapcore.LowercaseLevelEncoder,
+			EncodeTime:     zapcore.ISO8601TimeEncoder,
+			EncodeDuration: zapcore.SecondsDurationEncoder,
+			EncodeCaller:   zapcore.ShortCallerEncoder,
+		},
+
+		Facility:     syslog.LOG_USER,
+		HostnameKey:  "host",
+		AppKey:       "source",
+		SanitizeKeys: true,
+		InitialFields: map[string]interface{}{
+			"sourcetype": sourcetype,
+		},
+	}
+}
+
+// ecsVersion is the version of the Elastic Common Schema NewECSEncoderConfig follows.
+const ecsVersion = "1.6.0"
+
+// NewECSEncoderConfig returns a config emitting Elastic Common Schema field
+// names (log.level, message, host.name, process.pid, error.stack_trace...),
+// so that the output is ingestible by Elastic/Filebeat syslog inputs without
+// ingest pipelines.
+func NewECSEncoderConfig() SyslogEncoderConfig {
+	return SyslogEncoderConfig{
+		EncoderConfig: zapcore.EncoderConfig{
+			TimeKey:        "@timestamp",
+			LevelKey:       "log.level",
+			NameKey:        "log.logger",
+			CallerKey:      "log.origin.file.name",
+			MessageKey:     "message",
+			StacktraceKey:  "error.stack_trace",
+			EncodeLevel:    zapcore.LowercaseLevelEncoder,
+			EncodeTime:     zapcore.ISO8601TimeEncoder,
+			EncodeDuration: zapcore.NanosDurationEncoder,
+			EncodeCaller:   ecsCallerEncoder,
+		},
+
+		Facility:    syslog.LOG_USER,
+		HostnameKey: "host.name",
+		AppKey:      "service.name",
+		PIDKey:      "process.pid",
+		InitialFields: map[string]interface{}{
+			"ecs.version": ecsVersion,
+		},
+	}
+}
+
+// ecsCallerEncoder encodes the caller file only, as log.origin.file.name
+// doesn't include the line.
+func ecsCallerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendString(trimCallerPath(caller.File))
+}
+
+// papertrailMaxMessageSize is the largest message Papertrail accepts over TCP/TLS.
+const papertrailMaxMessageSize = 100000
+
+// NewPapertrailSyncer returns a syncer for a Papertrail log destination, e.g.
+// NewPapertrailSyncer("logs.papertrailapp.com", 12345): TLS 1.2+ verified
+// against the system roots, with oversized messages rejected locally instead
+// of being truncated by Papertrail. Use it with NewPapertrailEncoderConfig.
+func NewPapertrailSyncer(host string, port int, opts ...SyncerOption) (*ConnSyncer, error) {
+	opts = append([]SyncerOption{
+		WithTLSConfig(&tls.Config{
+			ServerName: host,
+			MinVersion: tls.VersionTLS12,
+		}),
+		WithMaxMessageSize(papertrailMaxMessageSize),
+	}, opts...)
+	return NewConnSyncer("tcp", net.JoinHostPort(host, strconv.Itoa(port)), opts...)
+}
+
+// NewPapertrailEncoderConfig returns a config suited to NewPapertrailSyncer,
+// Papertrail frames TCP messages by line feeds.
+func NewPapertrailEncoderConfig() SyslogEncoderConfig {
+	cfg := NewRsyslogEncoderConfig()
+	cfg.CEECookie = false
+	cfg.Framing = NonTransparentFraming
+	return cfg
+}
+
+// NewAuditEncoderConfig returns a config for security audit trails: messages
+// go to LOG_AUTHPRIV and carry a sequenceId, so that collectors can detect
+// losses, and are signed with key unless it's nil, see IntegrityKey. The
+// RFC5424 options are left strict: the JSON body follows a BOM, HOSTNAME and
+// APP-NAME are restricted to printable ASCII. Use it with NewAuditSyncer.
+func NewAuditEncoderConfig(key []byte) SyslogEncoderConfig {
+	cfg := NewRsyslogEncoderConfig()
+	cfg.CEECookie = false
+	cfg.Facility = syslog.LOG_AUTHPRIV
+	cfg.HostnameNormalization = StrictHostname
+	cfg.AppNameTruncation = KeepAppNameHead
+	cfg.SequenceIDs = true
+	cfg.IntegrityKey = key
+	return cfg
+}
+
+// NewAuditSyncer returns a RELP syncer for audit trails, connected over TLS
+// with tlsConfig, whose Write only returns once the collector acknowledged
+// the message, see WithSynchronousAcks.
+func NewAuditSyncer(raddr string, tlsConfig *tls.Config, opts ...RELPOption) (*RELPSyncer, error) {
+	opts = append([]RELPOption{
+		WithRELPTLSConfig(tlsConfig),
+		WithSynchronousAcks(),
+	}, opts...)
+	return NewRELPSyncer("tcp", raddr, opts...)
+}
+
+// newPresetCore returns a core sending entries at or above level over TCP to
+// addr, as JSON with zap's production keys, framed by octet counting.
+func newPresetCore(addr string, level zapcore.Level) (zapcore.Core, error) {
+	sink, err := NewConnSyncer("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	enc := NewSyslogEncoder(SyslogEncoderConfig{
+		EncoderConfig: zap.NewProductionEncoderConfig(),
+		Framing:       OctetCountingFraming,
+		Facility:      syslog.LOG_USER,
+		App:           filepath.Base(os.Args[0]),
+	})
+	return zapcore.NewCore(enc, sink, level), nil
+}
+
+// NewProduction builds a logger like zap.NewProduction, sending entries at
+// InfoLevel and above to the syslog server at addr over TCP, to the user
+// facility. Entries are sampled as by zap.NewProduction, stacktraces are
+// added at ErrorLevel and above.
+func NewProduction(addr string, options ...zap.Option) (*zap.Logger, error) {
+	core, err := newPresetCore(addr, zapcore.InfoLevel)
+	if err != nil {
+		return nil, err
+	}
+	core = zapcore.NewSamplerWithOptions(core, time.Second, 100, 100)
+	options = append([]zap.Option{zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)}, options...)
+	return zap.New(core, options...), nil
+}
+
+// NewDevelopment builds a logger like zap.NewDevelopment, sending entries at
+// DebugLevel and above both to the syslog server at addr, as NewProduction
+// does, and to stderr in a human-friendly format. Entries aren't sampled,
+// stacktraces are added at WarnLevel and above and DPanic panics.
+func NewDevelopment(addr string, options ...zap.Option) (*zap.Logger, error) {
+	core, err := newPresetCore(addr, zapcore.DebugLevel)
+	if err != nil {
+		return nil, err
+	}
+	console := zapcore.NewCore(
+		zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()),
+		zapcore.Lock(os.Stderr),
+		zapcore.DebugLevel,
+	)
+	options = append([]zap.Option{zap.Development(), zap.AddCaller(), zap.AddStacktrace(zapcore.WarnLevel)}, options...)
+	return zap.New(zapcore.NewTee(core, console), options...), nil
+}
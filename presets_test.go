@@ -0,0 +1,250 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRsyslogEncoderConfig(t *testing.T) {
+	for _, framing := range []Framing{NonTransparentFraming, OctetCountingFraming} {
+		cfg := NewRsyslogEncoderConfig()
+		cfg.Framing = framing
+		cfg.Hostname = "localhost"
+		cfg.App = "rsyslog_test"
+		cfg.PID = 9876
+		enc := NewSyslogEncoder(cfg)
+		enc.AddString("str", "foo")
+
+		ent := testEntry
+		ent.LoggerName = "main"
+		ent.Caller = zapcore.NewEntryCaller(0, "bar/baz.go", 42, true)
+		buf, err := enc.EncodeEntry(ent, []zapcore.Field{zap.Int("int", 1)})
+		require.NoError(t, err)
+
+		const msg = "<15>1 2017-01-02T03:04:05.123456Z localhost rsyslog_test 9876 - - " +
+			`@cee:{"level":"debug","logger":"main","caller":"bar/baz.go:42","msg":"fake","str":"foo","int":1}`
+		if framing == OctetCountingFraming {
+			assert.Equal(t, strconv.Itoa(len(msg))+" "+msg, buf.String())
+		} else {
+			assert.Equal(t, msg+"\n", buf.String())
+		}
+		buf.Free()
+	}
+}
+
+func TestRsyslogEncoderConfigDuplicateKeys(t *testing.T) {
+	cfg := NewRsyslogEncoderConfig()
+	cfg.Hostname = "localhost"
+	cfg.App = "rsyslog_test"
+	enc := NewSyslogEncoder(cfg)
+
+	buf, err := enc.EncodeEntry(testEntry, []zapcore.Field{zap.String("level", "custom")})
+	require.NoError(t, err)
+	defer buf.Free()
+
+	msg := buf.String()
+	i := strings.Index(msg, "@cee:")
+	require.True(t, i > 0, "Unexpected output: %q", msg)
+	assert.Contains(t, msg, `{"msg":"fake","level":"custom"}`, "The last value should win, as with mmjsonparse.")
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(msg[i+len("@cee:"):]), &m))
+	assert.Equal(t, "custom", m["level"])
+}
+
+func TestSplunkEncoderConfig(t *testing.T) {
+	cfg := NewSplunkEncoderConfig("myapp:json")
+	cfg.Hostname = "localhost"
+	cfg.App = "splunk_test"
+	enc := NewSyslogEncoder(cfg)
+
+	ent := testEntry
+	ent.Level = zap.WarnLevel
+	buf, err := enc.EncodeEntry(ent, []zapcore.Field{zap.Int("http.status code", 200)})
+	require.NoError(t, err)
+	defer buf.Free()
+
+	msg := buf.String()
+	i := strings.Index(msg, "{")
+	require.True(t, i > 0, "Unexpected output: %q", msg)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(msg[i:]), &m))
+	assert.Equal(t, map[string]interface{}{
+		"severity":         "warn",
+		"message":          "fake",
+		"host":             "localhost",
+		"source":           "splunk_test",
+		"sourcetype":       "myapp:json",
+		"http_status_code": float64(200),
+	}, m)
+}
+
+func TestECSEncoderConfig(t *testing.T) {
+	cfg := NewECSEncoderConfig()
+	cfg.Hostname = "localhost"
+	cfg.App = "ecs_test"
+	cfg.PID = 9876
+	enc := NewSyslogEncoder(cfg)
+
+	ent := testEntry
+	ent.Level = zap.ErrorLevel
+	ent.LoggerName = "main"
+	ent.Caller = zapcore.NewEntryCaller(0, "/src/bar/baz.go", 42, true)
+	ent.Stack = "goroutine 1"
+	buf, err := enc.EncodeEntry(ent, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+
+	msg := buf.String()
+	i := strings.Index(msg, "{")
+	require.True(t, i > 0, "Unexpected output: %q", msg)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(msg[i:]), &m))
+	assert.Equal(t, map[string]interface{}{
+		"@timestamp":           "2017-01-02T03:04:05.123Z",
+		"log.level":            "error",
+		"log.logger":           "main",
+		"log.origin.file.name": "bar/baz.go",
+		"message":              "fake",
+		"error.stack_trace":    "goroutine 1",
+		"host.name":            "localhost",
+		"service.name":         "ecs_test",
+		"process.pid":          float64(9876),
+		"ecs.version":          ecsVersion,
+	}, m)
+}
+
+func TestPapertrailSyncer(t *testing.T) {
+	cert, ca := generateTestCert()
+	done := make(chan string, 1)
+	addr, sock, srvWG := startTLSServer(&tls.Config{Certificates: []tls.Certificate{cert}}, done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+	s, err := NewPapertrailSyncer(host, p, WithTLSConfig(&tls.Config{
+		RootCAs:    testClientTLSConfig(ca).RootCAs,
+		ServerName: host,
+	}))
+	require.NoError(t, err)
+	defer s.closeConn()
+
+	enc := NewSyslogEncoder(NewPapertrailEncoderConfig())
+	buf, err := enc.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+
+	_, err = s.Write(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, buf.String(), <-done)
+
+	_, err = s.Write(make([]byte, papertrailMaxMessageSize+1))
+	assert.True(t, errors.Is(err, ErrMessageTooLarge), "Unexpected error: %v", err)
+}
+
+func TestAuditPreset(t *testing.T) {
+	cert, ca := generateTestCert()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	srv := serveRELP(t, l)
+
+	s, err := NewAuditSyncer(l.Addr().String(), testClientTLSConfig(ca))
+	require.NoError(t, err)
+	defer s.Close()
+
+	key := []byte("secret")
+	enc := NewSyslogEncoder(NewAuditEncoderConfig(key))
+	for i := 1; i <= 2; i++ {
+		buf, err := enc.EncodeEntry(testEntry, nil)
+		require.NoError(t, err)
+		_, err = s.Write(buf.Bytes())
+		buf.Free()
+		require.NoError(t, err)
+
+		received := srv.messages()
+		require.Len(t, received, i, "Write should return once acknowledged.")
+		m, err := syslog.ParseMessage([]byte(received[i-1]))
+		require.NoError(t, err)
+		assert.Equal(t, syslog.LOG_AUTHPRIV, m.Facility())
+		assert.True(t, m.BOM)
+		require.Len(t, m.StructuredData, 2)
+		assert.Equal(t, syslog.SDElement{ID: "meta", Params: []syslog.SDParam{{Name: "sequenceId", Value: strconv.Itoa(i)}}}, m.StructuredData[0])
+		assert.Equal(t, defaultIntegritySDID, m.StructuredData[1].ID)
+		assert.True(t, verifySignature(t, []byte(received[i-1]), defaultIntegritySDID, key))
+	}
+}
+
+func TestProductionAndDevelopment(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	done := make(chan string, 2)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				scanner := bufio.NewScanner(c)
+				scanner.Split(syslog.ScanFrames)
+				for scanner.Scan() {
+					done <- scanner.Text()
+				}
+			}()
+		}
+	}()
+	addr := l.Addr().String()
+
+	prod, err := NewProduction(addr)
+	require.NoError(t, err)
+	prod.Debug("disabled")
+	prod.Info("hello", zap.Int("int", 1))
+	msg := <-done
+	assert.True(t, strings.HasPrefix(msg, "<14>1 "), "Unexpected message: %q", msg)
+	assert.Contains(t, msg, `"msg":"hello","int":1}`)
+	assert.Contains(t, msg, `/presets_test.go:`)
+
+	dev, err := NewDevelopment(addr, zap.Fields(zap.String("env", "dev")))
+	require.NoError(t, err)
+	dev.Debug("debug")
+	msg = <-done
+	assert.True(t, strings.HasPrefix(msg, "<15>1 "), "Unexpected message: %q", msg)
+	assert.Contains(t, msg, `"msg":"debug","env":"dev"}`)
+}
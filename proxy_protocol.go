@@ -0,0 +1,100 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+)
+
+// proxySignature starts PROXY protocol v2 headers.
+const proxySignature = "\r\n\r\n\x00\r\nQUIT\n"
+
+// WithProxyProtocol makes the syncer send a PROXY protocol v2 header on
+// each new TCP connection, before the TLS handshake if any, carrying the
+// local and remote addresses, so that a load balancer such as HAProxy
+// passes the client's identity on to the collector.
+func WithProxyProtocol() SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.proxyProtocol = true
+	})
+}
+
+// proxyHeader returns the PROXY protocol v2 header of a connection from
+// local to remote, with the LOCAL command unless both are TCP addresses.
+func proxyHeader(local, remote net.Addr) []byte {
+	b := []byte(proxySignature)
+	src, srcOK := local.(*net.TCPAddr)
+	dst, dstOK := remote.(*net.TCPAddr)
+	if !srcOK || !dstOK {
+		// LOCAL, AF_UNSPEC, no addresses
+		return append(b, 0x20, 0x00, 0x00, 0x00)
+	}
+
+	// PROXY, then TCP over IPv4 or IPv6
+	b = append(b, 0x21)
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP != nil && dstIP != nil {
+		b = append(b, 0x11, 0x00, 12)
+	} else {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+		b = append(b, 0x21, 0x00, 36)
+	}
+	b = append(b, srcIP...)
+	b = append(b, dstIP...)
+	b = binary.BigEndian.AppendUint16(b, uint16(src.Port))
+	return binary.BigEndian.AppendUint16(b, uint16(dst.Port))
+}
+
+// dialProxy connects to raddr, sends the PROXY header and then makes the
+// TLS handshake if s has a TLS config.
+func (s *ConnSyncer) dialProxy() (net.Conn, error) {
+	c, err := net.Dial(s.network, s.raddr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.Write(proxyHeader(c.LocalAddr(), c.RemoteAddr())); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if s.tlsConfig == nil {
+		return c, nil
+	}
+
+	cfg := s.tlsConfig
+	if cfg.ServerName == "" {
+		// As tls.Dial does
+		host, _, err := net.SplitHostPort(s.raddr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+	tc := tls.Client(c, cfg)
+	if err := tc.Handshake(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return tc, nil
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestProxyHeader(t *testing.T) {
+	tests := []struct {
+		local, remote net.Addr
+		expected      string
+	}{
+		{
+			&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000},
+			&net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 6514},
+			"0d0a0d0a000d0a515549540a" + "21" + "11" + "000c" + "c0000201" + "c6336402" + "c350" + "1972",
+		},
+		{
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 50000},
+			&net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 514},
+			"0d0a0d0a000d0a515549540a" + "21" + "21" + "0024" +
+				"20010db8000000000000000000000001" + "00000000000000000000ffffc6336402" + "c350" + "0202",
+		},
+		{
+			&net.UnixAddr{Name: "@", Net: "unix"},
+			&net.UnixAddr{Name: "/dev/log", Net: "unix"},
+			"0d0a0d0a000d0a515549540a" + "20" + "00" + "0000",
+		},
+	}
+	for _, tt := range tests {
+		if actual := hex.EncodeToString(proxyHeader(tt.local, tt.remote)); actual != tt.expected {
+			t.Errorf("proxyHeader(%v, %v) = %s, expected %s", tt.local, tt.remote, actual, tt.expected)
+		}
+	}
+}
+
+func TestProxyProtocol(t *testing.T) {
+	cert, ca := generateTestCert()
+	for _, useTLS := range []bool{false, true} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen() failed: %v", err)
+		}
+		type result struct {
+			header []byte
+			client net.Addr
+			line   string
+			err    error
+		}
+		results := make(chan result, 1)
+		go func() {
+			c, err := l.Accept()
+			if err != nil {
+				results <- result{err: err}
+				return
+			}
+			defer c.Close()
+			r := result{header: make([]byte, 16+12), client: c.RemoteAddr()}
+			if _, r.err = io.ReadFull(c, r.header); r.err != nil {
+				results <- r
+				return
+			}
+			var conn net.Conn = c
+			if useTLS {
+				conn = tls.Server(c, &tls.Config{Certificates: []tls.Certificate{cert}})
+			}
+			r.line, r.err = bufio.NewReader(conn).ReadString('\n')
+			results <- r
+		}()
+
+		opts := []SyncerOption{WithProxyProtocol()}
+		if useTLS {
+			opts = append(opts, WithTLSConfig(testClientTLSConfig(ca)))
+		}
+		s, err := NewConnSyncer("tcp", l.Addr().String(), opts...)
+		if err != nil {
+			t.Fatalf("NewConnSyncer() failed: %v", err)
+		}
+		msg := testMessage + "\n"
+		if _, err := io.WriteString(s, msg); err != nil {
+			t.Fatalf("WriteString() failed: %v", err)
+		}
+
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("reading the connection failed: %v", r.err)
+		}
+		if expected := proxyHeader(r.client, l.Addr()); string(r.header) != string(expected) {
+			t.Errorf("TLS %t: expected header %x, actual %x", useTLS, expected, r.header)
+		}
+		if r.line != msg {
+			t.Errorf("TLS %t: message didn't match: expected=%q, actual=%q", useTLS, msg, r.line)
+		}
+		s.Close()
+		l.Close()
+	}
+}
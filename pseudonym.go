@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// pseudonymLen is the number of HMAC-SHA256 bytes kept in pseudonyms.
+const pseudonymLen = 16
+
+// redactedValue replaces the values to pseudonymize when there's no key: an
+// unkeyed hash could be reversed by a dictionary lookup.
+const redactedValue = `"redacted"`
+
+// pseudonymizer replaces the values of JSON body members with a keyed hash
+// of their JSON encoding, at any depth.
+type pseudonymizer struct {
+	key  []byte
+	keys map[string]struct{}
+}
+
+func newPseudonymizer(key []byte, keys []string) *pseudonymizer {
+	if len(keys) == 0 {
+		return nil
+	}
+	p := &pseudonymizer{key: key, keys: make(map[string]struct{}, len(keys))}
+	for _, k := range keys {
+		p.keys[k] = struct{}{}
+	}
+	return p
+}
+
+// appendPseudonym appends the truncated HMAC-SHA256 of value, hex encoded, as
+// a JSON string, or redactedValue without a key.
+func (p *pseudonymizer) appendPseudonym(out, value []byte) []byte {
+	if len(p.key) == 0 {
+		return append(out, redactedValue...)
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(value)
+	out = append(out, '"')
+	out = append(out, hex.EncodeToString(mac.Sum(nil)[:pseudonymLen])...)
+	return append(out, '"')
+}
+
+// apply rewrites the JSON object b, as encoded by zap, including the objects
+// nested in it and in arrays. It fails closed: b is replaced with an empty
+// object if it can't be parsed.
+func (p *pseudonymizer) apply(b []byte) []byte {
+	out, ok := p.appendObject(make([]byte, 0, len(b)+pseudonymLen*2), b)
+	if !ok {
+		out = append(out[:0], "{}"...)
+		if bytes.HasSuffix(b, []byte("\n")) {
+			out = append(out, '\n')
+		}
+	}
+	return out
+}
+
+// appendObject appends the JSON object b, and what follows it, to out with
+// the configured values pseudonymized.
+func (p *pseudonymizer) appendObject(out, b []byte) ([]byte, bool) {
+	members, rest, ok := splitJSONObject(b)
+	if !ok {
+		return out, false
+	}
+	out = append(out, '{')
+	for i, m := range members {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, m.key...)
+		out = append(out, ':')
+		if _, found := p.keys[string(m.key[1:len(m.key)-1])]; found {
+			out = p.appendPseudonym(out, m.value)
+		} else if out, ok = p.appendValue(out, m.value); !ok {
+			return out, false
+		}
+	}
+	out = append(out, '}')
+	return append(out, rest...), true
+}
+
+// appendValue appends the JSON value b to out, looking into objects and
+// arrays.
+func (p *pseudonymizer) appendValue(out, b []byte) ([]byte, bool) {
+	if len(b) == 0 {
+		return out, false
+	}
+	switch b[0] {
+	case '{':
+		return p.appendObject(out, b)
+	case '[':
+		out = append(out, '[')
+		for i := 1; i < len(b)-1; {
+			if b[i] == ',' {
+				out = append(out, ',')
+				i++
+			}
+			end := skipJSONValue(b, i)
+			if end < 0 || end > len(b)-1 {
+				return out, false
+			}
+			var ok bool
+			if out, ok = p.appendValue(out, b[i:end]); !ok {
+				return out, false
+			}
+			i = end
+		}
+		return append(out, ']'), true
+	}
+	return append(out, b...), true
+}
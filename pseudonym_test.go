@@ -0,0 +1,103 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSyslogEncoderPseudonymizedKeys(t *testing.T) {
+	pseudonym := func(key, value string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	}
+
+	cfg := testEncoderConfig(NonTransparentFraming)
+	cfg.PseudonymizedKeys = []string{"user", "ip"}
+	cfg.PseudonymKey = []byte("secret")
+	enc := NewSyslogEncoder(cfg)
+	enc.AddString("user", "alice")
+
+	buf, err := enc.EncodeEntry(testEntry, []zapcore.Field{
+		zap.String("ip", "192.0.2.1"),
+		zap.Int("port", 514),
+		zap.Object("nested", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			enc.AddString("user", "bob")
+			return nil
+		})),
+	})
+	require.NoError(t, err)
+	out := buf.String()
+	buf.Free()
+	assert.Contains(t, out, `"user":"`+pseudonym("secret", `"alice"`)+`"`)
+	assert.Contains(t, out, `"ip":"`+pseudonym("secret", `"192.0.2.1"`)+`"`)
+	assert.Contains(t, out, `"port":514,"nested":{"user":"`+pseudonym("secret", `"bob"`)+`"}}`)
+	assert.NotContains(t, out, "alice")
+	assert.NotContains(t, out, "bob")
+	assert.NotContains(t, out, "192.0.2.1")
+
+	// The same value gives the same pseudonym across entries
+	buf, err = enc.EncodeEntry(testEntry, []zapcore.Field{zap.String("ip", "192.0.2.1")})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `"ip":"`+pseudonym("secret", `"192.0.2.1"`)+`"`)
+	buf.Free()
+}
+
+func TestPseudonymizerNested(t *testing.T) {
+	p := newPseudonymizer([]byte("secret"), []string{"user"})
+	plain := newPseudonymizer(nil, []string{"user"})
+	for _, in := range []string{
+		`{"a":{"b":{"user":"alice"}}}`,
+		`{"list":[1,{"user":"alice"},[{"user":"alice"}],"x"]}`,
+		`{"ns":{"user":"alice","n":1},"user":"alice"}` + "\n",
+	} {
+		out := string(p.apply([]byte(in)))
+		assert.NotContains(t, out, "alice", in)
+		assert.Equal(t, strings.Count(in, "alice"), strings.Count(out, `"user":"`), in)
+
+		out = string(plain.apply([]byte(in)))
+		assert.NotContains(t, out, "alice", "Values should be redacted without a key: %s", in)
+		assert.Contains(t, out, `"user":"redacted"`)
+		assert.Equal(t, strings.HasSuffix(in, "\n"), strings.HasSuffix(out, "\n"))
+	}
+	assert.Equal(t, `{"list":[],"n":[1,2]}`, string(p.apply([]byte(`{"list":[],"n":[1,2]}`))))
+	assert.Equal(t, "{}\n", string(p.apply([]byte(`{"user":"alice"`+"\n"))), "Unparsable bodies should be dropped.")
+}
+
+func TestSyslogEncoderPseudonymizedKeysWithoutKey(t *testing.T) {
+	cfg := testEncoderConfig(NonTransparentFraming)
+	cfg.PseudonymizedKeys = []string{"user"}
+	buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, []zapcore.Field{zap.String("user", "alice")})
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.Contains(t, buf.String(), `"user":"redacted"`)
+	assert.NotContains(t, buf.String(), "alice")
+}
@@ -0,0 +1,414 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultRELPWindow     = 128
+	defaultRELPAckTimeout = 30 * time.Second
+	maxRELPTxnr           = 999999999
+	relpOffers            = "relp_version=0\nrelp_software=zap-syslog\ncommands=syslog"
+)
+
+var (
+	_ zapcore.WriteSyncer = &RELPSyncer{}
+
+	errRELPServerClose = errors.New("relp: server closed the session")
+)
+
+// A RELPOption configures a RELPSyncer.
+type RELPOption interface {
+	apply(*RELPSyncer)
+}
+
+// relpOptionFunc wraps a func so it satisfies the RELPOption interface.
+type relpOptionFunc func(*RELPSyncer)
+
+func (f relpOptionFunc) apply(s *RELPSyncer) {
+	f(s)
+}
+
+// WithSynchronousAcks makes each Write wait for the server to acknowledge
+// the message, so that a nil error means the message was received.
+func WithSynchronousAcks() RELPOption {
+	return relpOptionFunc(func(s *RELPSyncer) {
+		s.syncAcks = true
+	})
+}
+
+// WithRELPWindow sets how many messages may await their acknowledgement
+// before writes block, the default is 128.
+func WithRELPWindow(n int) RELPOption {
+	return relpOptionFunc(func(s *RELPSyncer) {
+		if n > 0 {
+			s.window = n
+		}
+	})
+}
+
+// WithRELPAckTimeout sets how long to wait for acknowledgements before
+// giving up on the connection, the default is 30s.
+func WithRELPAckTimeout(d time.Duration) RELPOption {
+	return relpOptionFunc(func(s *RELPSyncer) {
+		s.ackTimeout = d
+	})
+}
+
+// WithRELPTLSConfig makes the syncer connect over TLS with the given config.
+func WithRELPTLSConfig(cfg *tls.Config) RELPOption {
+	return relpOptionFunc(func(s *RELPSyncer) {
+		s.tlsConfig = cfg
+	})
+}
+
+// RELPSyncer sends messages with RELP, the Reliable Event Logging Protocol
+// of rsyslog's imrelp, where the server acknowledges every message.
+// Messages not acknowledged when the connection breaks are sent again after
+// reconnecting, so they may be received twice but aren't lost.
+//
+// By default Write returns once the message is sent and Sync waits for all
+// the acknowledgements, WithSynchronousAcks makes Write wait as well. A
+// message refused by the server fails the Write or Sync that reads the
+// refusal with ErrDropped. Messages are expected without framing, the LF
+// of NonTransparentFraming is stripped. It's safe for concurrent use.
+type RELPSyncer struct {
+	mu         sync.Mutex
+	network    string
+	raddr      string
+	tlsConfig  *tls.Config
+	syncAcks   bool
+	window     int
+	ackTimeout time.Duration
+
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	txnr int
+
+	// pending holds the messages not acknowledged yet in sending order,
+	// those with a zero txnr are still to be sent.
+	pending []relpTxn
+	closed  bool
+}
+
+type relpTxn struct {
+	txnr int
+	msg  []byte
+}
+
+// NewRELPSyncer returns a syncer connected to the RELP server at raddr.
+func NewRELPSyncer(network, raddr string, opts ...RELPOption) (*RELPSyncer, error) {
+	s := &RELPSyncer{
+		network:    network,
+		raddr:      raddr,
+		window:     defaultRELPWindow,
+		ackTimeout: defaultRELPAckTimeout,
+	}
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect opens a RELP session, pending messages are sent again.
+func (s *RELPSyncer) connect() error {
+	s.closeConn()
+
+	var (
+		c   net.Conn
+		err error
+	)
+	if s.tlsConfig != nil {
+		c, err = tls.DialWithDialer(&net.Dialer{}, s.network, s.raddr, s.tlsConfig)
+	} else {
+		c, err = net.Dial(s.network, s.raddr)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = c
+	s.r = bufio.NewReader(c)
+	s.w = bufio.NewWriter(c)
+	s.txnr = 0
+
+	txnr := s.send("open", []byte(relpOffers))
+	if err := s.w.Flush(); err != nil {
+		s.closeConn()
+		return err
+	}
+	if err := s.readResponse(txnr); err != nil {
+		s.closeConn()
+		return err
+	}
+	for i := range s.pending {
+		s.pending[i].txnr = 0
+	}
+	return nil
+}
+
+func (s *RELPSyncer) closeConn() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// send buffers a RELP frame and returns its transaction number.
+func (s *RELPSyncer) send(command string, data []byte) int {
+	s.txnr++
+	if s.txnr > maxRELPTxnr {
+		s.txnr = 1
+	}
+	s.w.WriteString(strconv.Itoa(s.txnr))
+	s.w.WriteByte(' ')
+	s.w.WriteString(command)
+	s.w.WriteByte(' ')
+	s.w.WriteString(strconv.Itoa(len(data)))
+	if len(data) > 0 {
+		s.w.WriteByte(' ')
+		s.w.Write(data)
+	}
+	s.w.WriteByte('\n')
+	return s.txnr
+}
+
+// readResponse reads the response to txnr, failing if it's not a success.
+func (s *RELPSyncer) readResponse(txnr int) error {
+	s.conn.SetReadDeadline(time.Now().Add(s.ackTimeout))
+	got, command, data, err := readRELPFrame(s.r)
+	if err != nil {
+		return err
+	}
+	if command == "serverclose" {
+		return errRELPServerClose
+	}
+	if command != "rsp" || got != txnr {
+		return fmt.Errorf("relp: unexpected %s for transaction %d", command, got)
+	}
+	return relpStatus(data)
+}
+
+// relpStatusError is the refusal of a transaction by the server.
+type relpStatusError struct {
+	status string
+}
+
+func (e *relpStatusError) Error() string {
+	return "relp: " + e.status
+}
+
+// relpStatus returns the error reported by the data of a rsp frame.
+func relpStatus(data []byte) error {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[:i]
+	}
+	if bytes.HasPrefix(data, []byte("200")) {
+		return nil
+	}
+	return &relpStatusError{status: string(data)}
+}
+
+// deliver sends the pending messages and reads acknowledgements until at
+// most keep messages await theirs. It reconnects once if the connection
+// breaks, the returned error is either a connection error or the refusal
+// of a message by the server.
+func (s *RELPSyncer) deliver(keep int) error {
+	var err error
+	for i := 0; i < 2; i++ {
+		if s.conn == nil {
+			if err = s.connect(); err != nil {
+				return newSyncerError(ErrNotConnected, err)
+			}
+		}
+		var refused error
+		if refused, err = s.flush(keep); err == nil {
+			return refused
+		}
+		s.closeConn()
+		if refused != nil {
+			return refused
+		}
+		err = newSyncerError(ErrDropped, err)
+	}
+	return err
+}
+
+// flush sends the messages not sent yet, then reads acknowledgements until at
+// most keep messages are pending. It returns the last refusal by the server
+// and the connection error.
+func (s *RELPSyncer) flush(keep int) (refused error, err error) {
+	for i := range s.pending {
+		if s.pending[i].txnr == 0 {
+			s.pending[i].txnr = s.send("syslog", s.pending[i].msg)
+		}
+	}
+	if err := s.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	for len(s.pending) > keep {
+		txn := s.pending[0]
+		if err := s.readResponse(txn.txnr); err != nil {
+			var status *relpStatusError
+			if !errors.As(err, &status) {
+				return refused, err
+			}
+			refused = newSyncerError(ErrDropped, err)
+		}
+		s.pending = s.pending[1:]
+	}
+	return refused, nil
+}
+
+// Write sends p to the server, waiting for its acknowledgement when
+// synchronous acknowledgements are enabled.
+//
+// The returned errors match ErrNotConnected or ErrDropped with errors.Is.
+func (s *RELPSyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, newSyncerError(ErrNotConnected, errSyncerClosed)
+	}
+
+	msg := append([]byte(nil), bytes.TrimSuffix(p, []byte{'\n'})...)
+	s.pending = append(s.pending, relpTxn{msg: msg})
+	keep := s.window
+	if s.syncAcks {
+		keep = 0
+	}
+	if err := s.deliver(keep); err != nil {
+		var status *relpStatusError
+		if !errors.As(err, &status) && (s.syncAcks || len(s.pending) > s.window) {
+			// The message won't be retried, the caller knows it failed
+			s.pending = s.pending[:len(s.pending)-1]
+		}
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Sync implements zapcore.WriteSyncer interface, it waits until the server
+// acknowledged all the messages written.
+func (s *RELPSyncer) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) == 0 {
+		return nil
+	}
+	return s.deliver(0)
+}
+
+// Close waits for the pending acknowledgements then closes the session,
+// later writes fail with ErrNotConnected.
+func (s *RELPSyncer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	var err error
+	if len(s.pending) > 0 {
+		err = s.deliver(0)
+	}
+	if s.conn != nil {
+		txnr := s.send("close", nil)
+		if s.w.Flush() == nil {
+			s.readResponse(txnr)
+		}
+		s.closeConn()
+	}
+	s.closed = true
+	return err
+}
+
+// readRELPFrame reads a frame: TXNR SP COMMAND SP DATALEN [SP DATA] LF.
+func readRELPFrame(r *bufio.Reader) (txnr int, command string, data []byte, err error) {
+	field := func() (string, error) {
+		s, err := r.ReadString(' ')
+		if err != nil {
+			return "", err
+		}
+		return s[:len(s)-1], nil
+	}
+
+	s, err := field()
+	if err != nil {
+		return 0, "", nil, err
+	}
+	if txnr, err = strconv.Atoi(s); err != nil {
+		return 0, "", nil, fmt.Errorf("relp: invalid TXNR %q", s)
+	}
+	if command, err = field(); err != nil {
+		return 0, "", nil, err
+	}
+
+	var n int
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, "", nil, err
+		}
+		if c == ' ' || c == '\n' {
+			if c == '\n' {
+				if n != 0 {
+					return 0, "", nil, errors.New("relp: missing DATA")
+				}
+				return txnr, command, nil, nil
+			}
+			break
+		}
+		if c < '0' || c > '9' || n > maxRELPTxnr {
+			return 0, "", nil, errors.New("relp: invalid DATALEN")
+		}
+		n = n*10 + int(c-'0')
+	}
+
+	data = make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, "", nil, err
+	}
+	if c, err := r.ReadByte(); err != nil || c != '\n' {
+		return 0, "", nil, errors.New("relp: missing TRAILER")
+	}
+	return txnr, command, data, nil
+}
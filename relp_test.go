@@ -0,0 +1,164 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relpServer acknowledges the RELP messages it receives, except those in
+// refuse. The connection is dropped without acknowledgement the first time
+// a message in drop is received.
+type relpServer struct {
+	l net.Listener
+
+	mu       sync.Mutex
+	received []string
+	refuse   map[string]bool
+	drop     map[string]bool
+	closes   int
+}
+
+func startRELPServer(t testing.TB) *relpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return serveRELP(t, l)
+}
+
+// serveRELP serves the connections accepted by l until the test ends.
+func serveRELP(t testing.TB, l net.Listener) *relpServer {
+	srv := &relpServer{l: l, refuse: make(map[string]bool), drop: make(map[string]bool)}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(c)
+		}
+	}()
+	return srv
+}
+
+func (srv *relpServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		txnr, command, data, err := readRELPFrame(r)
+		if err != nil {
+			return
+		}
+		rsp := "200 OK"
+		srv.mu.Lock()
+		switch command {
+		case "open":
+			rsp = "200 OK\nrelp_version=0\ncommands=syslog"
+		case "syslog":
+			msg := string(data)
+			srv.received = append(srv.received, msg)
+			if srv.drop[msg] {
+				delete(srv.drop, msg)
+				srv.mu.Unlock()
+				return
+			}
+			if srv.refuse[msg] {
+				rsp = "500 refused"
+			}
+		case "close":
+			srv.closes++
+			rsp = ""
+		}
+		srv.mu.Unlock()
+		fmt.Fprintf(c, "%d rsp %d %s\n", txnr, len(rsp), rsp)
+	}
+}
+
+func (srv *relpServer) messages() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]string(nil), srv.received...)
+}
+
+func TestRELPSyncerSynchronousAcks(t *testing.T) {
+	srv := startRELPServer(t)
+	srv.refuse["bad"] = true
+	s, err := NewRELPSyncer("tcp", srv.l.Addr().String(), WithSynchronousAcks())
+	require.NoError(t, err)
+
+	n, err := s.Write([]byte("first\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, []string{"first"}, srv.messages(), "Write should return once acknowledged.")
+
+	_, err = s.Write([]byte("bad\n"))
+	assert.True(t, errors.Is(err, ErrDropped), "Refused messages should fail the Write.")
+
+	_, err = s.Write([]byte("second\n"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	assert.Equal(t, []string{"first", "bad", "second"}, srv.messages())
+	srv.mu.Lock()
+	assert.Equal(t, 1, srv.closes, "Close should end the session.")
+	srv.mu.Unlock()
+
+	_, err = s.Write([]byte("closed\n"))
+	assert.True(t, errors.Is(err, ErrNotConnected))
+}
+
+func TestRELPSyncerResend(t *testing.T) {
+	srv := startRELPServer(t)
+	srv.drop["second"] = true
+	s, err := NewRELPSyncer("tcp", srv.l.Addr().String())
+	require.NoError(t, err)
+	defer s.Close()
+
+	for _, msg := range []string{"first", "second", "third"} {
+		_, err := s.Write([]byte(msg + "\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.Sync(), "Unacknowledged messages should be sent again after reconnecting.")
+
+	received := srv.messages()
+	assert.Equal(t, []string{"first", "second"}, received[:2])
+	assert.Equal(t, []string{"second", "third"}, received[len(received)-2:])
+}
+
+func TestRELPSyncerRefusalOnSync(t *testing.T) {
+	srv := startRELPServer(t)
+	srv.refuse["bad"] = true
+	s, err := NewRELPSyncer("tcp", srv.l.Addr().String())
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Write([]byte("bad\n"))
+	require.NoError(t, err, "Write should not wait for the acknowledgement.")
+	assert.True(t, errors.Is(s.Sync(), ErrDropped))
+	assert.NoError(t, s.Sync())
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// samplingKey identifies the entries counted together by a SamplingReporter.
+type samplingKey struct {
+	level  zapcore.Level
+	logger string
+}
+
+// SamplingReporter counts the entries dropped by zap's sampler, and
+// periodically writes a warning to a core for each level and logger name
+// whose entries were dropped since the last report, so that operators know
+// the stream is sampled:
+//
+//	r := zapsyslog.NewSamplingReporter(core, time.Minute)
+//	defer r.Close()
+//	logger := zap.New(zapcore.NewSamplerWithOptions(core, time.Second, 100, 100, r.Hook()))
+//
+// It's safe for concurrent use.
+type SamplingReporter struct {
+	core zapcore.Core
+
+	mu      sync.Mutex
+	dropped map[samplingKey]int64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewSamplingReporter returns a reporter writing to core, which shouldn't be
+// sampled, every interval.
+func NewSamplingReporter(core zapcore.Core, interval time.Duration) *SamplingReporter {
+	r := &SamplingReporter{
+		core:    core,
+		dropped: make(map[samplingKey]int64),
+		done:    make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.run(interval)
+	return r
+}
+
+// Hook returns the option registering r with zapcore.NewSamplerWithOptions.
+func (r *SamplingReporter) Hook() zapcore.SamplerOption {
+	return zapcore.SamplerHook(func(ent zapcore.Entry, dec zapcore.SamplingDecision) {
+		if dec&zapcore.LogDropped == 0 {
+			return
+		}
+		r.mu.Lock()
+		r.dropped[samplingKey{ent.Level, ent.LoggerName}]++
+		r.mu.Unlock()
+	})
+}
+
+func (r *SamplingReporter) run(interval time.Duration) {
+	defer r.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-t.C:
+			r.Report()
+		}
+	}
+}
+
+// Report writes the counts of dropped entries now and resets them, it's
+// called every interval.
+func (r *SamplingReporter) Report() {
+	r.mu.Lock()
+	dropped := r.dropped
+	r.dropped = make(map[samplingKey]int64)
+	r.mu.Unlock()
+
+	keys := make([]samplingKey, 0, len(dropped))
+	for k := range dropped {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].level != keys[j].level {
+			return keys[i].level < keys[j].level
+		}
+		return keys[i].logger < keys[j].logger
+	})
+
+	ent := zapcore.Entry{Level: zapcore.WarnLevel, Message: "zapsyslog: entries dropped by sampling"}
+	for _, k := range keys {
+		ent.Time = time.Now()
+		if ce := r.core.Check(ent, nil); ce != nil {
+			ce.Write(
+				zap.Stringer("sampledLevel", k.level),
+				zap.String("sampledLogger", k.logger),
+				zap.Int64("dropped", dropped[k]),
+			)
+		}
+	}
+}
+
+// Close stops the periodic reports and writes a last one.
+func (r *SamplingReporter) Close() error {
+	r.once.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+		r.Report()
+	})
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSamplingReporter(t *testing.T) {
+	summaries, logs := observer.New(zapcore.DebugLevel)
+	r := NewSamplingReporter(summaries, time.Hour)
+	sampled, _ := observer.New(zapcore.DebugLevel)
+	logger := zap.New(zapcore.NewSamplerWithOptions(sampled, time.Hour, 1, 100, r.Hook()))
+
+	for i := 0; i < 3; i++ {
+		// The sampler counts entries by level and message only
+		logger.Info("root")
+		logger.Named("db").Info("db")
+		logger.Named("db").Warn("db")
+	}
+	r.Report()
+	entries := logs.TakeAll()
+	require.Len(t, entries, 3)
+	for i, expected := range []map[string]interface{}{
+		{"sampledLevel": "info", "sampledLogger": "", "dropped": int64(2)},
+		{"sampledLevel": "info", "sampledLogger": "db", "dropped": int64(2)},
+		{"sampledLevel": "warn", "sampledLogger": "db", "dropped": int64(2)},
+	} {
+		assert.Equal(t, zapcore.WarnLevel, entries[i].Level)
+		assert.Equal(t, expected, entries[i].ContextMap())
+	}
+
+	r.Report()
+	assert.Zero(t, logs.Len(), "Counts should be reset by reports.")
+
+	logger.Info("root")
+	require.NoError(t, r.Close())
+	require.Equal(t, 1, logs.Len(), "Close should write a last report.")
+	require.NoError(t, r.Close())
+}
+
+func TestSamplingReporterInterval(t *testing.T) {
+	summaries, logs := observer.New(zapcore.DebugLevel)
+	r := NewSamplingReporter(summaries, 10*time.Millisecond)
+	defer r.Close()
+	sampled, _ := observer.New(zapcore.DebugLevel)
+	logger := zap.New(zapcore.NewSamplerWithOptions(sampled, time.Hour, 1, 100, r.Hook()))
+
+	logger.Info("same")
+	logger.Info("same")
+	assert.Eventually(t, func() bool { return logs.Len() == 1 }, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import "unicode/utf8"
+
+// sanitizeJSONKeys replaces the characters of the keys of the JSON object b,
+// as encoded by zap, and of the objects nested in it and in arrays, that
+// aren't ASCII letters, digits or underscores with underscores. b is returned
+// as is if it can't be parsed.
+func sanitizeJSONKeys(b []byte) []byte {
+	out, ok := appendSanitizedObject(make([]byte, 0, len(b)), b)
+	if !ok {
+		return b
+	}
+	return out
+}
+
+// appendSanitizedObject appends the JSON object b, and what follows it, to
+// out with the keys sanitized.
+func appendSanitizedObject(out, b []byte) ([]byte, bool) {
+	members, rest, ok := splitJSONObject(b)
+	if !ok {
+		return out, false
+	}
+	out = append(out, '{')
+	for i, m := range members {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = appendSanitizedKey(out, m.key)
+		out = append(out, ':')
+		if out, ok = appendSanitizedValue(out, m.value); !ok {
+			return out, false
+		}
+	}
+	out = append(out, '}')
+	return append(out, rest...), true
+}
+
+// appendSanitizedValue appends the JSON value b to out, looking into objects
+// and arrays.
+func appendSanitizedValue(out, b []byte) ([]byte, bool) {
+	if len(b) == 0 {
+		return out, false
+	}
+	switch b[0] {
+	case '{':
+		return appendSanitizedObject(out, b)
+	case '[':
+		out = append(out, '[')
+		for i := 1; i < len(b)-1; {
+			if b[i] == ',' {
+				out = append(out, ',')
+				i++
+			}
+			end := skipJSONValue(b, i)
+			if end < 0 || end > len(b)-1 {
+				return out, false
+			}
+			var ok bool
+			if out, ok = appendSanitizedValue(out, b[i:end]); !ok {
+				return out, false
+			}
+			i = end
+		}
+		return append(out, ']'), true
+	}
+	return append(out, b...), true
+}
+
+// appendSanitizedKey appends the quoted JSON string key to out, with an
+// underscore for each escape sequence and each character that isn't an ASCII
+// letter, digit or underscore.
+func appendSanitizedKey(out, key []byte) []byte {
+	out = append(out, '"')
+	for i := 1; i < len(key)-1; {
+		c := key[i]
+		switch {
+		case c == '\\':
+			i += 2
+			if key[i-1] == 'u' {
+				i += 4
+			}
+			c = '_'
+		case c >= utf8.RuneSelf:
+			_, size := utf8.DecodeRune(key[i:])
+			i += size
+			c = '_'
+		default:
+			i++
+			if !isKeyChar(c) {
+				c = '_'
+			}
+		}
+		out = append(out, c)
+	}
+	return append(out, '"')
+}
+
+func isKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSanitizeJSONKeys(t *testing.T) {
+	const body = `{"http.status code":200,"o":{"a-b":"x.y","é\"té":1},"a":[{"k.v":1},"s.t"],"ok_1":true}` + "\n"
+	assert.Equal(t, `{"http_status_code":200,"o":{"a_b":"x.y","__t_":1},"a":[{"k_v":1},"s.t"],"ok_1":true}`+"\n",
+		string(sanitizeJSONKeys([]byte(body))))
+	assert.Equal(t, `{"d_j_":1}`, string(sanitizeJSONKeys([]byte(`{"déjà":1}`))))
+
+	for _, b := range []string{`{}`, `not json`, `{"k":1`} {
+		assert.Equal(t, b, string(sanitizeJSONKeys([]byte(b))))
+	}
+}
+
+func TestSyslogEncoderSanitizeKeys(t *testing.T) {
+	cfg := testEncoderConfig(NonTransparentFraming)
+	cfg.SanitizeKeys = true
+	cfg.DuplicateKeys = KeepLastKey
+	buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, []zapcore.Field{
+		zap.String("user.name", "alice"),
+		zap.Object("req", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			enc.AddInt("status code", 200)
+			return nil
+		})),
+		zap.String("user_name", "bob"),
+	})
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.Contains(t, buf.String(), `{"msg":"fake","req":{"status_code":200},"user_name":"bob"}`,
+		"Keys should be sanitized before duplicates are dropped.")
+}
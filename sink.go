@@ -0,0 +1,217 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SinkScheme is the URL scheme of the sink registered by RegisterSink.
+const SinkScheme = "syslog"
+
+var (
+	registerOnce sync.Once
+	registerErr  error
+)
+
+// RegisterSink registers the syslog sink and a "syslog" encoder with zap, so
+// that a whole pipeline fits in a zap.Config:
+//
+//	Encoding:    "syslog",
+//	OutputPaths: []string{"syslog://collector:6514?facility=local3&app=myapp&framing=octet&tls=insecure"},
+//
+// The sink URL accepts the following query parameters:
+//
+//	proto     udp (default, tcp with TLS), tcp, unix or unixgram
+//	facility  facility name, the encoder's by default
+//	app       APP-NAME, the encoder's by default
+//	framing   lf (default) or octet
+//	tls       true, false (default) or insecure to skip verification
+//
+// The sink rewrites the messages of the syslog encoder accordingly, whose
+// facility is user and APP-NAME the executable name. Unix socket paths go in
+// the URL path, e.g. syslog:///dev/log?proto=unixgram. Registering more than
+// once is a no-op.
+func RegisterSink() error {
+	registerOnce.Do(func() {
+		registerErr = zap.RegisterEncoder(SinkScheme, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return NewSyslogEncoder(SyslogEncoderConfig{
+				EncoderConfig: cfg,
+				Facility:      syslog.LOG_USER,
+				App:           filepath.Base(os.Args[0]),
+			}), nil
+		})
+		if registerErr == nil {
+			registerErr = zap.RegisterSink(SinkScheme, newURLSink)
+		}
+	})
+	return registerErr
+}
+
+// urlSink rewrites the messages of the syslog encoder as configured by the
+// sink URL.
+type urlSink struct {
+	*ConnSyncer
+	facility syslog.Priority
+	rewriteF bool
+	app      string
+	framing  Framing
+}
+
+func newURLSink(u *url.URL) (zap.Sink, error) {
+	s := &urlSink{}
+	network, addr := "udp", u.Host
+	var tlsConfig *tls.Config
+
+	q := u.Query()
+	for key := range q {
+		v := q.Get(key)
+		switch key {
+		case "proto":
+			network = v
+		case "facility":
+			facility, err := syslog.FacilityPriority(v)
+			if err != nil {
+				return nil, err
+			}
+			s.facility = facility
+			s.rewriteF = true
+		case "app":
+			s.app = normalizeAppName(v, KeepAppNameHead, charMapper{})
+		case "framing":
+			switch v {
+			case "lf":
+				s.framing = NonTransparentFraming
+			case "octet":
+				s.framing = OctetCountingFraming
+			default:
+				return nil, fmt.Errorf("zapsyslog: invalid framing in sink URL: %s", v)
+			}
+		case "tls":
+			if v == "insecure" {
+				tlsConfig = &tls.Config{InsecureSkipVerify: true}
+				break
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("zapsyslog: invalid tls in sink URL: %s", v)
+			}
+			if b {
+				tlsConfig = &tls.Config{}
+			}
+		default:
+			return nil, fmt.Errorf("zapsyslog: unknown sink URL parameter: %s", key)
+		}
+	}
+
+	if tlsConfig != nil {
+		if q.Get("proto") == "" {
+			network = "tcp"
+		}
+		switch network {
+		case "udp", "udp4", "udp6", "unixgram":
+			return nil, fmt.Errorf("zapsyslog: %s can't be used with TLS", network)
+		}
+	}
+	switch network {
+	case "unix", "unixgram":
+		addr = u.Path
+	}
+
+	var opts []SyncerOption
+	if tlsConfig != nil {
+		opts = append(opts, WithTLSConfig(tlsConfig))
+	}
+	ws, err := NewConnSyncer(network, addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.ConnSyncer = ws
+	return s, nil
+}
+
+// Write rewrites the message p before writing it, p is written as is if it
+// isn't a syslog message.
+func (s *urlSink) Write(p []byte) (int, error) {
+	msg, ok := s.rewrite(p)
+	if !ok {
+		return s.ConnSyncer.Write(p)
+	}
+	if _, err := s.ConnSyncer.Write(msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// rewrite replaces the facility and APP-NAME of the message p, and reframes
+// it.
+func (s *urlSink) rewrite(p []byte) ([]byte, bool) {
+	// Remove the framing
+	if i := bytes.IndexByte(p, ' '); i > 0 && p[0] >= '1' && p[0] <= '9' {
+		p = p[i+1:]
+	} else {
+		p = bytes.TrimSuffix(p, []byte{'\n'})
+	}
+	end := bytes.IndexByte(p, '>')
+	if len(p) == 0 || p[0] != '<' || end < 0 {
+		return nil, false
+	}
+	pri, err := strconv.Atoi(string(p[1:end]))
+	if err != nil {
+		return nil, false
+	}
+	if s.rewriteF {
+		pri = int(syslog.Priority(pri)&severityMask | s.facility)
+	}
+
+	msg := make([]byte, 0, len(p)+len(s.app)+16)
+	msg = append(msg, '<')
+	msg = strconv.AppendInt(msg, int64(pri), 10)
+	rest := p[end:]
+	if s.app != "" {
+		// VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME
+		fields := bytes.SplitN(rest, []byte{' '}, 5)
+		if len(fields) < 5 {
+			return nil, false
+		}
+		fields[3] = []byte(s.app)
+		rest = bytes.Join(fields, []byte{' '})
+	}
+	msg = append(msg, rest...)
+
+	if s.framing == OctetCountingFraming {
+		framed := strconv.AppendInt(make([]byte, 0, len(msg)+8), int64(len(msg)), 10)
+		framed = append(framed, ' ')
+		return append(framed, msg...), true
+	}
+	return append(msg, '\n'), true
+}
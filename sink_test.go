@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRegisterSink(t *testing.T) {
+	require.NoError(t, RegisterSink())
+	require.NoError(t, RegisterSink(), "Registering twice should be a no-op.")
+
+	done := make(chan string, 1)
+	addr, sock, _ := startServer("tcp", "", done)
+	defer sock.Close()
+
+	cfg := zap.NewProductionConfig()
+	cfg.Encoding = "syslog"
+	cfg.OutputPaths = []string{"syslog://" + addr + "?proto=tcp&facility=local3&app=myapp"}
+	logger, err := cfg.Build()
+	require.NoError(t, err)
+	logger.Warn("hello")
+	require.NoError(t, logger.Sync())
+
+	select {
+	case rcvd := <-done:
+		msg, err := syslog.ParseMessage([]byte(strings.TrimSuffix(rcvd, "\n")))
+		require.NoError(t, err)
+		assert.Equal(t, syslog.LOG_LOCAL3, msg.Facility())
+		assert.Equal(t, syslog.LOG_WARNING, msg.Severity())
+		assert.Equal(t, "myapp", msg.AppName)
+		assert.Contains(t, string(msg.Msg), `"msg":"hello"`)
+	case <-time.After(time.Second):
+		t.Fatal("Message not received")
+	}
+}
+
+func TestURLSinkRewrite(t *testing.T) {
+	s := &urlSink{facility: syslog.LOG_LOCAL3, rewriteF: true, app: "myapp", framing: OctetCountingFraming}
+	for _, p := range []string{
+		"<12>1 2003-10-11T22:14:15.003Z host app 1 - - {}\n",
+		"48 <12>1 2003-10-11T22:14:15.003Z host app 1 - - {}",
+	} {
+		msg, ok := s.rewrite([]byte(p))
+		require.True(t, ok)
+		assert.Equal(t, "51 <156>1 2003-10-11T22:14:15.003Z host myapp 1 - - {}", string(msg))
+	}
+
+	_, ok := s.rewrite([]byte(`{"msg":"not syslog"}`))
+	assert.False(t, ok)
+}
+
+func TestURLSinkInvalid(t *testing.T) {
+	require.NoError(t, RegisterSink())
+	for _, u := range []string{
+		"syslog://localhost:514?unknown=1",
+		"syslog://localhost:514?facility=nope",
+		"syslog://localhost:514?framing=nope",
+		"syslog://localhost:514?tls=nope",
+		"syslog://localhost:514?tls=true&proto=udp",
+	} {
+		_, _, err := zap.Open(u)
+		assert.Error(t, err, u)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"sort"
+)
+
+// sortJSONKeys sorts the members of the JSON object b, as encoded by zap,
+// and of the objects nested in it, by key. Members with the same key keep
+// their order. b is returned as is if it can't be parsed.
+func sortJSONKeys(b []byte) []byte {
+	members, rest, ok := splitJSONObject(b)
+	if !ok {
+		return b
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return bytes.Compare(members[i].key, members[j].key) < 0
+	})
+
+	out := make([]byte, 0, len(b))
+	out = append(out, '{')
+	for i, m := range members {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, m.key...)
+		out = append(out, ':')
+		if len(m.value) > 0 && m.value[0] == '{' {
+			out = append(out, sortJSONKeys(m.value)...)
+		} else {
+			out = append(out, m.value...)
+		}
+	}
+	out = append(out, '}')
+	return append(out, rest...)
+}
+
+// sortedSDParams returns params sorted by name, parameters with the same
+// name keep their order.
+func sortedSDParams(params []SDParam) []SDParam {
+	sorted := append([]SDParam(nil), params...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
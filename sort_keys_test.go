@@ -0,0 +1,57 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSortJSONKeys(t *testing.T) {
+	const body = `{"k":2,"o":{"z":"}],\"","a":{"y":1,"b":2}},"a":[{"z":1,"b":2}],"k":1}` + "\n"
+	assert.Equal(t, `{"a":[{"z":1,"b":2}],"k":2,"k":1,"o":{"a":{"b":2,"y":1},"z":"}],\""}}`+"\n", string(sortJSONKeys([]byte(body))))
+
+	for _, b := range []string{`{}`, `not json`, `{"k":1`} {
+		assert.Equal(t, b, string(sortJSONKeys([]byte(b))))
+	}
+}
+
+func TestSyslogEncoderSortKeys(t *testing.T) {
+	encode := func(sd []SDParam, fields ...zapcore.Field) string {
+		cfg := testEncoderConfig(NonTransparentFraming)
+		cfg.SortKeys = true
+		cfg.StructuredData = []SDElement{{ID: "meta", Params: sd}}
+		buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, fields)
+		require.NoError(t, err)
+		defer buf.Free()
+		return buf.String()
+	}
+
+	a, b := SDParam{Name: "a", Value: "1"}, SDParam{Name: "b", Value: "2"}
+	first := encode([]SDParam{b, a}, zap.Int("z", 1), zap.Int("b", 2))
+	assert.Contains(t, first, ` [meta a="1" b="2"] `)
+	assert.Contains(t, first, `{"b":2,"msg":"fake","z":1}`)
+	assert.Equal(t, first, encode([]SDParam{a, b}, zap.Int("b", 2), zap.Int("z", 1)))
+}
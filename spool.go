@@ -0,0 +1,813 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultSegmentSize = 4 << 20
+	spoolExt           = ".spool"
+	compressedExt      = ".gz"
+	compressFlushSize  = 64 << 10
+	recordHeaderLen    = 12
+	watermarkFile      = "watermark"
+	watermarkLen       = 42
+
+	// Bounds of the FallbackSyncer backoff after a failure of the primary
+	// syncer
+	minFallbackBackoff = time.Second
+	maxFallbackBackoff = 30 * time.Second
+)
+
+var (
+	_ zapcore.WriteSyncer = &Spool{}
+	_ zapcore.WriteSyncer = &FallbackSyncer{}
+
+	errExpired = errors.New("spooled message expired")
+)
+
+// A SpoolOption configures a Spool.
+type SpoolOption interface {
+	apply(*Spool)
+}
+
+// spoolOptionFunc wraps a func so it satisfies the SpoolOption interface.
+type spoolOptionFunc func(*Spool)
+
+func (f spoolOptionFunc) apply(s *Spool) {
+	f(s)
+}
+
+// WithSegmentSize makes the spool rotate to a new segment file once the
+// current one holds n bytes. The default is 4MiB.
+func WithSegmentSize(n int64) SpoolOption {
+	return spoolOptionFunc(func(s *Spool) {
+		if n > 0 {
+			s.segSize = n
+		}
+	})
+}
+
+// WithSpoolMaxSize caps the total size of the segment files to n bytes, the
+// oldest segments are deleted first to make room. Zero means no limit.
+func WithSpoolMaxSize(n int64) SpoolOption {
+	return spoolOptionFunc(func(s *Spool) {
+		s.maxSize = n
+	})
+}
+
+// WithSpoolMaxAge makes Replay drop the messages spooled more than d ago
+// instead of delivering them, so that a long outage isn't followed by a flood
+// of stale messages. Zero means no limit.
+func WithSpoolMaxAge(d time.Duration) SpoolOption {
+	return spoolOptionFunc(func(s *Spool) {
+		s.maxAge = d
+	})
+}
+
+// WithSpoolCompression gzips the segments, which suits the repetitive JSON
+// of structured messages. The segment size applies to the compressed size.
+// Records are flushed to the file by Sync and every 64KiB, a process crash
+// loses those not flushed yet. Segments written without compression are
+// still read.
+func WithSpoolCompression() SpoolOption {
+	return spoolOptionFunc(func(s *Spool) {
+		s.compress = true
+	})
+}
+
+// WithSpoolStats reports the messages dropped by the spool to st, as
+// ErrDropped errors.
+func WithSpoolStats(st Stats) SpoolOption {
+	return spoolOptionFunc(func(s *Spool) {
+		s.stats = st
+	})
+}
+
+// Spool appends messages to a directory of segment files, e.g. while the
+// syslog server is unreachable. Segments are rotated by size and the oldest
+// ones are deleted once the disk budget is exceeded, so a long outage can't
+// fill the disk. It's safe for concurrent use.
+//
+// Replay delivers the spooled messages in order. The position of the last
+// delivered message is persisted as a watermark, so that after a restart
+// delivered messages aren't replayed and undelivered ones aren't lost: a
+// message may be delivered twice if the process dies right after writing it,
+// but never skipped.
+type Spool struct {
+	mu       sync.Mutex
+	dir      string
+	segSize  int64
+	maxSize  int64
+	maxAge   time.Duration
+	compress bool
+	keys     SpoolKeyProvider
+	stats    Stats
+	now      func() time.Time
+
+	// segments lists the segment files oldest first, the last one is the
+	// active segment written to.
+	segments []spoolSegment
+	w        *segmentWriter
+	total    int64
+	lastSeq  uint64 // of the newest segment ever created
+	closed   bool
+
+	// mark is the position following the last replayed message.
+	mark  spoolPosition
+	markF *os.File
+}
+
+type spoolPosition struct {
+	seq    uint64
+	offset int64
+}
+
+type spoolSegment struct {
+	seq        uint64
+	size       int64
+	compressed bool
+	encrypted  bool
+}
+
+func (seg spoolSegment) name() string {
+	name := fmt.Sprintf("%020d%s", seg.seq, spoolExt)
+	if seg.compressed {
+		name += compressedExt
+	}
+	if seg.encrypted {
+		name += encryptedExt
+	}
+	return name
+}
+
+// parseSegmentName returns the segment named name, if it's one.
+func parseSegmentName(name string) (spoolSegment, bool) {
+	var seg spoolSegment
+	if strings.HasSuffix(name, encryptedExt) {
+		seg.encrypted = true
+		name = strings.TrimSuffix(name, encryptedExt)
+	}
+	if strings.HasSuffix(name, compressedExt) {
+		seg.compressed = true
+		name = strings.TrimSuffix(name, compressedExt)
+	}
+	if !strings.HasSuffix(name, spoolExt) {
+		return seg, false
+	}
+	seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolExt), 10, 64)
+	if err != nil {
+		return seg, false
+	}
+	seg.seq = seq
+	return seg, true
+}
+
+// segmentWriter appends records to a segment file, compressing then
+// encrypting them if enabled.
+type segmentWriter struct {
+	f        *os.File
+	zw       *gzip.Writer
+	sealer   *chunkSealer
+	n        int64 // bytes written to f
+	buffered int   // bytes written to zw since the last flush
+	records  int
+	decoded  int64 // bytes of the records written, as read back by Replay
+}
+
+// Write writes to the file, through the sealer if any.
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	if w.sealer != nil {
+		w.sealer.buf = append(w.sealer.buf, p...)
+		return len(p), nil
+	}
+	return w.write(p)
+}
+
+func (w *segmentWriter) write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// seal writes the bytes buffered by the sealer as a chunk.
+func (w *segmentWriter) seal() error {
+	if w.sealer == nil {
+		return nil
+	}
+	return w.sealer.seal(writerFunc(w.write))
+}
+
+func (w *segmentWriter) writeRecord(rec []byte) error {
+	w.records++
+	w.decoded += int64(len(rec))
+	if w.zw == nil {
+		if _, err := w.Write(rec); err != nil {
+			return err
+		}
+		return w.seal()
+	}
+	if _, err := w.zw.Write(rec); err != nil {
+		return err
+	}
+	// Flushing often would defeat the compression
+	if w.buffered += len(rec); w.buffered >= compressFlushSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *segmentWriter) flush() error {
+	if w.zw == nil || w.buffered == 0 {
+		return nil
+	}
+	w.buffered = 0
+	if err := w.zw.Flush(); err != nil {
+		return err
+	}
+	return w.seal()
+}
+
+func (w *segmentWriter) sync() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+func (w *segmentWriter) close() error {
+	var err error
+	if w.zw != nil {
+		if err = w.zw.Close(); err == nil {
+			err = w.seal()
+		}
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// NewSpool opens the spool in dir, creating the directory if needed. Segments
+// left by a previous process are kept, new messages are appended after them.
+func NewSpool(dir string, opts ...SpoolOption) (*Spool, error) {
+	s := &Spool{
+		dir:     dir,
+		segSize: defaultSegmentSize,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.loadWatermark(); err != nil {
+		return nil, err
+	}
+	if err := s.openActive(); err != nil {
+		s.markF.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadWatermark opens the watermark file and reads the replay position from
+// it. A corrupted watermark is ignored, replaying from the oldest segment.
+func (s *Spool) loadWatermark() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, watermarkFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	s.markF = f
+
+	b := make([]byte, watermarkLen)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil
+	}
+	var mark spoolPosition
+	if _, err := fmt.Sscanf(string(b), "%d %d\n", &mark.seq, &mark.offset); err == nil {
+		s.mark = mark
+	}
+	return nil
+}
+
+// saveWatermark persists the replay position, the fixed width of the record
+// lets it overwrite the previous one in place.
+func (s *Spool) saveWatermark(mark spoolPosition) error {
+	s.mark = mark
+	_, err := s.markF.WriteAt([]byte(fmt.Sprintf("%020d %020d\n", mark.seq, mark.offset)), 0)
+	return err
+}
+
+// load lists the existing segment files.
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		seg, ok := parseSegmentName(e.Name())
+		if e.IsDir() || !ok {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return err
+		}
+		seg.size = fi.Size()
+		s.segments = append(s.segments, seg)
+		s.total += fi.Size()
+		if seg.seq > s.lastSeq {
+			s.lastSeq = seg.seq
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].seq < s.segments[j].seq
+	})
+	return nil
+}
+
+// openActive creates the active segment, after the existing ones. A segment
+// left by a previous process isn't appended to, it may end with a record
+// truncated by a crash.
+func (s *Spool) openActive() error {
+	seg := spoolSegment{seq: s.lastSeq + 1, compressed: s.compress, encrypted: s.keys != nil}
+	if n := len(s.segments); n > 0 {
+		last := s.segments[n-1]
+		if last.size == 0 {
+			// Nothing to keep
+			if err := os.Remove(filepath.Join(s.dir, last.name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			s.segments = s.segments[:n-1]
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir, seg.name()), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	w := &segmentWriter{f: f}
+	if s.keys != nil {
+		if w.sealer, err = newChunkSealer(writerFunc(w.write), s.keys); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+	}
+	if s.compress {
+		w.zw = gzip.NewWriter(w)
+	}
+	s.w = w
+	s.segments = append(s.segments, seg)
+	s.lastSeq = seg.seq
+	s.updateSize(w)
+	return nil
+}
+
+// rotate closes the active segment and starts the next one.
+func (s *Spool) rotate() error {
+	w := s.w
+	s.w = nil
+	if err := w.close(); err != nil {
+		return err
+	}
+	s.updateSize(w)
+	return s.openActive()
+}
+
+// updateSize accounts for the bytes written to the active segment by w.
+func (s *Spool) updateSize(w *segmentWriter) {
+	active := &s.segments[len(s.segments)-1]
+	s.total += w.n - active.size
+	active.size = w.n
+}
+
+// enforceBudget deletes the oldest segments while the spool exceeds its
+// maximum size, the active segment is always kept.
+func (s *Spool) enforceBudget() error {
+	for s.maxSize > 0 && s.total > s.maxSize && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		if err := os.Remove(filepath.Join(s.dir, oldest.name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.segments = s.segments[1:]
+		s.total -= oldest.size
+	}
+	return nil
+}
+
+// Pending reports whether the spool holds messages not replayed yet.
+func (s *Spool) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pending()
+}
+
+func (s *Spool) pending() bool {
+	return len(s.segments) > 1 || (s.w != nil && s.w.decoded > s.activeMark())
+}
+
+// activeMark returns the watermark offset in the active segment.
+func (s *Spool) activeMark() int64 {
+	if s.mark.seq == s.segments[len(s.segments)-1].seq {
+		return s.mark.offset
+	}
+	return 0
+}
+
+// Replay writes the spooled messages to ws in order, deleting the segments
+// once all their messages are delivered. The active segment is flushed and
+// replayed too, without rotating it, and replaced with an empty one once
+// delivered. Messages older than the maximum age are skipped and reported as
+// dropped. It stops at the first failed write, returning the number of
+// messages delivered and the error; the next Replay resumes with the failed
+// message.
+func (s *Spool) Replay(ws zapcore.WriteSyncer) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, newSyncerError(ErrDropped, errSyncerClosed)
+	}
+	if !s.pending() {
+		return 0, nil
+	}
+	var delivered int
+	for len(s.segments) > 1 {
+		seg := s.segments[0]
+		n, err := s.replaySegment(seg, ws)
+		delivered += n
+		if err != nil {
+			return delivered, err
+		}
+		if err := os.Remove(filepath.Join(s.dir, seg.name())); err != nil && !os.IsNotExist(err) {
+			return delivered, err
+		}
+		s.segments = s.segments[1:]
+		s.total -= seg.size
+		if err := s.saveWatermark(spoolPosition{seq: s.segments[0].seq}); err != nil {
+			return delivered, err
+		}
+	}
+	if s.w == nil || s.w.decoded <= s.activeMark() {
+		return delivered, nil
+	}
+
+	// Records still buffered by the compressor aren't readable yet
+	if err := s.w.flush(); err != nil {
+		return delivered, err
+	}
+	s.updateSize(s.w)
+	n, err := s.replaySegment(s.segments[0], ws)
+	delivered += n
+	if err != nil {
+		return delivered, err
+	}
+	if s.w.decoded <= s.activeMark() {
+		err = s.recycle()
+	}
+	return delivered, err
+}
+
+// recycle replaces the active segment, fully delivered, with a new one.
+func (s *Spool) recycle() error {
+	active := s.segments[len(s.segments)-1]
+	w := s.w
+	s.w = nil
+	err := w.close()
+	if rerr := os.Remove(filepath.Join(s.dir, active.name())); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+		err = rerr
+	}
+	s.segments = s.segments[:len(s.segments)-1]
+	s.total -= active.size
+	if err != nil {
+		return err
+	}
+	if err := s.openActive(); err != nil {
+		return err
+	}
+	return s.saveWatermark(spoolPosition{seq: s.lastSeq})
+}
+
+// replaySegment writes the messages of seg past the watermark to ws, moving
+// the watermark after each of them.
+func (s *Spool) replaySegment(seg spoolSegment, ws zapcore.WriteSyncer) (int, error) {
+	f, err := os.Open(filepath.Join(s.dir, seg.name()))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if seg.encrypted {
+		if s.keys == nil {
+			return 0, errors.New("zapsyslog: no key to decrypt spool segment " + seg.name())
+		}
+		cr, err := newChunkReader(r, s.keys)
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		r = bufio.NewReader(cr)
+	}
+	if seg.compressed {
+		zr, err := gzip.NewReader(r)
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		r = bufio.NewReader(zr)
+	}
+
+	// The watermark is an offset in the decoded records
+	mark := spoolPosition{seq: seg.seq}
+	if s.mark.seq == seg.seq {
+		if _, err := r.Discard(int(s.mark.offset)); err != nil {
+			return 0, nil
+		}
+		mark.offset = s.mark.offset
+	}
+
+	var delivered int
+	for {
+		p, spooledAt, err := readRecord(r)
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			// A record truncated by a crash is skipped
+			return delivered, nil
+		}
+		if err != nil {
+			return delivered, err
+		}
+		if s.maxAge > 0 && s.now().Sub(spooledAt) > s.maxAge {
+			if s.stats != nil {
+				s.stats.Dropped(newSyncerError(ErrDropped, errExpired))
+			}
+		} else {
+			if _, err := ws.Write(p); err != nil {
+				return delivered, err
+			}
+			delivered++
+		}
+		mark.offset += int64(recordHeaderLen + len(p))
+		if err := s.saveWatermark(mark); err != nil {
+			return delivered, err
+		}
+	}
+}
+
+// readRecord reads the next record from r and the time it was spooled, it
+// returns io.EOF when there are no more records.
+func readRecord(r *bufio.Reader) ([]byte, time.Time, error) {
+	var hdr [recordHeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, time.Time{}, err
+	}
+	p := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+	if _, err := io.ReadFull(r, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, time.Time{}, err
+	}
+	return p, time.Unix(0, int64(binary.BigEndian.Uint64(hdr[4:]))), nil
+}
+
+// Write appends p to the spool as a single record, along with the time.
+func (s *Spool) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, newSyncerError(ErrDropped, errSyncerClosed)
+	}
+
+	if s.w == nil {
+		// A previous rotation failed
+		if err := s.openActive(); err != nil {
+			return 0, newSyncerError(ErrDropped, err)
+		}
+	}
+
+	n := int64(recordHeaderLen + len(p))
+	grow := n
+	if s.compress {
+		// The compressed size isn't known in advance, rotate once the
+		// segment is full instead
+		grow = 0
+	}
+	if active := s.segments[len(s.segments)-1]; s.w.records > 0 && active.size+grow >= s.segSize {
+		if err := s.rotate(); err != nil {
+			return 0, newSyncerError(ErrDropped, err)
+		}
+	}
+
+	rec := make([]byte, recordHeaderLen, n)
+	binary.BigEndian.PutUint32(rec, uint32(len(p)))
+	binary.BigEndian.PutUint64(rec[4:], uint64(s.now().UnixNano()))
+	rec = append(rec, p...)
+	err := s.w.writeRecord(rec)
+	s.updateSize(s.w)
+	if err != nil {
+		return 0, newSyncerError(ErrDropped, err)
+	}
+
+	if err := s.enforceBudget(); err != nil {
+		return len(p), err
+	}
+	return len(p), nil
+}
+
+// Size returns the total size of the segment files.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.total
+}
+
+// Sync implements zapcore.WriteSyncer interface, it commits the active
+// segment to stable storage.
+func (s *Spool) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || s.w == nil {
+		return nil
+	}
+	err := s.w.sync()
+	s.updateSize(s.w)
+	return err
+}
+
+// Close closes the active segment, later writes fail with ErrDropped. The
+// segment files are kept.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.markF.Close()
+	if s.w == nil {
+		return nil
+	}
+	return s.w.close()
+}
+
+// writerFunc wraps a func so it satisfies the io.Writer interface.
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// FallbackSyncer writes to a primary syncer, messages it fails to write are
+// appended to a spool instead of being lost. Spooled messages are replayed to
+// the primary syncer before the next message goes to it, so that ordering is
+// kept. After a failure of the primary syncer, messages go straight to the
+// spool for a backoff period, doubling up to 30s while the failures go on.
+// Writes are serialized.
+type FallbackSyncer struct {
+	mu        sync.Mutex
+	primary   zapcore.WriteSyncer
+	spool     *Spool
+	now       func() time.Time
+	lastErr   error
+	lastErrAt time.Time
+	backoff   time.Duration
+	retryAt   time.Time
+}
+
+// NewFallbackSyncer returns a syncer writing to primary, falling back to
+// spool when primary fails.
+func NewFallbackSyncer(primary zapcore.WriteSyncer, spool *Spool) *FallbackSyncer {
+	return &FallbackSyncer{primary: primary, spool: spool, now: time.Now}
+}
+
+// Write writes p to the primary syncer, or to the spool if that fails, is
+// backing off or spooled messages can't be replayed first. Only failing to
+// spool the message is reported.
+func (s *FallbackSyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.backingOff() && s.replay() == nil {
+		_, err := s.primary.Write(p)
+		if err == nil {
+			return len(p), nil
+		}
+		s.failed(err)
+	}
+	return s.spool.Write(p)
+}
+
+func (s *FallbackSyncer) backingOff() bool {
+	return s.now().Before(s.retryAt)
+}
+
+// failed records err from the primary syncer and backs off.
+func (s *FallbackSyncer) failed(err error) {
+	s.lastErr = err
+	s.lastErrAt = s.now()
+	switch {
+	case s.backoff == 0:
+		s.backoff = minFallbackBackoff
+	case s.backoff < maxFallbackBackoff:
+		s.backoff *= 2
+		if s.backoff > maxFallbackBackoff {
+			s.backoff = maxFallbackBackoff
+		}
+	}
+	s.retryAt = s.lastErrAt.Add(s.backoff)
+}
+
+func (s *FallbackSyncer) replay() error {
+	if !s.spool.Pending() {
+		s.backoff = 0
+		return nil
+	}
+	if _, err := s.spool.Replay(s.primary); err != nil {
+		s.failed(err)
+		return err
+	}
+	s.backoff = 0
+	return nil
+}
+
+// LastError returns the latest error from the primary syncer and when it
+// happened, or a nil error if there has been none. It's not reset once the
+// primary syncer recovers.
+func (s *FallbackSyncer) LastError() (error, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr, s.lastErrAt
+}
+
+// Sync implements zapcore.WriteSyncer interface, it replays the spooled
+// messages then syncs both the primary syncer and the spool. While backing
+// off, only the spool is synced and the latest error of the primary syncer is
+// returned.
+func (s *FallbackSyncer) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.backingOff() {
+		err = s.lastErr
+	} else if err = s.replay(); err == nil {
+		if err = s.primary.Sync(); err != nil {
+			s.failed(err)
+		}
+	}
+	if spoolErr := s.spool.Sync(); spoolErr != nil {
+		return spoolErr
+	}
+	return err
+}
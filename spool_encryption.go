@@ -0,0 +1,208 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	encryptedExt   = ".enc"
+	chunkHeaderLen = 4
+	maxKeyIDLen    = 255
+	maxChunkLen    = 16 << 20
+)
+
+var errKeyIDTooLong = errors.New("zapsyslog: spool key ID longer than 255 bytes")
+
+// SpoolKeyProvider supplies the AES keys encrypting the spool, e.g. from a
+// key management service. Keys are identified so that segments written
+// before a key rotation can still be read.
+type SpoolKeyProvider interface {
+	// CurrentKey returns the key to encrypt new segments with, and its ID.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given ID.
+	Key(id string) ([]byte, error)
+}
+
+type staticSpoolKey []byte
+
+func (k staticSpoolKey) CurrentKey() (string, []byte, error) {
+	return "", k, nil
+}
+
+func (k staticSpoolKey) Key(id string) ([]byte, error) {
+	if id != "" {
+		return nil, fmt.Errorf("zapsyslog: unknown spool key %q", id)
+	}
+	return k, nil
+}
+
+// WithSpoolEncryption encrypts the segments with AES-GCM, key being 16, 24
+// or 32 bytes long to select AES-128, AES-192 or AES-256. Segments written
+// without encryption are still read.
+func WithSpoolEncryption(key []byte) SpoolOption {
+	return WithSpoolKeyProvider(staticSpoolKey(key))
+}
+
+// WithSpoolKeyProvider encrypts the segments with AES-GCM, using the keys
+// supplied by p. The current key is requested for each new segment.
+func WithSpoolKeyProvider(p SpoolKeyProvider) SpoolOption {
+	return spoolOptionFunc(func(s *Spool) {
+		s.keys = p
+	})
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkSealer encrypts the bytes written to a segment in chunks, each sealed
+// with a random nonce and its index as additional data, so that chunks can't
+// be reordered. A chunk is: length (4 bytes), nonce, ciphertext.
+type chunkSealer struct {
+	aead  cipher.AEAD
+	index uint64
+	buf   []byte // plaintext of the next chunk
+}
+
+// newChunkSealer writes the segment header, the ID of the key, to w.
+func newChunkSealer(w io.Writer, keys SpoolKeyProvider) (*chunkSealer, error) {
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > maxKeyIDLen {
+		return nil, errKeyIDTooLong
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append([]byte{byte(len(id))}, id...)); err != nil {
+		return nil, err
+	}
+	return &chunkSealer{aead: aead}, nil
+}
+
+// seal writes the buffered plaintext to w as a chunk.
+func (c *chunkSealer) seal(w io.Writer) error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	nonceLen := c.aead.NonceSize()
+	chunk := make([]byte, chunkHeaderLen+nonceLen, chunkHeaderLen+nonceLen+len(c.buf)+c.aead.Overhead())
+	nonce := chunk[chunkHeaderLen:]
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	var ad [8]byte
+	binary.BigEndian.PutUint64(ad[:], c.index)
+	chunk = c.aead.Seal(chunk, nonce, c.buf, ad[:])
+	binary.BigEndian.PutUint32(chunk, uint32(len(chunk)-chunkHeaderLen))
+
+	c.buf = c.buf[:0]
+	c.index++
+	_, err := w.Write(chunk)
+	return err
+}
+
+// chunkReader decrypts the chunks written by a chunkSealer. A chunk
+// truncated by a crash reads as io.ErrUnexpectedEOF, a chunk failing
+// authentication is an error.
+type chunkReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	index uint64
+	plain []byte
+}
+
+// newChunkReader reads the segment header from r.
+func newChunkReader(r *bufio.Reader, keys SpoolKeyProvider) (*chunkReader, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, n)
+	if _, err := io.ReadFull(r, id); err != nil {
+		return nil, err
+	}
+	key, err := keys.Key(string(id))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{r: r, aead: aead}, nil
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.plain) == 0 {
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.plain)
+	c.plain = c.plain[n:]
+	return n, nil
+}
+
+func (c *chunkReader) next() error {
+	var hdr [chunkHeaderLen]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n > maxChunkLen || int(n) < c.aead.NonceSize()+c.aead.Overhead() {
+		return errors.New("zapsyslog: invalid spool chunk")
+	}
+	chunk := make([]byte, n)
+	if _, err := io.ReadFull(c.r, chunk); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	var ad [8]byte
+	binary.BigEndian.PutUint64(ad[:], c.index)
+	nonceLen := c.aead.NonceSize()
+	plain, err := c.aead.Open(chunk[nonceLen:nonceLen], chunk[:nonceLen], chunk[nonceLen:], ad[:])
+	if err != nil {
+		return fmt.Errorf("zapsyslog: spool chunk %d: %w", c.index, err)
+	}
+	c.index++
+	c.plain = plain
+	return nil
+}
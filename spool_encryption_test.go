@@ -0,0 +1,132 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rotatingKeys is a SpoolKeyProvider whose current key can be changed.
+type rotatingKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+func (k *rotatingKeys) CurrentKey() (string, []byte, error) {
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *rotatingKeys) Key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+func TestSpoolEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			dir := t.TempDir()
+			opts := []SpoolOption{WithSpoolEncryption(key)}
+			if compress {
+				opts = append(opts, WithSpoolCompression())
+			}
+			s, err := NewSpool(dir, opts...)
+			require.NoError(t, err)
+			for _, msg := range []string{"secret one", "secret two"} {
+				_, err := s.Write([]byte(msg))
+				require.NoError(t, err)
+			}
+			require.NoError(t, s.Close())
+
+			files := spoolFiles(t, dir)
+			require.Len(t, files, 1)
+			b, err := os.ReadFile(filepath.Join(dir, files[0]))
+			require.NoError(t, err)
+			assert.NotContains(t, string(b), "secret", "Segments should be encrypted.")
+
+			s, err = NewSpool(dir, opts...)
+			require.NoError(t, err)
+			defer s.Close()
+			ws := &flakySyncer{}
+			_, err = s.Replay(ws)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"secret one", "secret two"}, ws.messages())
+		})
+	}
+}
+
+func TestSpoolEncryptionWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir, WithSpoolEncryption(bytes.Repeat([]byte{1}, 16)))
+	require.NoError(t, err)
+	_, err = s.Write([]byte("secret"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	s, err = NewSpool(dir, WithSpoolEncryption(bytes.Repeat([]byte{2}, 16)))
+	require.NoError(t, err)
+	defer s.Close()
+	ws := &flakySyncer{}
+	_, err = s.Replay(ws)
+	assert.Error(t, err, "Segments should fail authentication with another key.")
+	assert.Empty(t, ws.messages())
+	assert.True(t, s.Pending(), "Segments failing authentication should be kept.")
+}
+
+func TestSpoolKeyProvider(t *testing.T) {
+	keys := &rotatingKeys{
+		current: "old",
+		keys: map[string][]byte{
+			"old": bytes.Repeat([]byte{1}, 32),
+			"new": bytes.Repeat([]byte{2}, 32),
+		},
+	}
+	s, err := NewSpool(t.TempDir(), WithSegmentSize(1), WithSpoolKeyProvider(keys))
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Write([]byte("before"))
+	require.NoError(t, err)
+	keys.current = "new"
+	_, err = s.Write([]byte("after"))
+	require.NoError(t, err)
+
+	ws := &flakySyncer{}
+	_, err = s.Replay(ws)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"before", "after"}, ws.messages(),
+		"Segments written before a key rotation should be readable.")
+}
+
+func TestSpoolEncryptionInvalidKey(t *testing.T) {
+	_, err := NewSpool(t.TempDir(), WithSpoolEncryption([]byte("short")))
+	assert.Error(t, err)
+}
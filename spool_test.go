@@ -0,0 +1,353 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakySyncer records the messages written to it, writes fail while it's
+// down or once limit messages are written.
+type flakySyncer struct {
+	mu       sync.Mutex
+	down     bool
+	limit    int
+	attempts int
+	written  []string
+}
+
+func (s *flakySyncer) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *flakySyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.down || (s.limit > 0 && len(s.written) >= s.limit) {
+		return 0, newSyncerError(ErrNotConnected, errors.New("down"))
+	}
+	s.written = append(s.written, string(p))
+	return len(p), nil
+}
+
+func (s *flakySyncer) Sync() error {
+	return nil
+}
+
+func (s *flakySyncer) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.written...)
+}
+
+func spoolFiles(t testing.TB, dir string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, "*"+spoolExt+"*"))
+	require.NoError(t, err)
+	for i, name := range names {
+		names[i] = filepath.Base(name)
+	}
+	return names
+}
+
+func TestSpoolRotation(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir, WithSegmentSize(20))
+	require.NoError(t, err)
+	s.now = func() time.Time { return time.Unix(0, 0x0102030405060708) }
+
+	for _, msg := range []string{"0123456789", "0123456789", "0123456789"} {
+		n, err := s.Write([]byte(msg))
+		require.NoError(t, err)
+		assert.Equal(t, len(msg), n)
+	}
+	require.NoError(t, s.Close())
+
+	assert.Equal(t, []string{
+		"00000000000000000001.spool",
+		"00000000000000000002.spool",
+		"00000000000000000003.spool",
+	}, spoolFiles(t, dir), "Each 22 bytes record should get its own segment.")
+	assert.Equal(t, int64(66), s.Size())
+
+	b, err := os.ReadFile(filepath.Join(dir, "00000000000000000002.spool"))
+	require.NoError(t, err)
+	assert.Equal(t, "\x00\x00\x00\x0a\x01\x02\x03\x04\x05\x06\x07\x080123456789", string(b))
+
+	_, err = s.Write([]byte("closed"))
+	assert.True(t, errors.Is(err, ErrDropped), "Writes after Close should fail.")
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir, WithSegmentSize(50), WithSpoolMaxSize(100))
+	require.NoError(t, err)
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		_, err := s.Write([]byte("0123456789"))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		"00000000000000000004.spool",
+		"00000000000000000005.spool",
+	}, spoolFiles(t, dir), "Oldest segments should be deleted first.")
+	assert.Equal(t, int64(88), s.Size())
+}
+
+func TestSpoolReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir, WithSegmentSize(20))
+	require.NoError(t, err)
+	_, err = s.Write([]byte("0123456789"))
+	require.NoError(t, err)
+	_, err = s.Write([]byte("0123456789"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	s, err = NewSpool(dir, WithSegmentSize(20))
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, int64(44), s.Size())
+
+	_, err = s.Write([]byte("0123456789"))
+	require.NoError(t, err)
+	assert.Len(t, spoolFiles(t, dir), 3, "Writes should continue after the existing segments.")
+}
+
+func TestFallbackSyncer(t *testing.T) {
+	primary := &flakySyncer{}
+	spool, err := NewSpool(t.TempDir())
+	require.NoError(t, err)
+	defer spool.Close()
+	s := NewFallbackSyncer(primary, spool)
+	now := time.Unix(1000000, 0)
+	s.now = func() time.Time { return now }
+
+	_, err = s.Write([]byte("first"))
+	require.NoError(t, err)
+	primary.setDown(true)
+	n, err := s.Write([]byte("second"))
+	require.NoError(t, err, "Failed writes should be spooled.")
+	assert.Equal(t, 6, n)
+	_, err = s.Write([]byte("third"))
+	require.NoError(t, err)
+	assert.Error(t, s.Sync(), "Sync should fail while spooled messages can't be replayed.")
+
+	assert.Equal(t, []string{"first"}, primary.messages())
+	assert.True(t, spool.Pending())
+	lastErr, at := s.LastError()
+	assert.Error(t, lastErr)
+	assert.Equal(t, now, at)
+
+	primary.setDown(false)
+	now = now.Add(minFallbackBackoff)
+	_, err = s.Write([]byte("fourth"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "third", "fourth"}, primary.messages(),
+		"Spooled messages should be replayed first.")
+	assert.False(t, spool.Pending())
+	assert.Equal(t, int64(0), spool.Size())
+}
+
+func TestFallbackSyncerOutage(t *testing.T) {
+	for _, opts := range [][]SpoolOption{
+		nil,
+		{WithSpoolCompression()},
+		{WithSpoolEncryption(bytes.Repeat([]byte{1}, 32))},
+	} {
+		dir := t.TempDir()
+		spool, err := NewSpool(dir, opts...)
+		require.NoError(t, err)
+		defer spool.Close()
+		primary := &flakySyncer{down: true}
+		s := NewFallbackSyncer(primary, spool)
+		now := time.Unix(1000000, 0)
+		s.now = func() time.Time { return now }
+
+		for i := 0; i < 100; i++ {
+			_, err := s.Write([]byte(fmt.Sprintf("message %d", i)))
+			require.NoError(t, err)
+			now = now.Add(20 * time.Millisecond)
+		}
+		assert.Len(t, spoolFiles(t, dir), 1, "Writes during an outage should not rotate segments.")
+		assert.Equal(t, 2, primary.attempts, "The primary syncer should be retried after the backoff only.")
+
+		primary.setDown(false)
+		now = now.Add(maxFallbackBackoff)
+		_, err = s.Write([]byte("recovered"))
+		require.NoError(t, err)
+		messages := primary.messages()
+		require.Len(t, messages, 101)
+		assert.Equal(t, "message 0", messages[0])
+		assert.Equal(t, "recovered", messages[100])
+		assert.Len(t, spoolFiles(t, dir), 1)
+		assert.False(t, spool.Pending())
+	}
+}
+
+func TestFallbackSyncerBackoff(t *testing.T) {
+	spool, err := NewSpool(t.TempDir())
+	require.NoError(t, err)
+	defer spool.Close()
+	s := NewFallbackSyncer(&flakySyncer{down: true}, spool)
+	now := time.Unix(1000000, 0)
+	s.now = func() time.Time { return now }
+
+	for _, expected := range []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		16 * time.Second, 30 * time.Second, 30 * time.Second,
+	} {
+		_, err := s.Write([]byte("message"))
+		require.NoError(t, err)
+		assert.Equal(t, expected, s.retryAt.Sub(now))
+		now = s.retryAt
+	}
+}
+
+func TestSpoolReplayWatermark(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir, WithSegmentSize(40))
+	require.NoError(t, err)
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		_, err := s.Write([]byte(msg))
+		require.NoError(t, err)
+	}
+
+	ws := &flakySyncer{limit: 3}
+	n, err := s.Replay(ws)
+	assert.Error(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"one", "two", "three"}, ws.messages())
+	assert.Equal(t, []string{"00000000000000000002.spool"}, spoolFiles(t, dir),
+		"Replayed segments should be deleted.")
+	require.NoError(t, s.Close())
+
+	// Simulate a restart
+	s, err = NewSpool(dir, WithSegmentSize(40))
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = s.Write([]byte("five"))
+	require.NoError(t, err)
+
+	ws = &flakySyncer{}
+	n, err = s.Replay(ws)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"four", "five"}, ws.messages(),
+		"Delivered messages should not be replayed after a restart.")
+	assert.False(t, s.Pending())
+}
+
+func TestSpoolReplayTruncatedRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir)
+	require.NoError(t, err)
+	_, err = s.Write([]byte("complete"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// Simulate a crash in the middle of a write
+	f, err := os.OpenFile(filepath.Join(dir, "00000000000000000001.spool"), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("\x00\x00\x00\x10trunc"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = NewSpool(dir)
+	require.NoError(t, err)
+	defer s.Close()
+	ws := &flakySyncer{}
+	n, err := s.Replay(ws)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"complete"}, ws.messages())
+}
+
+func TestSpoolMaxAge(t *testing.T) {
+	st := &recordingStats{}
+	s, err := NewSpool(t.TempDir(), WithSpoolMaxAge(time.Hour), WithSpoolStats(st))
+	require.NoError(t, err)
+	defer s.Close()
+
+	now := time.Unix(1000000, 0)
+	s.now = func() time.Time { return now }
+	_, err = s.Write([]byte("stale"))
+	require.NoError(t, err)
+	now = now.Add(30 * time.Minute)
+	_, err = s.Write([]byte("fresh"))
+	require.NoError(t, err)
+
+	now = now.Add(45 * time.Minute)
+	ws := &flakySyncer{}
+	n, err := s.Replay(ws)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"fresh"}, ws.messages(), "Expired messages should not be replayed.")
+	require.Len(t, st.dropped, 1)
+	assert.True(t, errors.Is(st.dropped[0], ErrDropped))
+	assert.False(t, s.Pending())
+}
+
+func TestSpoolCompression(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir, WithSpoolCompression())
+	require.NoError(t, err)
+
+	var expected []string
+	for i := 0; i < 100; i++ {
+		msg := fmt.Sprintf(`<14>1 - host app 1 - - {"msg":"request served","status":200,"id":%d}`, i)
+		expected = append(expected, msg)
+		_, err := s.Write([]byte(msg))
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.Sync())
+	assert.Equal(t, []string{"00000000000000000001.spool.gz"}, spoolFiles(t, dir))
+	assert.Less(t, s.Size(), int64(100*recordHeaderLen), "Records should be compressed.")
+
+	ws := &flakySyncer{limit: 40}
+	n, err := s.Replay(ws)
+	assert.Error(t, err)
+	assert.Equal(t, 40, n)
+	require.NoError(t, s.Close())
+
+	// Records flushed before a restart are readable, and the watermark
+	// applies to the uncompressed records
+	s, err = NewSpool(dir)
+	require.NoError(t, err)
+	defer s.Close()
+	ws = &flakySyncer{}
+	_, err = s.Replay(ws)
+	require.NoError(t, err)
+	assert.Equal(t, expected[40:], ws.messages())
+}
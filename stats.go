@@ -0,0 +1,98 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Stats receives syncer events, e.g. to export them as metrics. Methods are
+// called synchronously and must be safe for concurrent use.
+type Stats interface {
+	// Written is called for each message written, with its size.
+	Written(n int)
+	// Dropped is called for each message that couldn't be written, with the
+	// error returned to the caller.
+	Dropped(err error)
+	// Reconnected is called after each successful reconnection.
+	Reconnected()
+}
+
+// LatencyStats may be implemented by a Stats to observe the latencies of the
+// logging pipeline as well.
+type LatencyStats interface {
+	Stats
+	// ObserveEncode is called with the time taken to encode each entry, by
+	// encoders returned by ObserveEncoder.
+	ObserveEncode(d time.Duration)
+	// ObserveWrite is called with the time taken by each write, including
+	// reconnections and retries.
+	ObserveWrite(d time.Duration)
+	// ObserveQueue is called by asynchronous syncers with the time each
+	// message spent queued before being written.
+	ObserveQueue(d time.Duration)
+}
+
+// WithStats reports the syncer events to st, latencies as well if st
+// implements LatencyStats.
+func WithStats(st Stats) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		s.stats = st
+		s.latency, _ = st.(LatencyStats)
+	})
+}
+
+// observeWrite reports the outcome of a write started at start.
+func (s *ConnSyncer) observeWrite(start time.Time, n int, err error) {
+	if s.latency != nil {
+		s.latency.ObserveWrite(time.Since(start))
+	}
+	if err != nil {
+		s.stats.Dropped(err)
+	} else {
+		s.stats.Written(n)
+	}
+}
+
+// ObserveEncoder returns an encoder reporting the time enc takes to encode
+// each entry to st, as do its clones.
+func ObserveEncoder(enc zapcore.Encoder, st LatencyStats) zapcore.Encoder {
+	return &observedEncoder{Encoder: enc, stats: st}
+}
+
+type observedEncoder struct {
+	zapcore.Encoder
+	stats LatencyStats
+}
+
+func (enc *observedEncoder) Clone() zapcore.Encoder {
+	return &observedEncoder{Encoder: enc.Encoder.Clone(), stats: enc.stats}
+}
+
+func (enc *observedEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	start := time.Now()
+	buf, err := enc.Encoder.EncodeEntry(ent, fields)
+	enc.stats.ObserveEncode(time.Since(start))
+	return buf, err
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+// recordingStats records the events it receives.
+type recordingStats struct {
+	mu          sync.Mutex
+	written     []int
+	dropped     []error
+	reconnected int
+	encode      []time.Duration
+	write       []time.Duration
+	queue       []time.Duration
+}
+
+func (st *recordingStats) Written(n int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.written = append(st.written, n)
+}
+
+func (st *recordingStats) Dropped(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.dropped = append(st.dropped, err)
+}
+
+func (st *recordingStats) Reconnected() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.reconnected++
+}
+
+func (st *recordingStats) ObserveEncode(d time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.encode = append(st.encode, d)
+}
+
+func (st *recordingStats) ObserveWrite(d time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.write = append(st.write, d)
+}
+
+func (st *recordingStats) ObserveQueue(d time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.queue = append(st.queue, d)
+}
+
+func TestSyncerStats(t *testing.T) {
+	done := make(chan string)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	st := &recordingStats{}
+	s, err := NewConnSyncer("tcp", addr, WithStats(st), WithMaxMessageSize(10))
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	<-done
+	_, err = s.Write([]byte("too large message\n"))
+	require.Error(t, err)
+
+	// Force a reconnection
+	s.mu.Lock()
+	s.closeConn()
+	s.mu.Unlock()
+	_, err = s.Write([]byte("again\n"))
+	require.NoError(t, err)
+	<-done
+
+	assert.Equal(t, []int{6, 6}, st.written)
+	require.Len(t, st.dropped, 1)
+	assert.ErrorIs(t, st.dropped[0], ErrMessageTooLarge)
+	assert.Equal(t, 1, st.reconnected)
+	assert.Len(t, st.write, 3)
+}
+
+func TestObserveEncoder(t *testing.T) {
+	st := &recordingStats{}
+	enc := ObserveEncoder(NewSyslogEncoder(testEncoderConfig(DefaultFraming)), st)
+	clone := enc.Clone()
+	clone.AddString("k", "v")
+
+	buf, err := clone.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.Contains(t, buf.String(), `"k":"v"`)
+
+	buf2, err := enc.EncodeEntry(zapcore.Entry{}, nil)
+	require.NoError(t, err)
+	buf2.Free()
+	assert.Len(t, st.encode, 2)
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const maxSDNameLen = 32
+
+// SDElement is an RFC5424 STRUCTURED-DATA element, skipped if its ID is
+// empty.
+type SDElement struct {
+	ID     string    `json:"id" yaml:"id"`
+	Params []SDParam `json:"params" yaml:"params"`
+}
+
+// SDParam is a parameter of an SDElement, names may repeat. Parameters
+// without a name are skipped.
+type SDParam struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// NewTokenSDElement returns the element hosted providers such as Loggly
+// route messages by: the customer token at the provider's private enterprise
+// number, e.g. [TOKEN@41058 tag="web"]. The ID is kept whole even though it
+// usually exceeds the 32 characters RFC5424 allows.
+func NewTokenSDElement(token string, enterpriseID int, tags ...string) SDElement {
+	e := SDElement{ID: token + "@" + strconv.Itoa(enterpriseID)}
+	for _, tag := range tags {
+		e.Params = append(e.Params, SDParam{Name: "tag", Value: tag})
+	}
+	return e
+}
+
+// rawSDKey is the key of RawSD fields.
+const rawSDKey = "rawSD"
+
+// rawSD is pre-built STRUCTURED-DATA, see RawSD.
+type rawSD string
+
+// MarshalLogObject implements zapcore.ObjectMarshaler, for other encoders.
+func (sd rawSD) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("sd", string(sd))
+	return nil
+}
+
+// RawSD returns a field carrying STRUCTURED-DATA built elsewhere, e.g. by an
+// upstream system, as one or more SD-ELEMENTs: `[id@32473 k="v"][meta]`. The
+// syslog encoder checks it and writes it verbatim after the configured
+// elements. Malformed values are written to the JSON body instead, as a
+// rawSD string field. Other encoders write it as a rawSD object.
+func RawSD(s string) zap.Field {
+	return zap.Object(rawSDKey, rawSD(s))
+}
+
+// validRawSD reports whether s is one or more well-formed SD-ELEMENTs.
+func validRawSD(s string) bool {
+	if s == "" || s[0] != '[' {
+		return false
+	}
+	m, err := syslog.ParseMessage([]byte("<0>1 - - - - - " + s))
+	return err == nil && m.Msg == nil
+}
+
+// appendTo appends e to buf, unless its ID is empty. Parameters without a
+// name are skipped.
+func (e SDElement) appendTo(buf *buffer.Buffer, maxValueLen int) {
+	id := toSDID(e.ID)
+	if id == "" {
+		return
+	}
+	buf.AppendByte('[')
+	buf.AppendString(id)
+	truncated := false
+	for _, p := range e.Params {
+		if name := toSDName(p.Name); name != "" {
+			truncated = appendSDParam(buf, name, p.Value, maxValueLen) || truncated
+		}
+	}
+	closeSDElement(buf, truncated)
+}
+
+func sdNameMapper(r rune) rune {
+	// SD-NAME = 1*32PRINTUSASCII except '=', SP, ']', %d34 (")
+	switch r {
+	case '=', ' ', ']', '"':
+		return '_'
+	}
+	return rfc5424CompliantASCIIMapper(r)
+}
+
+func toSDName(s string) string {
+	s = strings.Map(sdNameMapper, s)
+	if len(s) > maxSDNameLen {
+		s = s[:maxSDNameLen]
+	}
+	return s
+}
+
+// toSDID is like toSDName, except that enterprise-specific IDs (name@number)
+// aren't truncated: hosted providers deliberately route by tokens exceeding
+// the 32 characters limit, e.g. Loggly's UUIDs.
+func toSDID(s string) string {
+	if strings.IndexByte(s, '@') < 0 {
+		return toSDName(s)
+	}
+	return strings.Map(sdNameMapper, s)
+}
+
+// sdTruncationMarker ends the PARAM-VALUEs cut to their maximum length.
+const sdTruncationMarker = "\u2026"
+
+// appendSDParam appends SP PARAM-NAME="PARAM-VALUE" to buf. Unless
+// maxValueLen is zero, values longer than maxValueLen bytes, before escaping,
+// are cut at a character boundary and end with sdTruncationMarker, within
+// maxValueLen bytes; the marker is left out when maxValueLen is too small
+// to hold it. It reports whether the value was cut.
+func appendSDParam(buf *buffer.Buffer, name, value string, maxValueLen int) bool {
+	truncated := maxValueLen > 0 && len(value) > maxValueLen
+	if truncated {
+		marker := sdTruncationMarker
+		if maxValueLen < len(marker) {
+			marker = ""
+		}
+		n := maxValueLen - len(marker)
+		for n > 0 && !utf8.RuneStart(value[n]) {
+			n--
+		}
+		value = value[:n] + marker
+	}
+	buf.AppendByte(' ')
+	buf.AppendString(name)
+	buf.AppendString(`="`)
+	appendSDParamValue(buf, value)
+	buf.AppendByte('"')
+	return truncated
+}
+
+// closeSDElement ends an SD-ELEMENT, with sd_truncated="1" if any of its
+// values was cut.
+func closeSDElement(buf *buffer.Buffer, truncated bool) {
+	if truncated {
+		buf.AppendString(` sd_truncated="1"`)
+	}
+	buf.AppendByte(']')
+}
+
+// appendSDParamValue appends value to buf, escaping '"', '\' and ']' as
+// required by RFC5424 section 6.3.3.
+func appendSDParamValue(buf *buffer.Buffer, value string) {
+	last := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '"', '\\', ']':
+			buf.AppendString(value[last:i])
+			buf.AppendByte('\\')
+			last = i
+		}
+	}
+	buf.AppendString(value[last:])
+}
+
+// appendCallerSDElement appends the caller of ent as an SD-ELEMENT with the given SD-ID.
+func appendCallerSDElement(buf *buffer.Buffer, id string, caller zapcore.EntryCaller, maxValueLen int) {
+	buf.AppendByte('[')
+	buf.AppendString(id)
+	truncated := appendSDParam(buf, "file", trimCallerPath(caller.File), maxValueLen)
+	truncated = appendSDParam(buf, "line", strconv.Itoa(caller.Line), maxValueLen) || truncated
+	if fn := runtime.FuncForPC(caller.PC); fn != nil {
+		truncated = appendSDParam(buf, "func", fn.Name(), maxValueLen) || truncated
+	}
+	closeSDElement(buf, truncated)
+}
+
+// trimCallerPath keeps the last directory and the file name, like zapcore.ShortCallerEncoder does.
+func trimCallerPath(file string) string {
+	idx := strings.LastIndexByte(file, '/')
+	if idx == -1 {
+		return file
+	}
+	idx = strings.LastIndexByte(file[:idx], '/')
+	if idx == -1 {
+		return file
+	}
+	return file[idx+1:]
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"testing"
+
+	"github.com/imperfectgo/zap-syslog/internal/bufferpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestAppendSDParamValue(t *testing.T) {
+	fixtures := []struct {
+		s        string
+		expected string
+	}{
+		{s: "", expected: ""},
+		{s: "abc", expected: "abc"},
+		{s: `a"b`, expected: `a\"b`},
+		{s: `a\b`, expected: `a\\b`},
+		{s: `[a]`, expected: `[a\]`},
+		{s: `"\]`, expected: `\"\\\]`},
+	}
+
+	for _, f := range fixtures {
+		buf := bufferpool.Get()
+		appendSDParamValue(buf, f.s)
+		assert.Equal(t, f.expected, buf.String())
+		buf.Free()
+	}
+}
+
+func TestToSDName(t *testing.T) {
+	assert.Equal(t, "src@32473", toSDName("src@32473"))
+	assert.Equal(t, "a_b_c_d_", toSDName(`a=b c]d"`))
+	assert.Len(t, toSDName("0123456789012345678901234567890123456789"), maxSDNameLen)
+	assert.Len(t, toSDID("0123456789012345678901234567890123456789"), maxSDNameLen)
+	assert.Equal(t, "b5a3f2c1-1234-4abc-9def-0123456789ab@41058", toSDID("b5a3f2c1-1234-4abc-9def-0123456789ab@41058"))
+}
+
+func TestSyslogEncoderStructuredData(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.StructuredData = []SDElement{
+		NewTokenSDElement("b5a3f2c1-1234-4abc-9def-0123456789ab", 41058, "web", "prod"),
+		{ID: "meta", Params: []SDParam{{Name: "region", Value: `eu "west"`}, {Name: "", Value: "unnamed"}}},
+		{ID: "", Params: []SDParam{{Name: "k", Value: "no ID"}}},
+	}
+	buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+	assert.NoError(t, err)
+	defer buf.Free()
+	assert.NotContains(t, buf.String(), "unnamed", "Parameters without a name should be skipped.")
+	assert.NotContains(t, buf.String(), "no ID", "Elements without an ID should be skipped.")
+
+	assert.Contains(t, buf.String(), ` 9876 - [b5a3f2c1-1234-4abc-9def-0123456789ab@41058 tag="web" tag="prod"][meta region="eu \"west\""] `)
+}
+
+func TestAppendSDParamMaxValueLen(t *testing.T) {
+	fixtures := []struct {
+		value     string
+		maxLen    int
+		expected  string
+		truncated bool
+	}{
+		{"abcdef", 0, ` k="abcdef"`, false},
+		{"abcdef", 6, ` k="abcdef"`, false},
+		{"abcdef", 5, ` k="ab…"`, true},
+		{"aé€x", 5, ` k="a…"`, true},
+		{"aé€x", 6, ` k="aé…"`, true},
+		{`a"bcdef`, 5, ` k="a\"…"`, true},
+		{"abcdef", 3, ` k="…"`, true},
+		{"abcdef", 2, ` k="ab"`, true},
+		{"éa", 1, ` k=""`, true},
+	}
+	for _, f := range fixtures {
+		buf := bufferpool.Get()
+		assert.Equal(t, f.truncated, appendSDParam(buf, "k", f.value, f.maxLen), "%q cut to %d", f.value, f.maxLen)
+		assert.Equal(t, f.expected, buf.String(), "%q cut to %d", f.value, f.maxLen)
+		buf.Free()
+	}
+}
+
+func TestSyslogEncoderMaxSDParamValueLen(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.MaxSDParamValueLen = 8
+	cfg.StructuredData = []SDElement{
+		{ID: "a", Params: []SDParam{{Name: "short", Value: "ok"}}},
+		{ID: "b", Params: []SDParam{{Name: "long", Value: "0123456789"}, {Name: "short", Value: "ok"}}},
+	}
+	buf, err := NewSyslogEncoder(cfg).EncodeEntry(testEntry, nil)
+	assert.NoError(t, err)
+	defer buf.Free()
+
+	assert.Contains(t, buf.String(), ` 9876 - [a short="ok"][b long="01234…" short="ok" sd_truncated="1"] `)
+}
+
+func TestValidRawSD(t *testing.T) {
+	for _, sd := range []string{`[a]`, `[a b="c"][d@32473 e="f\]"]`} {
+		assert.True(t, validRawSD(sd), sd)
+	}
+	for _, sd := range []string{``, `-`, `a`, `[a`, `[a b=c]`, `[a] `, `[a] x`, `[a]-`} {
+		assert.False(t, validRawSD(sd), sd)
+	}
+}
+
+func TestSyslogEncoderRawSD(t *testing.T) {
+	cfg := testEncoderConfig(DefaultFraming)
+	cfg.StructuredData = []SDElement{{ID: "static"}}
+	enc := NewSyslogEncoder(cfg)
+
+	with := enc.Clone()
+	RawSD(`[with@32473 a="b"]`).AddTo(with)
+	RawSD(`not sd`).AddTo(with)
+
+	buf, err := with.EncodeEntry(testEntry, []zapcore.Field{RawSD(`[entry k="v"]`), zap.Int("int", 1), RawSD(`[bad`)})
+	require.NoError(t, err)
+	defer buf.Free()
+	assert.Contains(t, buf.String(), ` 9876 - [static][with@32473 a="b"][entry k="v"] `)
+	assert.Contains(t, buf.String(), `{"msg":"fake","rawSD":"not sd","int":1,"rawSD":"[bad"}`)
+
+	buf2, err := enc.EncodeEntry(testEntry, nil)
+	require.NoError(t, err)
+	defer buf2.Free()
+	assert.Contains(t, buf2.String(), ` 9876 - [static] `, "The parent encoder shouldn't be affected.")
+}
@@ -21,27 +21,108 @@
 package zapsyslog
 
 import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+const defaultWriteRetries = 1
+
 var (
 	_ zapcore.WriteSyncer = &ConnSyncer{}
 )
 
-// ConnSyncer describes connection sink for syslog.
+// ConnSyncer describes connection sink for syslog. It's safe for concurrent
+// use, writes and reconnections are serialized internally so that messages
+// are never interleaved on stream connections, without zapcore.Lock.
 type ConnSyncer struct {
+	mu      sync.Mutex
 	network string
 	raddr   string
+	zone    string
 	conn    net.Conn
+	budget  *RetryBudget
+	retries int
+
+	// classRetries overrides retries per ErrorClass, unless negative
+	classRetries [numErrorClasses]int
+
+	// See WithBudgetReset, budgetReset is set once done for the connection
+	budgetResetAfter time.Duration
+	budgetReset      bool
+
+	maxSize int
+	maxAge  time.Duration
+	maxMsgs int
+	sendBuf int
+
+	// Messages written on the current connection, see WithMaxConnMessages
+	sent int
+
+	connectedAt time.Time
+
+	tls           *tlsSettings
+	tlsConfig     *tls.Config
+	proxyProtocol bool
+	dialer        Dialer
+
+	// Buffering for stream connections, see WithWriteBuffer
+	bufSize int
+	flushAt int
+	bw      *bufio.Writer
+
+	closed bool
+
+	// Outcome of the latest writes, see LastError and LastSuccess
+	lastErr     error
+	lastErrAt   time.Time
+	lastSuccess time.Time
+
+	stats   Stats
+	latency LatencyStats
+	errLog  *zap.Logger
 }
 
 // NewConnSyncer returns a new conn sink for syslog.
-func NewConnSyncer(network, raddr string) (*ConnSyncer, error) {
+func NewConnSyncer(network, raddr string, opts ...SyncerOption) (*ConnSyncer, error) {
 	s := &ConnSyncer{
 		network: network,
 		raddr:   raddr,
+		retries: defaultWriteRetries,
+		errLog:  zap.NewNop(),
+	}
+	s.classRetries = [numErrorClasses]int{ResetErrors: -1, TimeoutErrors: 0, OtherErrors: -1}
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+	if s.zone != "" {
+		raddr, err := zonedAddr(s.raddr, s.zone)
+		if err != nil {
+			return nil, err
+		}
+		s.raddr = raddr
+	}
+	if s.tls != nil {
+		cfg, err := s.tls.build()
+		if err != nil {
+			return nil, err
+		}
+		if s.zone != "" && cfg.ServerName == "" {
+			// Certificates can't carry the zone, verify the bare IP
+			cfg = cfg.Clone()
+			cfg.ServerName, _, _ = strings.Cut(s.raddr[1:], "%")
+		}
+		s.tlsConfig = cfg
 	}
 
 	err := s.connect()
@@ -52,39 +133,293 @@ func NewConnSyncer(network, raddr string) (*ConnSyncer, error) {
 	return s, nil
 }
 
+// zonedAddr returns raddr with the IPv6 zone set, see WithIPv6Zone.
+func zonedAddr(raddr, zone string) (string, error) {
+	host, port, err := net.SplitHostPort(raddr)
+	if err != nil {
+		return "", err
+	}
+	ip, z, _ := strings.Cut(host, "%")
+	if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() != nil {
+		return "", fmt.Errorf("zapsyslog: IPv6 zone set for non-IPv6 address %q", raddr)
+	}
+	if z != "" && z != zone {
+		return "", fmt.Errorf("zapsyslog: address %q already has zone %q", raddr, z)
+	}
+	return net.JoinHostPort(ip+"%"+zone, port), nil
+}
+
 // connect makes a connection to the syslog server.
 func (s *ConnSyncer) connect() error {
+	s.closeConn()
+
+	var c net.Conn
+	c, err := s.dial()
+	if err != nil {
+		return err
+	}
+
+	if s.sendBuf > 0 {
+		s.setSendBuffer(c)
+	}
+	if s.stats != nil && !s.connectedAt.IsZero() {
+		s.stats.Reconnected()
+	}
+	s.conn = c
+	s.connectedAt = time.Now()
+	s.sent = 0
+	s.budgetReset = false
+	if s.bufSize > 0 && isStreamNetwork(s.network) {
+		s.bw = bufio.NewWriterSize(c, s.bufSize)
+	}
+	return nil
+}
+
+// setSendBuffer sets SO_SNDBUF on c, or on the connection under it for TLS.
+func (s *ConnSyncer) setSendBuffer(c net.Conn) {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	wb, ok := c.(interface{ SetWriteBuffer(int) error })
+	if !ok {
+		return
+	}
+	if err := wb.SetWriteBuffer(s.sendBuf); err != nil {
+		s.errLog.Warn("zapsyslog: setting the send buffer size failed", zap.Int("size", s.sendBuf), zap.Error(err))
+	}
+}
+
+// closeConn closes the current connection, messages still buffered are lost.
+func (s *ConnSyncer) closeConn() {
 	if s.conn != nil {
 		// ignore err from close, it makes sense to continue anyway
 		s.conn.Close()
 		s.conn = nil
 	}
+	s.bw = nil
+}
+
+// write writes p to the current connection, through the buffer if any. A
+// short write fails with io.ErrShortWrite, even if the connection didn't
+// report it, so that the message is retried whole on a new connection.
+func (s *ConnSyncer) write(p []byte) (int, error) {
+	if s.bw == nil {
+		n, err := s.conn.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		return n, err
+	}
+
+	n, err := s.bw.Write(p)
+	if err == nil && s.bw.Buffered() >= s.flushAt {
+		err = s.bw.Flush()
+	}
+	return n, err
+}
+
+func isStreamNetwork(network string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return true
+	}
+	return false
+}
+
+// dial connects to raddr, local sockets are tried with both socket types
+// since the syslog daemon may listen on either of them.
+func (s *ConnSyncer) dial() (net.Conn, error) {
+	if s.dialer != nil {
+		return s.dialer(s.network, s.raddr)
+	}
+	if s.proxyProtocol && isStreamNetwork(s.network) && s.network != "unix" {
+		return s.dialProxy()
+	}
+	if s.tlsConfig != nil {
+		return tls.DialWithDialer(&net.Dialer{}, s.network, s.raddr, s.tlsConfig)
+	}
 
-	var c net.Conn
 	c, err := net.Dial(s.network, s.raddr)
-	if err != nil {
-		return err
+	if err == nil {
+		return c, nil
 	}
 
-	s.conn = c
-	return nil
+	var fallback string
+	switch s.network {
+	case "unix":
+		fallback = "unixgram"
+	case "unixgram":
+		fallback = "unix"
+	default:
+		return nil, err
+	}
+
+	c, fallbackErr := net.Dial(fallback, s.raddr)
+	if fallbackErr != nil {
+		return nil, err
+	}
+	// Remember the socket type that works, for later reconnections
+	s.network = fallback
+	return c, nil
 }
 
-// Write writes to syslog with retry.
+// Write writes to syslog, reconnecting and retrying up to the configured
+// number of times on failure. Messages are written whole or not at all: a
+// retry sends the whole message again on a new connection, and a failed
+// Write returns 0.
+//
+// The returned errors match ErrNotConnected, ErrDropped, ErrMessageTooLarge
+// or ErrCircuitOpen with errors.Is.
 func (s *ConnSyncer) Write(p []byte) (n int, err error) {
-	if s.conn != nil {
-		if n, err := s.conn.Write(p); err == nil {
-			return n, err
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stats != nil {
+		start := time.Now()
+		defer func() { s.observeWrite(start, n, err) }()
+	}
+	defer func() {
+		if err != nil {
+			s.setLastError(err)
+			s.errLog.Error("zapsyslog: message dropped", zap.Int("size", len(p)), zap.Error(err))
+		} else {
+			s.lastSuccess = time.Now()
 		}
+	}()
+
+	if s.maxSize > 0 && len(p) > s.maxSize {
+		return 0, newSyncerError(ErrMessageTooLarge, nil)
 	}
-	if err := s.connect(); err != nil {
-		return 0, err
+	if s.conn != nil && s.expired() {
+		// Rotate the connection, flushing what's buffered for the old one
+		if s.bw != nil {
+			s.bw.Flush()
+		}
+		s.closeConn()
 	}
 
-	return s.conn.Write(p)
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			if s.closed {
+				return 0, newSyncerError(ErrNotConnected, errSyncerClosed)
+			}
+			if s.budget != nil && !s.budget.Allow() {
+				return 0, newSyncerError(ErrCircuitOpen, nil)
+			}
+			if err = s.connect(); err != nil {
+				s.errLog.Warn("zapsyslog: reconnection failed",
+					zap.String("network", s.network), zap.String("address", s.raddr), zap.Error(err))
+				err = newSyncerError(ErrNotConnected, err)
+				if IsPermanent(err) || attempt >= s.retriesFor(err) {
+					return 0, err
+				}
+				continue
+			}
+		}
+
+		if n, err = s.write(p); err == nil {
+			s.sent++
+			s.maybeResetBudget()
+			return n, nil
+		}
+		if errors.Is(err, syscall.EMSGSIZE) {
+			// Retrying won't help
+			return 0, newSyncerError(ErrMessageTooLarge, err)
+		}
+		err = newSyncerError(ErrDropped, err)
+		// Drop the broken connection so that the next attempt reconnects
+		s.closeConn()
+		if attempt >= s.retriesFor(err) {
+			return 0, err
+		}
+	}
 }
 
-// Sync implements zapcore.WriteSyncer interface.
+// expired tells whether the connection is due for rotation, see
+// WithMaxConnAge and WithMaxConnMessages.
+func (s *ConnSyncer) expired() bool {
+	if s.maxAge > 0 && time.Since(s.connectedAt) >= s.maxAge {
+		return true
+	}
+	return s.maxMsgs > 0 && s.sent >= s.maxMsgs
+}
+
+// retriesFor returns how many in-line retries the class of err allows.
+func (s *ConnSyncer) retriesFor(err error) int {
+	if n := s.classRetries[ClassifyError(err)]; n >= 0 {
+		return n
+	}
+	return s.retries
+}
+
+// maybeResetBudget resets the retry budget if the connection has been up long
+// enough, once per connection.
+func (s *ConnSyncer) maybeResetBudget() {
+	if s.budget == nil || s.budgetResetAfter <= 0 || s.budgetReset {
+		return
+	}
+	if time.Since(s.connectedAt) >= s.budgetResetAfter {
+		s.budget.Reset()
+		s.budgetReset = true
+	}
+}
+
+// Sync implements zapcore.WriteSyncer interface, it flushes buffered messages
+// so that they hit the wire before returning.
 func (s *ConnSyncer) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bw == nil {
+		return nil
+	}
+	if err := s.bw.Flush(); err != nil {
+		s.errLog.Error("zapsyslog: buffered messages dropped", zap.Error(err))
+		s.closeConn()
+		err = newSyncerError(ErrDropped, err)
+		s.setLastError(err)
+		return err
+	}
 	return nil
 }
+
+func (s *ConnSyncer) setLastError(err error) {
+	s.lastErr = err
+	s.lastErrAt = time.Now()
+}
+
+// LastError returns the latest error from Write or Sync and when it
+// happened, or a nil error if there has been none. It's not reset by later
+// successful writes, compare its time with LastSuccess to tell whether the
+// syncer has recovered.
+func (s *ConnSyncer) LastError() (error, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr, s.lastErrAt
+}
+
+// LastSuccess returns when a message was last written successfully, or the
+// zero time if none has been. Buffered messages count as written once they
+// are in the buffer.
+func (s *ConnSyncer) LastSuccess() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSuccess
+}
+
+// Close flushes buffered messages and closes the connection, later writes
+// fail with ErrNotConnected.
+func (s *ConnSyncer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.bw != nil {
+		if err = s.bw.Flush(); err != nil {
+			err = newSyncerError(ErrDropped, err)
+		}
+	}
+	s.closeConn()
+	s.closed = true
+	return err
+}
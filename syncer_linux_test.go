@@ -0,0 +1,62 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func sendBufferSize(t *testing.T, c net.Conn) int {
+	raw, err := c.(syscall.Conn).SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn() failed: %v", err)
+	}
+	var size int
+	var sockErr error
+	raw.Control(func(fd uintptr) {
+		size, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	})
+	if sockErr != nil {
+		t.Fatalf("GetsockoptInt() failed: %v", sockErr)
+	}
+	return size
+}
+
+func TestSendBuffer(t *testing.T) {
+	for _, network := range []string{"udp", "unixgram"} {
+		done := make(chan string, 1)
+		addr, sock, srvWG := startServer(network, "", done)
+
+		s, err := NewConnSyncer(network, addr, WithSendBuffer(8192))
+		if err != nil {
+			t.Fatalf("NewConnSyncer() failed: %v", err)
+		}
+		// Linux doubles the size for its bookkeeping
+		if size := sendBufferSize(t, s.conn); size != 2*8192 {
+			t.Errorf("%s: expected a send buffer of %d bytes, actual: %d", network, 2*8192, size)
+		}
+		s.Close()
+		sock.Close()
+		srvWG.Wait()
+	}
+}
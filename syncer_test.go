@@ -22,14 +22,23 @@ package zapsyslog
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 var (
@@ -272,3 +281,617 @@ func TestSync(t *testing.T) {
 		t.Fatalf("Sync() should always returns nil")
 	}
 }
+
+func TestUnixSocketFallback(t *testing.T) {
+	for _, n := range []string{"unix", "unixgram"} {
+		done := make(chan string, 1)
+		addr, sock, srvWG := startServer(n, "", done)
+
+		fallback := "unixgram"
+		if n == "unixgram" {
+			fallback = "unix"
+		}
+		s, err := NewConnSyncer(fallback, addr)
+		if err != nil {
+			t.Fatalf("NewConnSyncer() failed: %v", err)
+		}
+		if s.network != n {
+			t.Errorf("expected network %q, actual %q", n, s.network)
+		}
+		if _, err := io.WriteString(s, testMessage+"\n"); err != nil {
+			t.Fatalf("WriteString() failed: %v", err)
+		}
+		if rcvd := <-done; rcvd != testMessage+"\n" {
+			t.Errorf("message didn't match: expected=%q, actual=%q", testMessage+"\n", rcvd)
+		}
+		s.conn.Close()
+		sock.Close()
+		srvWG.Wait()
+		os.Remove(addr)
+	}
+}
+
+func TestRetryBudgetExhausted(t *testing.T) {
+	addr, sock, srvWG := startServer("tcp", "", make(chan string, 1))
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	s, err := NewConnSyncer("tcp", addr, WithRetryBudget(NewRetryBudget(0, 1)))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	// The first reconnection consumes the budget
+	s.conn.Close()
+	if _, err := io.WriteString(s, testMessage); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+
+	s.conn.Close()
+	if _, err := io.WriteString(s, testMessage); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("WriteString() should fail fast once the budget is exhausted, actual: %v", err)
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func TestWriteRetries(t *testing.T) {
+	done := make(chan string, 1)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	s, err := NewConnSyncer("tcp", addr, WithWriteRetries(0))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+
+	// Without retries, the write on the broken connection fails...
+	s.conn.Close()
+	if _, err := io.WriteString(s, testMessage+"\n"); !errors.Is(err, ErrDropped) {
+		t.Fatalf("WriteString() should fail without retries, actual: %v", err)
+	}
+	// ...and the next one reconnects
+	if _, err := io.WriteString(s, testMessage+"\n"); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	if rcvd := <-done; rcvd != testMessage+"\n" {
+		t.Errorf("message didn't match: expected=%q, actual=%q", testMessage+"\n", rcvd)
+	}
+	s.conn.Close()
+}
+
+func TestWriteErrors(t *testing.T) {
+	addr, sock, srvWG := startServer("tcp", "", make(chan string, 1))
+	s, err := NewConnSyncer("tcp", addr, WithMaxMessageSize(len(testMessage)-1))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+
+	_, err = io.WriteString(s, testMessage)
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("WriteString() should fail with ErrMessageTooLarge, actual: %v", err)
+	}
+
+	sock.Close()
+	s.conn.Close()
+	srvWG.Wait()
+	_, err = io.WriteString(s, "<14>1")
+	if !errors.Is(err, ErrNotConnected) {
+		t.Errorf("WriteString() should fail with ErrNotConnected, actual: %v", err)
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		t.Errorf("ErrNotConnected should wrap the dial error, actual: %v", err)
+	}
+}
+
+func TestBudgetReset(t *testing.T) {
+	done := make(chan string, 10)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	budget := NewRetryBudget(0, 1)
+	s, err := NewConnSyncer("tcp", addr, WithRetryBudget(budget), WithBudgetReset(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.Close()
+
+	// The reconnection drains the budget, which the stable connection resets
+	s.conn.Close()
+	if _, err := io.WriteString(s, testMessage+"\n"); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := io.WriteString(s, testMessage+"\n"); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+
+	s.conn.Close()
+	if _, err := io.WriteString(s, testMessage+"\n"); err != nil {
+		t.Fatalf("WriteString() should reconnect with the reset budget, got: %v", err)
+	}
+	s.conn.Close()
+	if _, err := io.WriteString(s, testMessage+"\n"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("WriteString() should fail fast before the connection is stable, actual: %v", err)
+	}
+}
+
+func TestErrorLogger(t *testing.T) {
+	addr, sock, srvWG := startServer("tcp", "", make(chan string, 1))
+	core, logs := observer.New(zapcore.DebugLevel)
+	s, err := NewConnSyncer("tcp", addr, WithErrorLogger(zap.New(core)))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+
+	sock.Close()
+	s.conn.Close()
+	srvWG.Wait()
+	if _, err := io.WriteString(s, "<14>1"); err == nil {
+		t.Fatal("WriteString() should fail once the server is gone")
+	}
+
+	var messages []string
+	for _, e := range logs.AllUntimed() {
+		messages = append(messages, e.Message)
+	}
+	expected := []string{"zapsyslog: reconnection failed", "zapsyslog: message dropped"}
+	if len(messages) != 2 || messages[0] != expected[0] || messages[1] != expected[1] {
+		t.Fatalf("Expected logs: %q, actual: %q", expected, messages)
+	}
+	if dropped := logs.AllUntimed()[1]; dropped.Level != zapcore.ErrorLevel || dropped.ContextMap()["size"] != int64(5) {
+		t.Errorf("Unexpected dropped message log: %+v", dropped)
+	}
+}
+
+func TestLastErrorAndSuccess(t *testing.T) {
+	done := make(chan string, 1)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	s, err := NewConnSyncer("tcp", addr)
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	if err, at := s.LastError(); err != nil || !at.IsZero() || !s.LastSuccess().IsZero() {
+		t.Fatalf("Expected no outcome before the first write, got: %v, %v, %v", err, at, s.LastSuccess())
+	}
+
+	if _, err := io.WriteString(s, testMessage+"\n"); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	<-done
+	success := s.LastSuccess()
+	if success.IsZero() {
+		t.Fatal("LastSuccess() should be set after a successful write")
+	}
+	if err, _ := s.LastError(); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	sock.Close()
+	s.conn.Close()
+	srvWG.Wait()
+	if _, err := io.WriteString(s, testMessage+"\n"); err == nil {
+		t.Fatal("WriteString() should fail once the server is gone")
+	}
+	lastErr, at := s.LastError()
+	if !errors.Is(lastErr, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got: %v", lastErr)
+	}
+	if at.Before(success) {
+		t.Errorf("Error time %v should not precede the last success %v", at, success)
+	}
+	if !s.LastSuccess().Equal(success) {
+		t.Errorf("LastSuccess() shouldn't change on failure, expected: %v, actual: %v", success, s.LastSuccess())
+	}
+}
+
+func TestWriteBuffer(t *testing.T) {
+	done := make(chan string, 3)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	msg := testMessage + "\n"
+	s, err := NewConnSyncer("tcp", addr, WithWriteBuffer(4096, 2*len(msg)))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.closeConn()
+
+	if _, err := io.WriteString(s, msg); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	select {
+	case rcvd := <-done:
+		t.Fatalf("message should be buffered below the flush threshold, got: %q", rcvd)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := io.WriteString(s, msg); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if rcvd := <-done; rcvd != msg {
+			t.Errorf("message didn't match: expected=%q, actual=%q", msg, rcvd)
+		}
+	}
+}
+
+func TestSyncFlushesWriteBuffer(t *testing.T) {
+	done := make(chan string, 1)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	msg := testMessage + "\n"
+	s, err := NewConnSyncer("tcp", addr, WithWriteBuffer(4096, 0))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.closeConn()
+
+	if _, err := io.WriteString(s, msg); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	if err := s.Sync(); err != nil {
+		t.Fatalf("Sync() failed: %v", err)
+	}
+	select {
+	case rcvd := <-done:
+		if rcvd != msg {
+			t.Errorf("message didn't match: expected=%q, actual=%q", msg, rcvd)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Sync() should flush buffered messages")
+	}
+}
+
+func TestMaxConnAge(t *testing.T) {
+	done := make(chan string, 2)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	msg := testMessage + "\n"
+	s, err := NewConnSyncer("tcp", addr, WithMaxConnAge(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.closeConn()
+
+	first := s.conn
+	if _, err := io.WriteString(s, msg); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	if s.conn != first {
+		t.Fatal("connection should not be rotated before its max age")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := io.WriteString(s, msg); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	if s.conn == first {
+		t.Fatal("connection should be rotated after its max age")
+	}
+	for i := 0; i < 2; i++ {
+		if rcvd := <-done; rcvd != msg {
+			t.Errorf("message didn't match: expected=%q, actual=%q", msg, rcvd)
+		}
+	}
+}
+
+func TestMaxConnMessages(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() failed: %v", err)
+	}
+	defer l.Close()
+
+	s, err := NewConnSyncer("udp", l.LocalAddr().String(), WithMaxConnMessages(2))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.Close()
+
+	var sources []string
+	buf := make([]byte, 1024)
+	for i := 0; i < 4; i++ {
+		if _, err := io.WriteString(s, testMessage); err != nil {
+			t.Fatalf("WriteString() failed: %v", err)
+		}
+		l.SetReadDeadline(time.Now().Add(time.Second))
+		_, from, err := l.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom() failed: %v", err)
+		}
+		sources = append(sources, from.String())
+	}
+	if sources[0] != sources[1] || sources[2] != sources[3] {
+		t.Errorf("socket should be kept for 2 messages, sources: %v", sources)
+	}
+	if sources[1] == sources[2] {
+		t.Errorf("socket should be rebound after 2 messages, sources: %v", sources)
+	}
+}
+
+func TestZonedAddr(t *testing.T) {
+	tests := []struct {
+		raddr, zone string
+		expected    string
+		err         bool
+	}{
+		{"[fe80::1]:514", "eth0", "[fe80::1%eth0]:514", false},
+		{"[fe80::1%eth0]:514", "eth0", "[fe80::1%eth0]:514", false},
+		{"[fe80::1%eth1]:514", "eth0", "", true},
+		{"192.0.2.1:514", "eth0", "", true},
+		{"syslog.example.com:514", "eth0", "", true},
+		{"fe80::1", "eth0", "", true},
+	}
+	for _, tt := range tests {
+		actual, err := zonedAddr(tt.raddr, tt.zone)
+		if (err != nil) != tt.err {
+			t.Errorf("zonedAddr(%q, %q) error = %v, expected error: %t", tt.raddr, tt.zone, err, tt.err)
+		}
+		if actual != tt.expected {
+			t.Errorf("zonedAddr(%q, %q) = %q, expected %q", tt.raddr, tt.zone, actual, tt.expected)
+		}
+	}
+}
+
+func TestIPv6Zone(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatalf("Interfaces() failed: %v", err)
+	}
+	var lo string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			lo = iface.Name
+		}
+	}
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil || lo == "" {
+		t.Skip("IPv6 loopback not available")
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(ioutil.Discard, c)
+		}
+	}()
+
+	s, err := NewConnSyncer("tcp", l.Addr().String(), WithIPv6Zone(lo))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.Close()
+	expected := "[::1%" + lo + "]"
+	if !strings.HasPrefix(s.raddr, expected) {
+		t.Errorf("expected address with zone %s, actual %s", expected, s.raddr)
+	}
+	// Reconnections dial the zoned address
+	s.closeConn()
+	if _, err := io.WriteString(s, testMessage+"\n"); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+}
+
+func TestDialer(t *testing.T) {
+	var dials []string
+	dial := func(network, raddr string) (net.Conn, error) {
+		dials = append(dials, network+" "+raddr)
+		c, srv := net.Pipe()
+		go io.Copy(ioutil.Discard, srv)
+		return c, nil
+	}
+	s, err := NewConnSyncer("udp", "collector:6514", WithDialer(dial))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.Close()
+	// Reconnections use the dialer too
+	s.closeConn()
+	if _, err := io.WriteString(s, testMessage+"\n"); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	if expected := []string{"udp collector:6514", "udp collector:6514"}; !reflect.DeepEqual(dials, expected) {
+		t.Errorf("expected dials %q, actual %q", expected, dials)
+	}
+}
+
+func TestConcurrentReconnectSharedSyncer(t *testing.T) {
+	addr, sock, srvWG := startServer("tcp", "", make(chan string, 1000))
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	s, err := NewConnSyncer("tcp", addr)
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if j%3 == 0 {
+					// Break the connection under the lock, writes must reconnect
+					s.mu.Lock()
+					s.conn.Close()
+					s.mu.Unlock()
+				}
+				if _, err := io.WriteString(s, testMessage+"\n"); err != nil {
+					t.Errorf("WriteString() failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	s.closeConn()
+	s.mu.Unlock()
+}
+
+func TestConcurrentWritesDontInterleave(t *testing.T) {
+	const writers, messages = 8, 50
+	done := make(chan string, writers*messages)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	for _, opts := range [][]SyncerOption{nil, {WithWriteBuffer(4096, 2048)}} {
+		s, err := NewConnSyncer("tcp", addr, opts...)
+		if err != nil {
+			t.Fatalf("NewConnSyncer() failed: %v", err)
+		}
+
+		// Messages larger than the socket and write buffers, written without
+		// zapcore.Lock
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				msg := strings.Repeat(strconv.Itoa(i), 64<<10) + "\n"
+				for j := 0; j < messages; j++ {
+					if _, err := io.WriteString(s, msg); err != nil {
+						t.Errorf("WriteString() failed: %v", err)
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		if err := s.Close(); err != nil {
+			t.Fatalf("Close() failed: %v", err)
+		}
+
+		for i := 0; i < writers*messages; i++ {
+			rcvd := <-done
+			if len(rcvd) != 64<<10+1 || strings.Trim(rcvd[:len(rcvd)-1], rcvd[:1]) != "" {
+				t.Fatalf("message %d was interleaved with others", i)
+			}
+		}
+	}
+}
+
+// shortWriteConn writes half of each message without reporting an error.
+type shortWriteConn struct {
+	net.Conn
+}
+
+func (c shortWriteConn) Write(p []byte) (int, error) {
+	return c.Conn.Write(p[:len(p)/2])
+}
+
+func TestShortWriteRetriesWholeMessage(t *testing.T) {
+	done := make(chan string, 2)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	s, err := NewConnSyncer("tcp", addr)
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.Close()
+	s.conn = shortWriteConn{s.conn}
+
+	msg := testMessage + "\n"
+	n, err := io.WriteString(s, msg)
+	if err != nil || n != len(msg) {
+		t.Fatalf("WriteString() = %d, %v, expected %d, nil", n, err, len(msg))
+	}
+	// The truncated message is never completed on the broken connection
+	if rcvd := <-done; rcvd != msg {
+		t.Errorf("message didn't match: expected=%q, actual=%q", msg, rcvd)
+	}
+	if _, ok := s.conn.(shortWriteConn); ok {
+		t.Error("the connection should be replaced after a short write")
+	}
+}
+
+// failingConn fails every write with err.
+type failingConn struct {
+	net.Conn
+	err error
+}
+
+func (c failingConn) Write(p []byte) (int, error) {
+	return 0, c.err
+}
+
+func TestClassRetries(t *testing.T) {
+	done := make(chan string, 1)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	timeout := &net.OpError{Op: "write", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	reset := &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.ECONNRESET)}
+	tests := []struct {
+		err     error
+		opts    []SyncerOption
+		retried bool
+	}{
+		{reset, nil, true},
+		{timeout, nil, false},
+		{reset, []SyncerOption{WithClassRetries(ResetErrors, 0)}, false},
+		{timeout, []SyncerOption{WithClassRetries(TimeoutErrors, 1)}, true},
+		{reset, []SyncerOption{WithWriteRetries(0)}, false},
+	}
+	for _, tt := range tests {
+		s, err := NewConnSyncer("tcp", addr, tt.opts...)
+		if err != nil {
+			t.Fatalf("NewConnSyncer() failed: %v", err)
+		}
+		s.conn = failingConn{s.conn, tt.err}
+
+		_, err = s.Write([]byte(testMessage + "\n"))
+		if tt.retried {
+			if err != nil {
+				t.Errorf("Write() after %v should be retried, failed: %v", tt.err, err)
+			}
+			<-done
+		} else if !errors.Is(err, ErrDropped) {
+			t.Errorf("Write() after %v shouldn't be retried, expected ErrDropped, actual: %v", tt.err, err)
+		}
+		s.Close()
+	}
+}
+
+func TestClose(t *testing.T) {
+	done := make(chan string)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	s, err := NewConnSyncer("tcp", addr, WithWriteBuffer(4096, 4096))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	if _, err := s.Write([]byte("buffered\n")); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if rcvd := <-done; rcvd != "buffered\n" {
+		t.Fatalf("Expected %q, actual: %q", "buffered\n", rcvd)
+	}
+
+	if _, err := s.Write([]byte("late\n")); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("Expected ErrNotConnected after Close(), actual: %v", err)
+	}
+}
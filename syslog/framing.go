@@ -0,0 +1,51 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+const maxFrameLenDigits = 9
+
+// ErrInvalidFrame is returned by ScanFrames on a malformed MSG-LEN.
+var ErrInvalidFrame = errors.New("syslog: invalid octet-counting frame")
+
+// ScanFrames is a bufio.SplitFunc splitting an RFC6587 stream into messages.
+// Octet-counting frames are detected by their leading digit, others are
+// taken as non-transparent frames terminated by LF, so both may be mixed.
+func ScanFrames(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if data[0] >= '1' && data[0] <= '9' {
+		sp := bytes.IndexByte(data, ' ')
+		if sp < 0 {
+			if len(data) > maxFrameLenDigits || atEOF {
+				return 0, nil, ErrInvalidFrame
+			}
+			return 0, nil, nil
+		}
+		n, err := strconv.Atoi(string(data[:sp]))
+		if err != nil || sp > maxFrameLenDigits {
+			return 0, nil, ErrInvalidFrame
+		}
+		end := sp + 1 + n
+		if len(data) < end {
+			if atEOF {
+				return 0, nil, ErrInvalidFrame
+			}
+			return 0, nil, nil
+		}
+		return end, data[sp+1 : end], nil
+	}
+
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,36 @@
+package syslog
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestScanFrames(t *testing.T) {
+	s := bufio.NewScanner(strings.NewReader("5 hello<13>1 a\n<13>1 b\n10 two\nlines\n<13>1 c"))
+	s.Split(ScanFrames)
+
+	var frames []string
+	for s.Scan() {
+		frames = append(frames, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []string{"hello", "<13>1 a", "<13>1 b", "two\nlines\n", "<13>1 c"}
+	if strings.Join(frames, "|") != strings.Join(expected, "|") {
+		t.Fatalf("Expected frames: %q, actual: %q", expected, frames)
+	}
+}
+
+func TestScanFramesTruncated(t *testing.T) {
+	s := bufio.NewScanner(strings.NewReader("10 short"))
+	s.Split(ScanFrames)
+	if s.Scan() {
+		t.Fatalf("Expected no frame, actual: %q", s.Text())
+	}
+	if s.Err() != ErrInvalidFrame {
+		t.Fatalf("Expected ErrInvalidFrame, actual: %v", s.Err())
+	}
+}
@@ -0,0 +1,352 @@
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	nilValue   = "-"
+	maxPri     = 191
+	utf8BOM    = "\xef\xbb\xbf"
+	maxFracLen = 6
+)
+
+// Message is a parsed RFC5424 syslog message, nil header values are kept as
+// "-".
+type Message struct {
+	Priority       Priority
+	Version        int
+	Timestamp      time.Time // zero for the nil value
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData []SDElement
+	Msg            []byte // without the BOM
+	BOM            bool
+}
+
+// Severity returns the severity part of the priority.
+func (m *Message) Severity() Priority {
+	return m.Priority & severityMask
+}
+
+// Facility returns the facility part of the priority.
+func (m *Message) Facility() Priority {
+	return m.Priority & facilityMask
+}
+
+// SDElement is a parsed STRUCTURED-DATA element.
+type SDElement struct {
+	ID     string
+	Params []SDParam
+}
+
+// SDParam is a parameter of an SDElement, values are unescaped.
+type SDParam struct {
+	Name  string
+	Value string
+}
+
+// ParseError reports which part of a message is malformed, and where.
+type ParseError struct {
+	Field  string
+	Offset int
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("syslog: invalid %s at offset %d: %s", e.Field, e.Offset, e.Reason)
+}
+
+// ParseMessage parses b as an RFC5424 message, without transport framing.
+// Errors are of type *ParseError. Enterprise-specific SD-IDs longer than 32
+// characters are accepted, as used by hosted providers.
+func ParseMessage(b []byte) (*Message, error) {
+	p := &parser{b: b}
+	m := &Message{}
+	var err error
+
+	if m.Priority, err = p.pri(); err != nil {
+		return nil, err
+	}
+	if m.Version, err = p.version(); err != nil {
+		return nil, err
+	}
+	if err = p.sp("VERSION"); err != nil {
+		return nil, err
+	}
+	if m.Timestamp, err = p.timestamp(); err != nil {
+		return nil, err
+	}
+	for _, f := range []struct {
+		name   string
+		maxLen int
+		dst    *string
+	}{
+		{"HOSTNAME", 255, &m.Hostname},
+		{"APP-NAME", 48, &m.AppName},
+		{"PROCID", 128, &m.ProcID},
+		{"MSGID", 32, &m.MsgID},
+	} {
+		if err = p.sp(f.name); err != nil {
+			return nil, err
+		}
+		if *f.dst, err = p.headerField(f.name, f.maxLen); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.sp("STRUCTURED-DATA"); err != nil {
+		return nil, err
+	}
+	if m.StructuredData, err = p.structuredData(); err != nil {
+		return nil, err
+	}
+
+	if p.eof() {
+		return m, nil
+	}
+	if err = p.sp("MSG"); err != nil {
+		return nil, err
+	}
+	msg := b[p.i:]
+	if bytes.HasPrefix(msg, []byte(utf8BOM)) {
+		m.BOM = true
+		msg = msg[len(utf8BOM):]
+		if !utf8.Valid(msg) {
+			return nil, p.errorf("MSG", "invalid UTF-8 after BOM")
+		}
+	}
+	m.Msg = msg
+	return m, nil
+}
+
+type parser struct {
+	b []byte
+	i int
+}
+
+func (p *parser) eof() bool {
+	return p.i >= len(p.b)
+}
+
+func (p *parser) errorf(field, format string, args ...interface{}) error {
+	return &ParseError{Field: field, Offset: p.i, Reason: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) sp(field string) error {
+	if p.eof() || p.b[p.i] != ' ' {
+		return p.errorf(field, "expected SP")
+	}
+	p.i++
+	return nil
+}
+
+func (p *parser) pri() (Priority, error) {
+	if p.eof() || p.b[p.i] != '<' {
+		return 0, p.errorf("PRI", "expected '<'")
+	}
+	p.i++
+	start := p.i
+	for !p.eof() && p.i-start < 4 && isDigit(p.b[p.i]) {
+		p.i++
+	}
+	n := p.i - start
+	if n == 0 || n > 3 || p.eof() || p.b[p.i] != '>' {
+		return 0, p.errorf("PRI", "expected 1 to 3 digits and '>'")
+	}
+	if n > 1 && p.b[start] == '0' {
+		return 0, p.errorf("PRI", "leading zero")
+	}
+	v, _ := strconv.Atoi(string(p.b[start:p.i]))
+	if v > maxPri {
+		return 0, p.errorf("PRI", "value %d out of range", v)
+	}
+	p.i++
+	return Priority(v), nil
+}
+
+func (p *parser) version() (int, error) {
+	start := p.i
+	for !p.eof() && isDigit(p.b[p.i]) {
+		p.i++
+	}
+	n := p.i - start
+	if n == 0 || n > 3 || p.b[start] == '0' {
+		p.i = start
+		return 0, p.errorf("VERSION", "expected 1 to 3 digits, not starting with 0")
+	}
+	v, _ := strconv.Atoi(string(p.b[start:p.i]))
+	return v, nil
+}
+
+// token returns the bytes up to the next SP or the end of the message.
+func (p *parser) token() string {
+	start := p.i
+	for !p.eof() && p.b[p.i] != ' ' {
+		p.i++
+	}
+	return string(p.b[start:p.i])
+}
+
+func (p *parser) timestamp() (time.Time, error) {
+	start := p.i
+	s := p.token()
+	if s == nilValue {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		p.i = start
+		return time.Time{}, p.errorf("TIMESTAMP", "%s", err)
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		frac := strings.IndexAny(s[i+1:], "Zz+-")
+		if frac > maxFracLen {
+			p.i = start
+			return time.Time{}, p.errorf("TIMESTAMP", "more than %d fractional digits", maxFracLen)
+		}
+	}
+	return t, nil
+}
+
+func (p *parser) headerField(field string, maxLen int) (string, error) {
+	start := p.i
+	s := p.token()
+	if s == "" {
+		return "", p.errorf(field, "empty value")
+	}
+	if len(s) > maxLen {
+		p.i = start
+		return "", p.errorf(field, "longer than %d characters", maxLen)
+	}
+	for i := 0; i < len(s); i++ {
+		if !isPrintUSASCII(s[i]) {
+			p.i = start + i
+			return "", p.errorf(field, "non printable character %q", s[i])
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) structuredData() ([]SDElement, error) {
+	if p.eof() {
+		return nil, p.errorf("STRUCTURED-DATA", "missing")
+	}
+	if p.b[p.i] == '-' {
+		p.i++
+		if !p.eof() && p.b[p.i] != ' ' {
+			return nil, p.errorf("STRUCTURED-DATA", "expected SP after nil value")
+		}
+		return nil, nil
+	}
+
+	var elements []SDElement
+	for !p.eof() && p.b[p.i] == '[' {
+		p.i++
+		id, err := p.sdName("SD-ID")
+		if err != nil {
+			return nil, err
+		}
+		e := SDElement{ID: id}
+		for !p.eof() && p.b[p.i] == ' ' {
+			p.i++
+			param, err := p.sdParam()
+			if err != nil {
+				return nil, err
+			}
+			e.Params = append(e.Params, param)
+		}
+		if p.eof() || p.b[p.i] != ']' {
+			return nil, p.errorf("SD-ELEMENT", "expected ']'")
+		}
+		p.i++
+		elements = append(elements, e)
+	}
+	if elements == nil {
+		return nil, p.errorf("STRUCTURED-DATA", "expected '-' or '['")
+	}
+	if !p.eof() && p.b[p.i] != ' ' {
+		return nil, p.errorf("STRUCTURED-DATA", "expected SP or '[' after SD-ELEMENT")
+	}
+	return elements, nil
+}
+
+func (p *parser) sdName(field string) (string, error) {
+	start := p.i
+	for !p.eof() && isSDNameChar(p.b[p.i]) {
+		p.i++
+	}
+	n := p.i - start
+	if n == 0 {
+		return "", p.errorf(field, "empty name")
+	}
+	// Enterprise-specific SD-IDs may exceed the limit, hosted providers
+	// route by such tokens
+	if n > 32 && !(field == "SD-ID" && bytes.IndexByte(p.b[start:p.i], '@') >= 0) {
+		p.i = start
+		return "", p.errorf(field, "longer than 32 characters")
+	}
+	return string(p.b[start:p.i]), nil
+}
+
+func (p *parser) sdParam() (SDParam, error) {
+	name, err := p.sdName("PARAM-NAME")
+	if err != nil {
+		return SDParam{}, err
+	}
+	if p.eof() || p.b[p.i] != '=' {
+		return SDParam{}, p.errorf("SD-PARAM", "expected '='")
+	}
+	p.i++
+	if p.eof() || p.b[p.i] != '"' {
+		return SDParam{}, p.errorf("PARAM-VALUE", "expected '\"'")
+	}
+	p.i++
+
+	var value []byte
+	for {
+		if p.eof() {
+			return SDParam{}, p.errorf("PARAM-VALUE", "unterminated value")
+		}
+		c := p.b[p.i]
+		switch c {
+		case '"':
+			p.i++
+			if !utf8.Valid(value) {
+				return SDParam{}, p.errorf("PARAM-VALUE", "invalid UTF-8")
+			}
+			return SDParam{Name: name, Value: string(value)}, nil
+		case ']':
+			return SDParam{}, p.errorf("PARAM-VALUE", "unescaped ']'")
+		case '\\':
+			if p.i+1 < len(p.b) {
+				switch next := p.b[p.i+1]; next {
+				case '"', '\\', ']':
+					value = append(value, next)
+					p.i += 2
+					continue
+				}
+			}
+		}
+		value = append(value, c)
+		p.i++
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isPrintUSASCII(c byte) bool {
+	return c >= 33 && c <= 126
+}
+
+func isSDNameChar(c byte) bool {
+	return isPrintUSASCII(c) && c != '=' && c != ']' && c != '"'
+}
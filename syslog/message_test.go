@@ -0,0 +1,94 @@
+package syslog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMessage(t *testing.T) {
+	b := []byte(`<165>1 2003-10-11T22:14:15.003000Z mymachine.example.com evntslog - ID47 ` +
+		`[exampleSDID@32473 iut="3" eventSource="Application"][meta k="a\"b\]c\\"]` + " \xef\xbb\xbf" + `{"msg":"hi"}`)
+	m, err := ParseMessage(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := &Message{
+		Priority:  165,
+		Version:   1,
+		Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+		Hostname:  "mymachine.example.com",
+		AppName:   "evntslog",
+		ProcID:    "-",
+		MsgID:     "ID47",
+		StructuredData: []SDElement{
+			{ID: "exampleSDID@32473", Params: []SDParam{{"iut", "3"}, {"eventSource", "Application"}}},
+			{ID: "meta", Params: []SDParam{{"k", `a"b]c\`}}},
+		},
+		Msg: []byte(`{"msg":"hi"}`),
+		BOM: true,
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Expected message: %+v, actual: %+v", expected, m)
+	}
+	if m.Severity() != LOG_NOTICE || m.Facility() != LOG_LOCAL4 {
+		t.Fatalf("Wrong severity %d or facility %d", m.Severity(), m.Facility())
+	}
+}
+
+func TestParseMessageLongEnterpriseSDID(t *testing.T) {
+	m, err := ParseMessage([]byte("<13>1 - - - - - [b5a3f2c1-1234-4abc-9def-0123456789ab@41058 tag=\"web\"]"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if id := m.StructuredData[0].ID; id != "b5a3f2c1-1234-4abc-9def-0123456789ab@41058" {
+		t.Fatalf("Wrong SD-ID: %s", id)
+	}
+}
+
+func TestParseMessageNoMsg(t *testing.T) {
+	m, err := ParseMessage([]byte("<13>1 - - - - - -"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !m.Timestamp.IsZero() || m.StructuredData != nil || m.Msg != nil {
+		t.Fatalf("Expected nil values, actual: %+v", m)
+	}
+}
+
+func TestParseMessageErrors(t *testing.T) {
+	for _, tt := range []struct {
+		msg    string
+		field  string
+		offset int
+	}{
+		{"", "PRI", 0},
+		{"<192>1 - - - - - -", "PRI", 4},
+		{"<013>1 - - - - - -", "PRI", 4},
+		{"<13>0 - - - - - -", "VERSION", 4},
+		{"<13>1  - - - - -", "TIMESTAMP", 6},
+		{"<13>1 2003-10-11 - - - - -", "TIMESTAMP", 6},
+		{"<13>1 2003-10-11T22:14:15.0030001Z - - - - -", "TIMESTAMP", 6},
+		{"<13>1 - host\x01 - - - -", "HOSTNAME", 12},
+		{"<13>1 - - aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa - - -", "APP-NAME", 10},
+		{"<13>1 - - - - - ", "STRUCTURED-DATA", 16},
+		{"<13>1 - - - - - x", "STRUCTURED-DATA", 16},
+		{"<13>1 - - - - - [id k=v]", "PARAM-VALUE", 22},
+		{`<13>1 - - - - - [id k="v]`, "PARAM-VALUE", 24},
+		{`<13>1 - - - - - [id k="v"`, "SD-ELEMENT", 25},
+		{`<13>1 - - - - - [id k="v"]x`, "STRUCTURED-DATA", 26},
+		{"<13>1 - - - - - -x", "STRUCTURED-DATA", 17},
+		{"<13>1 - - - - - [012345678901234567890123456789012]", "SD-ID", 17},
+		{"<13>1 - - - - - - \xef\xbb\xbf\xff", "MSG", 18},
+	} {
+		_, err := ParseMessage([]byte(tt.msg))
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("Expected *ParseError for %q, actual: %v", tt.msg, err)
+		}
+		if perr.Field != tt.field || perr.Offset != tt.offset {
+			t.Fatalf("Expected %s at %d for %q, actual: %s", tt.field, tt.offset, tt.msg, perr)
+		}
+	}
+}
@@ -42,10 +42,14 @@ const (
 	LOG_CRON
 	LOG_AUTHPRIV
 	LOG_FTP
-	_ // unused
-	_ // unused
-	_ // unused
-	_ // unused
+
+	// Not in every syslog.h, codes 12 to 14 are named after FreeBSD and
+	// RFC5424's descriptions.
+
+	LOG_NTP
+	LOG_SECURITY // "log audit" in RFC5424
+	LOG_CONSOLE  // "log alert" in RFC5424
+	_            // clock daemon
 	LOG_LOCAL0
 	LOG_LOCAL1
 	LOG_LOCAL2
@@ -70,6 +74,10 @@ var (
 		"CRON":     LOG_CRON,
 		"AUTHPRIV": LOG_AUTHPRIV,
 		"FTP":      LOG_FTP,
+		"NTP":      LOG_NTP,
+		"SECURITY": LOG_SECURITY,
+		"AUDIT":    LOG_AUDIT,
+		"CONSOLE":  LOG_CONSOLE,
 		"LOCAL0":   LOG_LOCAL0,
 		"LOCAL1":   LOG_LOCAL1,
 		"LOCAL2":   LOG_LOCAL2,
@@ -81,6 +89,96 @@ var (
 	}
 )
 
+// LOG_AUDIT is LOG_SECURITY, as named by RFC5424.
+const LOG_AUDIT = LOG_SECURITY
+
+const (
+	severityMask = 0x07
+	facilityMask = 0xf8
+	maxFacility  = LOG_LOCAL7
+)
+
+// Valid returns an error unless p combines a facility from LOG_KERN to
+// LOG_LOCAL7 with a severity, a facility or a severity alone being valid
+// priorities too.
+func Valid(p Priority) error {
+	if p < 0 || p > maxFacility|LOG_DEBUG {
+		return fmt.Errorf("invalid syslog priority: %d", p)
+	}
+	return nil
+}
+
+// Decompose splits pri into its facility, e.g. LOG_LOCAL0, and severity.
+func Decompose(pri Priority) (facility, severity Priority) {
+	return pri & facilityMask, pri & severityMask
+}
+
+// Compose combines a facility, e.g. LOG_LOCAL0, and a severity into a
+// priority, it fails if either is out of range.
+func Compose(facility, severity Priority) (Priority, error) {
+	if facility < 0 || facility > maxFacility || facility&severityMask != 0 {
+		return 0, fmt.Errorf("invalid syslog facility: %d", facility)
+	}
+	if severity < LOG_EMERG || severity > LOG_DEBUG {
+		return 0, fmt.Errorf("invalid syslog severity: %d", severity)
+	}
+	return facility | severity, nil
+}
+
+// severityKeywords are the severity names of syslog.conf selectors.
+var severityKeywords = [...]string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// Keyword returns the rsyslog keyword of the severity of p, e.g. "warning"
+// for LOG_WARNING, as written in syslog.conf selectors.
+func (p Priority) Keyword() string {
+	return severityKeywords[p&severityMask]
+}
+
+// severityAliases are the keywords KeywordSeverity accepts besides
+// severityKeywords: syslog.conf's deprecated "warn", "error" and "panic",
+// and zap's "fatal".
+var severityAliases = map[string]Priority{
+	"warn":  LOG_WARNING,
+	"error": LOG_ERR,
+	"panic": LOG_EMERG,
+	"fatal": LOG_EMERG,
+}
+
+// KeywordSeverity converts a severity keyword, case-insensitively, into a
+// priority or returns an error. Besides the keywords returned by Keyword,
+// it accepts "warn", "error", and "panic" and "fatal" for LOG_EMERG, as
+// syslog.conf does and as zap's Fatal level maps to. zap's Panic level maps
+// to LOG_CRIT instead.
+func KeywordSeverity(s string) (Priority, error) {
+	keyword := strings.ToLower(s)
+	for i, k := range severityKeywords {
+		if k == keyword {
+			return Priority(i), nil
+		}
+	}
+	if p, ok := severityAliases[keyword]; ok {
+		return p, nil
+	}
+	return 0, fmt.Errorf("invalid syslog severity: %s", s)
+}
+
+// facilityKeywords are the facility names of syslog.conf selectors, by code.
+var facilityKeywords = [...]string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// FacilityKeyword returns the keyword of the facility of p, e.g. "local0"
+// for LOG_LOCAL0, as accepted by FacilityPriority. It returns "" for the
+// unnamed code 15 and out of range priorities.
+func (p Priority) FacilityKeyword() string {
+	if Valid(p) != nil {
+		return ""
+	}
+	return facilityKeywords[p>>3]
+}
+
 // FacilityPriority converts a facility string into
 // an appropriate priority level or returns an error
 func FacilityPriority(facility string) (Priority, error) {
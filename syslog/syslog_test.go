@@ -19,3 +19,123 @@ func TestFacilityPriority(t *testing.T) {
 		t.Fatalf("For invalid facilities, FacilityPriority() should returns error")
 	}
 }
+
+func TestPriorityKeyword(t *testing.T) {
+	for p, expected := range map[Priority]string{
+		LOG_EMERG:               "emerg",
+		LOG_CRIT:                "crit",
+		LOG_ERR:                 "err",
+		LOG_WARNING:             "warning",
+		LOG_INFO:                "info",
+		LOG_DEBUG:               "debug",
+		LOG_LOCAL0 | LOG_NOTICE: "notice",
+	} {
+		if actual := p.Keyword(); actual != expected {
+			t.Fatalf("Expected keyword of %d: %s, actual: %s", p, expected, actual)
+		}
+	}
+}
+
+func TestComposeDecompose(t *testing.T) {
+	pri, err := Compose(LOG_LOCAL4, LOG_NOTICE)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if pri != 165 {
+		t.Fatalf("Expected priority: 165, actual: %d", pri)
+	}
+
+	facility, severity := Decompose(pri)
+	if facility != LOG_LOCAL4 || severity != LOG_NOTICE {
+		t.Fatalf("Expected facility %d and severity %d, actual: %d and %d", LOG_LOCAL4, LOG_NOTICE, facility, severity)
+	}
+
+	for _, c := range [][2]Priority{{-8, LOG_INFO}, {LOG_LOCAL7 + 8, LOG_INFO}, {3, LOG_INFO}, {LOG_USER, 8}, {LOG_USER, -1}} {
+		if _, err := Compose(c[0], c[1]); err == nil {
+			t.Fatalf("Compose(%d, %d) should return error", c[0], c[1])
+		}
+	}
+}
+
+func TestKeywordSeverity(t *testing.T) {
+	for p := LOG_EMERG; p <= LOG_DEBUG; p++ {
+		actual, err := KeywordSeverity(p.Keyword())
+		if err != nil {
+			t.Fatalf("Should not return error on valid keyword: %s", p.Keyword())
+		}
+		if actual != p {
+			t.Fatalf("Expected returned priority: %d, actual: %d", p, actual)
+		}
+	}
+
+	for keyword, expected := range map[string]Priority{
+		"WARN":  LOG_WARNING,
+		"error": LOG_ERR,
+		"panic": LOG_EMERG,
+		"Fatal": LOG_EMERG,
+	} {
+		actual, err := KeywordSeverity(keyword)
+		if err != nil {
+			t.Fatalf("Should not return error on valid alias: %s", keyword)
+		}
+		if actual != expected {
+			t.Fatalf("Expected returned priority for %s: %d, actual: %d", keyword, expected, actual)
+		}
+	}
+
+	if _, err := KeywordSeverity("loud"); err == nil {
+		t.Fatalf("For invalid keywords, KeywordSeverity() should returns error")
+	}
+}
+
+func TestExtendedFacilities(t *testing.T) {
+	for _, f := range []struct {
+		facility Priority
+		code     Priority
+	}{
+		{LOG_NTP, 12},
+		{LOG_SECURITY, 13},
+		{LOG_AUDIT, 13},
+		{LOG_CONSOLE, 14},
+		{LOG_LOCAL0, 16},
+	} {
+		if f.facility != f.code<<3 {
+			t.Fatalf("Expected facility code: %d, actual: %d", f.code, f.facility>>3)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, p := range []Priority{0, LOG_LOCAL7 | LOG_DEBUG, LOG_USER, LOG_NTP | LOG_ERR} {
+		if err := Valid(p); err != nil {
+			t.Fatalf("Should not return error on valid priority: %d", p)
+		}
+	}
+	for _, p := range []Priority{-1, 192, 1 << 10} {
+		if err := Valid(p); err == nil {
+			t.Fatalf("For invalid priority %d, Valid() should returns error", p)
+		}
+	}
+}
+
+func TestFacilityKeyword(t *testing.T) {
+	for _, facility := range []Priority{LOG_KERN, LOG_AUTHPRIV, LOG_SECURITY, LOG_LOCAL0, LOG_LOCAL7} {
+		keyword := (facility | LOG_ERR).FacilityKeyword()
+		actual, err := FacilityPriority(keyword)
+		if err != nil {
+			t.Fatalf("Should not return error on facility keyword: %s", keyword)
+		}
+		if actual != facility {
+			t.Fatalf("Expected facility for %s: %d, actual: %d", keyword, facility, actual)
+		}
+	}
+	if keyword := LOG_LOCAL3.FacilityKeyword(); keyword != "local3" {
+		t.Fatalf("Expected keyword: local3, actual: %s", keyword)
+	}
+	if keyword := Priority(15 << 3).FacilityKeyword(); keyword != "" {
+		t.Fatalf("Expected no keyword for code 15, actual: %s", keyword)
+	}
+	if keyword := Priority(192).FacilityKeyword(); keyword != "" {
+		t.Fatalf("Expected no keyword out of range, actual: %s", keyword)
+	}
+}
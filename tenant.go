@@ -0,0 +1,332 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultTenantMaxConns    = 64
+	defaultTenantDialBackoff = time.Second
+	maxTenantDialBackoff     = time.Minute
+)
+
+// TenantRoute is where the entries of a tenant go, empty values keep those
+// of the core.
+type TenantRoute struct {
+	App      string
+	Hostname string
+	// Address of the syslog server the entries are sent to instead of the
+	// core's syncer.
+	Address string
+}
+
+// TenantConfig configures NewTenantCore.
+type TenantConfig struct {
+	// Key is the field holding the tenant, as a string, either added with
+	// With or to the entry, which takes precedence.
+	Key string
+	// Route returns the route of a tenant, it must be safe for concurrent
+	// use.
+	Route func(tenant string) TenantRoute
+	// Network of the tenant addresses, defaults to tcp.
+	Network string
+	// SyncerOptions configure the connections to the tenant addresses.
+	SyncerOptions []SyncerOption
+	// MaxConns caps the cached connections and failures, 64 by default. The
+	// least recently used one is closed to make room for a new address.
+	MaxConns int
+	// DialBackoff is how long entries routed to an address fail right away
+	// after a failed connection, 1s by default. It doubles with each further
+	// failure, up to a minute.
+	DialBackoff time.Duration
+}
+
+// tenantRouter holds the connections to the tenant addresses, shared by the
+// cores derived from the same NewTenantCore. Connections are opened without
+// holding mu, so that a slow address only delays the entries routed to it.
+type tenantRouter struct {
+	cfg TenantConfig
+
+	mu     sync.Mutex
+	conns  map[string]*tenantConn
+	closed bool
+}
+
+// tenantConn is the connection to a tenant address, or the latest failure
+// to open it.
+type tenantConn struct {
+	ready    chan struct{} // closed once the connection is opened or failed
+	s        *ConnSyncer
+	err      error
+	failures int
+	retryAt  time.Time
+	lastUsed time.Time
+}
+
+type tenantCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	ws     zapcore.WriteSyncer
+	router *tenantRouter
+	tenant string
+}
+
+var _ io.Closer = &tenantCore{}
+
+// NewTenantCore returns a core for gateways logging on behalf of tenants:
+// the APP-NAME, HOSTNAME and destination of each entry are those routed for
+// its tenant, as found in the cfg.Key field. Entries without tenant go to
+// ws as encoded by enc, which should be created by NewSyslogEncoder.
+// Connections to the tenant addresses are opened on first use and kept for
+// the next entries, of any tenant routed to the same address, up to
+// cfg.MaxConns. Failures to connect are kept too, entries routed to the
+// address fail right away until cfg.DialBackoff elapses. The core is an
+// io.Closer, closing it closes these connections.
+func NewTenantCore(cfg TenantConfig, enc zapcore.Encoder, ws zapcore.WriteSyncer, enab zapcore.LevelEnabler) zapcore.Core {
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
+	}
+	if cfg.MaxConns <= 0 {
+		cfg.MaxConns = defaultTenantMaxConns
+	}
+	if cfg.DialBackoff <= 0 {
+		cfg.DialBackoff = defaultTenantDialBackoff
+	}
+	return &tenantCore{
+		LevelEnabler: enab,
+		enc:          enc,
+		ws:           ws,
+		router:       &tenantRouter{cfg: cfg, conns: make(map[string]*tenantConn)},
+	}
+}
+
+// tenantOf returns the tenant set by fields, or tenant if none is.
+func (c *tenantCore) tenantOf(fields []zapcore.Field, tenant string) string {
+	for _, f := range fields {
+		if f.Key == c.router.cfg.Key && f.Type == zapcore.StringType {
+			tenant = f.String
+		}
+	}
+	return tenant
+}
+
+func (c *tenantCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	clone.tenant = c.tenantOf(fields, c.tenant)
+	return &clone
+}
+
+func (c *tenantCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *tenantCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc, ws := c.enc, c.ws
+	if tenant := c.tenantOf(fields, c.tenant); tenant != "" && c.router.cfg.Route != nil {
+		r := c.router.cfg.Route(tenant)
+		if r.App != "" {
+			enc = WithApp(enc, r.App)
+		}
+		if r.Hostname != "" {
+			enc = WithHostname(enc, r.Hostname)
+		}
+		if r.Address != "" {
+			s, err := c.router.conn(r.Address)
+			if err != nil {
+				return err
+			}
+			ws = s
+		}
+	}
+
+	buf, err := enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	_, err = ws.Write(buf.Bytes())
+	buf.Free()
+	if err != nil {
+		return err
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		// Like zap's own cores, sync as the process is likely to exit
+		ws.Sync()
+	}
+	return nil
+}
+
+// Sync syncs the core's syncer and the tenant connections.
+func (c *tenantCore) Sync() error {
+	err := c.ws.Sync()
+	for _, s := range c.router.syncers() {
+		if serr := s.Sync(); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// Close closes the tenant connections, the core's syncer is left open.
+func (c *tenantCore) Close() error {
+	c.router.mu.Lock()
+	c.router.closed = true
+	c.router.mu.Unlock()
+	var err error
+	for _, s := range c.router.syncers() {
+		if cerr := s.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	c.router.mu.Lock()
+	c.router.conns = make(map[string]*tenantConn)
+	c.router.mu.Unlock()
+	return err
+}
+
+// syncers returns the open tenant connections.
+func (r *tenantRouter) syncers() []*ConnSyncer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var syncers []*ConnSyncer
+	for _, tc := range r.conns {
+		select {
+		case <-tc.ready:
+			if tc.s != nil {
+				syncers = append(syncers, tc.s)
+			}
+		default:
+		}
+	}
+	return syncers
+}
+
+// conn returns the connection to addr, opening it if needed. Entries routed
+// to an address being connected to wait for it, those routed to an address
+// that recently failed get the failure again.
+func (r *tenantRouter) conn(addr string) (*ConnSyncer, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, newSyncerError(ErrNotConnected, errSyncerClosed)
+	}
+	now := time.Now()
+	tc, ok := r.conns[addr]
+	if ok {
+		tc.lastUsed = now
+		select {
+		case <-tc.ready:
+			if tc.s != nil || now.Before(tc.retryAt) {
+				r.mu.Unlock()
+				return tc.s, tc.err
+			}
+			// Retry, keeping the failure count for the backoff
+			tc = &tenantConn{ready: make(chan struct{}), failures: tc.failures, lastUsed: now}
+			r.conns[addr] = tc
+		default:
+			r.mu.Unlock()
+			<-tc.ready
+			return tc.s, tc.err
+		}
+	} else {
+		tc = &tenantConn{ready: make(chan struct{}), lastUsed: now}
+		r.conns[addr] = tc
+	}
+	evicted := r.evict()
+	r.mu.Unlock()
+	if evicted != nil {
+		evicted.Close()
+	}
+
+	s, err := NewConnSyncer(r.cfg.Network, addr, r.cfg.SyncerOptions...)
+
+	r.mu.Lock()
+	if err == nil && r.closed {
+		s.Close()
+		s, err = nil, errSyncerClosed
+	}
+	if err != nil {
+		tc.err = newSyncerError(ErrNotConnected, err)
+		tc.failures++
+		tc.retryAt = time.Now().Add(r.backoff(tc.failures))
+	}
+	tc.s = s
+	close(tc.ready)
+	r.mu.Unlock()
+	return tc.s, tc.err
+}
+
+// backoff returns how long to wait before connecting again after the given
+// number of consecutive failures.
+func (r *tenantRouter) backoff(failures int) time.Duration {
+	limit := maxTenantDialBackoff
+	if r.cfg.DialBackoff > limit {
+		limit = r.cfg.DialBackoff
+	}
+	d := r.cfg.DialBackoff
+	for i := 1; i < failures && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	return d
+}
+
+// evict removes the least recently used entry once there are more than
+// MaxConns, it returns its connection, which must be closed without holding
+// mu. Entries being connected are kept.
+func (r *tenantRouter) evict() *ConnSyncer {
+	if len(r.conns) <= r.cfg.MaxConns {
+		return nil
+	}
+	var (
+		oldest string
+		lru    *tenantConn
+	)
+	for addr, tc := range r.conns {
+		select {
+		case <-tc.ready:
+		default:
+			continue
+		}
+		if lru == nil || tc.lastUsed.Before(lru.lastUsed) {
+			oldest, lru = addr, tc
+		}
+	}
+	if lru == nil {
+		return nil
+	}
+	delete(r.conns, oldest)
+	return lru.s
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTenantCore(t *testing.T) {
+	done := make(chan string, 1)
+	addr, sock, srvWG := startServer("tcp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	var local bytes.Buffer
+	core := NewTenantCore(TenantConfig{
+		Key: "tenant",
+		Route: func(tenant string) TenantRoute {
+			switch tenant {
+			case "acme":
+				return TenantRoute{App: "acme-app", Hostname: "acme.example.com", Address: addr}
+			case "initech":
+				return TenantRoute{App: "initech-app"}
+			}
+			return TenantRoute{}
+		},
+	}, NewSyslogEncoder(testEncoderConfig(NonTransparentFraming)), zapcore.AddSync(&local), zapcore.InfoLevel)
+	defer core.(io.Closer).Close()
+	logger := zap.New(core)
+
+	logger.Info("no tenant")
+	assert.Contains(t, local.String(), " localhost encoder_test 9876 ")
+	local.Reset()
+
+	logger.With(zap.String("tenant", "acme")).Info("acme")
+	assert.Contains(t, <-done, " acme.example.com acme-app 9876 ")
+	logger.Info("acme", zap.String("tenant", "acme"))
+	assert.Contains(t, <-done, " acme.example.com acme-app 9876 ")
+	assert.Len(t, core.(*tenantCore).router.syncers(), 1, "The connection should be reused.")
+
+	// The entry's field takes precedence
+	logger.With(zap.String("tenant", "acme")).Info("initech", zap.String("tenant", "initech"))
+	assert.Contains(t, local.String(), " localhost initech-app 9876 ")
+	assert.Equal(t, 1, strings.Count(local.String(), "\n"))
+
+	require.NoError(t, core.(io.Closer).Close())
+	assert.Error(t, core.Write(zapcore.Entry{Level: zapcore.InfoLevel}, []zapcore.Field{zap.String("tenant", "acme")}))
+}
+
+func TestTenantCoreSlowAddress(t *testing.T) {
+	cert, ca := generateTestCert()
+	done := make(chan string, 1)
+	addr, sock, srvWG := startTLSServer(&tls.Config{Certificates: []tls.Certificate{cert}}, done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	// Accepts connections but never completes the TLS handshake
+	slow, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	var conns []net.Conn
+	var mu sync.Mutex
+	go func() {
+		for {
+			c, err := slow.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+		}
+	}()
+
+	core := NewTenantCore(TenantConfig{
+		Key: "tenant",
+		Route: func(tenant string) TenantRoute {
+			if tenant == "slow" {
+				return TenantRoute{Address: slow.Addr().String()}
+			}
+			return TenantRoute{Address: addr}
+		},
+		SyncerOptions: []SyncerOption{WithTLSConfig(testClientTLSConfig(ca))},
+	}, NewSyslogEncoder(testEncoderConfig(NonTransparentFraming)), zapcore.AddSync(ioutil.Discard), zapcore.InfoLevel)
+	defer core.(io.Closer).Close()
+	logger := zap.New(core)
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		logger.Info("stuck", zap.String("tenant", "slow"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	fastDone := make(chan struct{})
+	go func() {
+		defer close(fastDone)
+		logger.Info("fast", zap.String("tenant", "fast"))
+	}()
+	select {
+	case <-fastDone:
+	case <-time.After(time.Second):
+		t.Fatal("A slow tenant address shouldn't delay the others.")
+	}
+	assert.Contains(t, <-done, "fast")
+
+	slow.Close()
+	mu.Lock()
+	for _, c := range conns {
+		c.Close()
+	}
+	mu.Unlock()
+	<-slowDone
+}
+
+func TestTenantCoreDialBackoff(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	core := NewTenantCore(TenantConfig{
+		Key:         "tenant",
+		Route:       func(string) TenantRoute { return TenantRoute{Address: addr} },
+		DialBackoff: time.Hour,
+	}, NewSyslogEncoder(testEncoderConfig(NonTransparentFraming)), zapcore.AddSync(ioutil.Discard), zapcore.InfoLevel)
+	defer core.(io.Closer).Close()
+	router := core.(*tenantCore).router
+	fields := []zapcore.Field{zap.String("tenant", "acme")}
+
+	err = core.Write(zapcore.Entry{Level: zapcore.InfoLevel}, fields)
+	assert.True(t, errors.Is(err, ErrNotConnected), "Unexpected error: %v", err)
+	router.mu.Lock()
+	failed := router.conns[addr]
+	router.mu.Unlock()
+	require.NotNil(t, failed)
+
+	assert.Error(t, core.Write(zapcore.Entry{Level: zapcore.InfoLevel}, fields))
+	router.mu.Lock()
+	assert.True(t, router.conns[addr] == failed, "The failure should be cached during the backoff.")
+	router.mu.Unlock()
+
+	assert.Equal(t, time.Hour, router.backoff(1))
+	router.cfg.DialBackoff = time.Second
+	assert.Equal(t, 4*time.Second, router.backoff(3))
+	assert.Equal(t, time.Minute, router.backoff(20))
+}
+
+func TestTenantCoreMaxConns(t *testing.T) {
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		addr, sock, srvWG := startServer("tcp", "", make(chan string, 1))
+		defer srvWG.Wait()
+		defer sock.Close()
+		addrs = append(addrs, addr)
+	}
+
+	core := NewTenantCore(TenantConfig{
+		Key:      "tenant",
+		Route:    func(tenant string) TenantRoute { return TenantRoute{Address: tenant} },
+		MaxConns: 1,
+	}, NewSyslogEncoder(testEncoderConfig(NonTransparentFraming)), zapcore.AddSync(ioutil.Discard), zapcore.InfoLevel)
+	defer core.(io.Closer).Close()
+	router := core.(*tenantCore).router
+
+	require.NoError(t, core.Write(zapcore.Entry{Level: zapcore.InfoLevel}, []zapcore.Field{zap.String("tenant", addrs[0])}))
+	first := router.syncers()[0]
+	require.NoError(t, core.Write(zapcore.Entry{Level: zapcore.InfoLevel}, []zapcore.Field{zap.String("tenant", addrs[1])}))
+
+	syncers := router.syncers()
+	require.Len(t, syncers, 1, "The least recently used connection should be evicted.")
+	assert.True(t, syncers[0] != first)
+	first.mu.Lock()
+	assert.True(t, first.closed, "Evicted connections should be closed.")
+	first.mu.Unlock()
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/buffer"
+)
+
+// timestampCache renders header timestamps, reusing the date, time and zone
+// of the last second rendered, as consecutive entries mostly fall in the
+// same second. It's safe for concurrent use.
+type timestampCache struct {
+	last atomic.Value // of *cachedSecond
+}
+
+// cachedSecond holds the rendered parts of a second, the result is the same
+// for all the times of the second in the same location.
+type cachedSecond struct {
+	unix int64
+	loc  *time.Location
+	date string // 2006-01-02T15:04:05
+	zone string // Z07:00
+}
+
+// appendTimestamp appends t formatted with timestampFormat.
+func (c *timestampCache) appendTimestamp(buf *buffer.Buffer, t time.Time) {
+	unix, loc := t.Unix(), t.Location()
+	s, _ := c.last.Load().(*cachedSecond)
+	if s == nil || s.unix != unix || s.loc != loc {
+		s = &cachedSecond{
+			unix: unix,
+			loc:  loc,
+			date: t.Format("2006-01-02T15:04:05"),
+			zone: t.Format("Z07:00"),
+		}
+		c.last.Store(s)
+	}
+
+	buf.AppendString(s.date)
+	buf.AppendByte('.')
+	// Microseconds, truncated as by time.Format
+	micros := t.Nanosecond() / 1000
+	for div := 100000; div > 0; div /= 10 {
+		buf.AppendByte(byte('0' + micros/div%10))
+	}
+	buf.AppendString(s.zone)
+}
+
+// defaultMaxTimestampDrift is how far ahead of the entry time a monotonic
+// timestamp may be by default.
+const defaultMaxTimestampDrift = time.Second
+
+// monotonicClock makes timestamps strictly increasing at the microsecond
+// precision of the header. It's safe for concurrent use.
+type monotonicClock struct {
+	maxDrift time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// next returns t, or the microsecond following the last time returned if t
+// isn't after it, as long as that's no more than maxDrift ahead of t.
+// Otherwise the clock starts over from t, e.g. after a large clock step.
+func (c *monotonicClock) next(t time.Time) time.Time {
+	// Compare wall clocks, the monotonic readings don't see clock steps
+	t = t.Round(0)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.last.IsZero() {
+		min := c.last.Truncate(time.Microsecond).Add(time.Microsecond)
+		if t.Before(min) && min.Sub(t) <= c.maxDrift {
+			t = min.In(t.Location())
+		}
+	}
+	c.last = t
+	return t
+}
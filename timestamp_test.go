@@ -0,0 +1,123 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// timestampSamples returns times crossing second boundaries, in and out of
+// several zones.
+func timestampSamples() []time.Time {
+	zones := []*time.Location{time.UTC, time.FixedZone("IST", 5*3600+1800), time.FixedZone("", -8*3600)}
+	if ny, err := time.LoadLocation("America/New_York"); err == nil {
+		zones = append(zones, ny)
+	}
+
+	var samples []time.Time
+	// Around a DST change in New York, and before the epoch
+	for _, base := range []time.Time{
+		time.Date(2021, 3, 14, 6, 59, 58, 0, time.UTC),
+		time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC),
+	} {
+		for _, d := range []time.Duration{0, 999999999, time.Second, 1000000001, 1500 * time.Millisecond, time.Hour, time.Hour + 999} {
+			for _, loc := range zones {
+				samples = append(samples, base.Add(d).In(loc), base.Add(d).In(loc))
+			}
+		}
+	}
+	return samples
+}
+
+func TestTimestampCache(t *testing.T) {
+	var c timestampCache
+	buf := &buffer.Buffer{}
+	for _, ts := range timestampSamples() {
+		buf.Reset()
+		c.appendTimestamp(buf, ts)
+		assert.Equal(t, ts.Format(timestampFormat), buf.String())
+	}
+}
+
+func TestTimestampCacheConcurrent(t *testing.T) {
+	var c timestampCache
+	samples := timestampSamples()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			buf := &buffer.Buffer{}
+			for j := range samples {
+				ts := samples[(j+offset)%len(samples)]
+				buf.Reset()
+				c.appendTimestamp(buf, ts)
+				assert.Equal(t, ts.Format(timestampFormat), buf.String())
+			}
+		}(i * 7)
+	}
+	wg.Wait()
+}
+
+func TestMonotonicClock(t *testing.T) {
+	base := time.Date(2017, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	c := &monotonicClock{maxDrift: time.Second}
+	for _, f := range []struct {
+		in, expected time.Time
+	}{
+		{base, base},
+		{base.Add(time.Millisecond), base.Add(time.Millisecond)},
+		// Stepped back, or within the same microsecond
+		{base.Add(-time.Millisecond), base.Add(time.Millisecond + time.Microsecond).Truncate(time.Microsecond)},
+		{base.Add(time.Millisecond + time.Microsecond), base.Add(time.Millisecond + 2*time.Microsecond).Truncate(time.Microsecond)},
+		// Stepped back beyond maxDrift
+		{base.Add(-time.Minute), base.Add(-time.Minute)},
+		{base.Add(-time.Minute + time.Second), base.Add(-time.Minute + time.Second)},
+	} {
+		assert.True(t, f.expected.Equal(c.next(f.in)), "Unexpected time for %v.", f.in)
+	}
+
+	ist := time.FixedZone("IST", 5*3600+1800)
+	assert.Equal(t, ist, c.next(base.Add(-time.Minute).In(ist)).Location())
+}
+
+func TestSyslogEncoderMonotonicTimestamps(t *testing.T) {
+	cfg := testEncoderConfig(NonTransparentFraming)
+	cfg.MonotonicTimestamps = true
+	cfg.TimeKey = "ts"
+	cfg.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	enc := NewSyslogEncoder(cfg)
+
+	for _, expected := range []string{"2017-01-02T03:04:05.123456", "2017-01-02T03:04:05.123457"} {
+		buf, err := enc.Clone().EncodeEntry(testEntry, nil)
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), " "+expected+"Z localhost ")
+		assert.Contains(t, buf.String(), `"ts":"`+expected)
+		buf.Free()
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var errNoPinnedKey = errors.New("zapsyslog: no pinned public key in the certificate chain")
+
+// fipsCipherSuites and fipsCurves are the FIPS 140-2 approved TLS 1.2 cipher
+// suites and key exchange curves.
+var (
+	fipsCipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	}
+	fipsCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521}
+)
+
+// tlsSettings collects the TLS options of a ConnSyncer, the effective
+// tls.Config is built once all options are applied.
+type tlsSettings struct {
+	config       *tls.Config
+	alpn         []string
+	sessionCache tls.ClientSessionCache
+	pins         [][]byte
+	clientCerts  []tls.Certificate
+	fips         bool
+	err          error
+}
+
+func (t *tlsSettings) build() (*tls.Config, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	var cfg *tls.Config
+	if t.config != nil {
+		cfg = t.config.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+
+	if len(t.alpn) > 0 {
+		cfg.NextProtos = t.alpn
+	}
+	if t.sessionCache != nil {
+		cfg.ClientSessionCache = t.sessionCache
+	}
+	if len(t.clientCerts) > 0 {
+		cfg.Certificates = append(cfg.Certificates[:len(cfg.Certificates):len(cfg.Certificates)], t.clientCerts...)
+	}
+	if len(t.pins) > 0 {
+		cfg.VerifyConnection = verifyPinnedPublicKeys(t.pins, cfg.VerifyConnection)
+	}
+	if t.fips {
+		if err := restrictToFIPS(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// restrictToFIPS restricts cfg to TLS 1.2 with the FIPS approved cipher
+// suites and curves, it fails if cfg allows anything else explicitly.
+func restrictToFIPS(cfg *tls.Config) error {
+	if cfg.InsecureSkipVerify {
+		return errors.New("zapsyslog: FIPS TLS profile requires certificate verification")
+	}
+	if cfg.MinVersion != 0 && cfg.MinVersion != tls.VersionTLS12 || cfg.MaxVersion != 0 && cfg.MaxVersion != tls.VersionTLS12 {
+		// TLS 1.3 cipher suites, which include ChaCha20-Poly1305, can't be
+		// restricted, and earlier versions aren't approved
+		return errors.New("zapsyslog: FIPS TLS profile requires TLS 1.2")
+	}
+	cfg.MinVersion = tls.VersionTLS12
+	cfg.MaxVersion = tls.VersionTLS12
+
+	if len(cfg.CipherSuites) == 0 {
+		cfg.CipherSuites = fipsCipherSuites
+	}
+	for _, id := range cfg.CipherSuites {
+		if !isFIPSCipherSuite(id) {
+			return fmt.Errorf("zapsyslog: cipher suite %s not allowed by the FIPS TLS profile", tls.CipherSuiteName(id))
+		}
+	}
+	if len(cfg.CurvePreferences) == 0 {
+		cfg.CurvePreferences = fipsCurves
+	}
+	for _, id := range cfg.CurvePreferences {
+		if !isFIPSCurve(id) {
+			return fmt.Errorf("zapsyslog: curve %v not allowed by the FIPS TLS profile", id)
+		}
+	}
+	return nil
+}
+
+func isFIPSCipherSuite(id uint16) bool {
+	for _, fips := range fipsCipherSuites {
+		if id == fips {
+			return true
+		}
+	}
+	return false
+}
+
+func isFIPSCurve(id tls.CurveID) bool {
+	for _, fips := range fipsCurves {
+		if id == fips {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPinnedPublicKeys returns a tls.Config.VerifyConnection callback
+// checking that the verified certificate chain, or the peer's leaf certificate
+// when verification is skipped, contains one of the pinned keys.
+func verifyPinnedPublicKeys(pins [][]byte, next func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if next != nil {
+			if err := next(cs); err != nil {
+				return err
+			}
+		}
+
+		// Only trust what was verified, the peer may append any certificate
+		// to the chain it sends. Without verification, the leaf is all there
+		// is to match.
+		var certs []*x509.Certificate
+		for _, chain := range cs.VerifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+			certs = cs.PeerCertificates[:1]
+		}
+		for _, cert := range certs {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(sum[:], pin) {
+					return nil
+				}
+			}
+		}
+		return errNoPinnedKey
+	}
+}
+
+// tlsOption returns a SyncerOption modifying the TLS settings, any TLS
+// option enables TLS.
+func tlsOption(f func(*tlsSettings)) SyncerOption {
+	return syncerOptionFunc(func(s *ConnSyncer) {
+		if s.tls == nil {
+			s.tls = &tlsSettings{}
+		}
+		f(s.tls)
+	})
+}
+
+// WithTLSConfig makes the syncer connect over TLS with the given config. An
+// empty ServerName defaults to the host of the remote address.
+func WithTLSConfig(cfg *tls.Config) SyncerOption {
+	return tlsOption(func(t *tlsSettings) {
+		t.config = cfg
+	})
+}
+
+// WithALPN sets the ALPN protocols offered to the collector, implies TLS.
+func WithALPN(protos ...string) SyncerOption {
+	return tlsOption(func(t *tlsSettings) {
+		t.alpn = protos
+	})
+}
+
+// WithTLSSessionCache enables TLS session resumption with the given cache,
+// e.g. tls.NewLRUClientSessionCache(0), reducing the handshake cost of
+// reconnections. Implies TLS.
+//
+// TLS 1.3 session tickets arrive after the handshake and are only processed
+// when reading from the connection, which the syncer never does, so
+// resumption is effective with TLS 1.2 collectors only.
+func WithTLSSessionCache(cache tls.ClientSessionCache) SyncerOption {
+	return tlsOption(func(t *tlsSettings) {
+		t.sessionCache = cache
+	})
+}
+
+// WithPinnedPublicKeys requires the collector's certificate chain to contain
+// one of the given public keys, each pin is the base64 encoded SHA-256 hash
+// of a DER SubjectPublicKeyInfo (as in HPKP). Pinning is checked in addition
+// to CA validation, against the verified chains. Set InsecureSkipVerify in
+// the TLS config to rely on the pins only, the collector's leaf certificate
+// must then be pinned. Implies TLS.
+func WithPinnedPublicKeys(pins ...string) SyncerOption {
+	return tlsOption(func(t *tlsSettings) {
+		for _, pin := range pins {
+			b, err := base64.StdEncoding.DecodeString(pin)
+			if err == nil && len(b) != sha256.Size {
+				err = fmt.Errorf("expected %d bytes, got %d", sha256.Size, len(b))
+			}
+			if err != nil {
+				t.err = fmt.Errorf("zapsyslog: invalid public key pin %q: %v", pin, err)
+				return
+			}
+			t.pins = append(t.pins, b)
+		}
+	})
+}
+
+// WithClientSigner authenticates to the collector with the given certificate
+// chain, leaf first, whose private key is only available as a crypto.Signer,
+// e.g. backed by a TPM, an HSM or a PKCS#11 token. Implies TLS.
+func WithClientSigner(chain []*x509.Certificate, key crypto.Signer) SyncerOption {
+	return tlsOption(func(t *tlsSettings) {
+		if len(chain) == 0 {
+			t.err = errors.New("zapsyslog: empty client certificate chain")
+			return
+		}
+		leafKey, err := x509.MarshalPKIXPublicKey(chain[0].PublicKey)
+		if err != nil {
+			t.err = fmt.Errorf("zapsyslog: invalid client certificate: %v", err)
+			return
+		}
+		signerKey, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil || !bytes.Equal(leafKey, signerKey) {
+			t.err = errors.New("zapsyslog: client certificate doesn't match the signer's public key")
+			return
+		}
+
+		cert := tls.Certificate{PrivateKey: key, Leaf: chain[0]}
+		for _, c := range chain {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+		t.clientCerts = append(t.clientCerts, cert)
+	})
+}
+
+// WithFIPSTLS restricts TLS to a FIPS 140-2 compatible profile: TLS 1.2 only,
+// with AES-GCM ECDHE cipher suites over the NIST curves. The syncer fails to
+// start if the TLS config explicitly allows anything else, or skips
+// certificate verification. Only the protocol parameters are restricted,
+// the crypto implementation is Go's. Implies TLS.
+func WithFIPSTLS() SyncerOption {
+	return tlsOption(func(t *tlsSettings) {
+		t.fips = true
+	})
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// generateTestCert creates a self-signed certificate for 127.0.0.1.
+func generateTestCert() (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalf("GenerateKey() failed: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "zapsyslog test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		log.Fatalf("CreateCertificate() failed: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		log.Fatalf("ParseCertificate() failed: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, cert
+}
+
+func startTLSServer(cfg *tls.Config, done chan<- string) (addr string, sock io.Closer, wg *sync.WaitGroup) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		log.Fatalf("startTLSServer failed: %v", err)
+	}
+
+	wg = new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runStreamSyslog(l, done, wg)
+	}()
+	return l.Addr().String(), l, wg
+}
+
+func testClientTLSConfig(ca *x509.Certificate) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return &tls.Config{RootCAs: pool}
+}
+
+func TestTLSWrite(t *testing.T) {
+	cert, ca := generateTestCert()
+	done := make(chan string, 1)
+	addr, sock, srvWG := startTLSServer(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"syslog"},
+	}, done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	s, err := NewConnSyncer("tcp", addr, WithTLSConfig(testClientTLSConfig(ca)), WithALPN("syslog"))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.closeConn()
+
+	if proto := s.conn.(*tls.Conn).ConnectionState().NegotiatedProtocol; proto != "syslog" {
+		t.Errorf("expected ALPN protocol %q, actual %q", "syslog", proto)
+	}
+
+	msg := testMessage + "\n"
+	if _, err := io.WriteString(s, msg); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	if rcvd := <-done; rcvd != msg {
+		t.Errorf("message didn't match: expected=%q, actual=%q", msg, rcvd)
+	}
+}
+
+func TestTLSSessionResumption(t *testing.T) {
+	cert, ca := generateTestCert()
+	addr, sock, srvWG := startTLSServer(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MaxVersion:   tls.VersionTLS12,
+	}, make(chan string, 1))
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	s, err := NewConnSyncer("tcp", addr,
+		WithTLSConfig(testClientTLSConfig(ca)),
+		WithTLSSessionCache(tls.NewLRUClientSessionCache(0)),
+	)
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.closeConn()
+
+	if err := s.connect(); err != nil {
+		t.Fatalf("connect() failed: %v", err)
+	}
+	if !s.conn.(*tls.Conn).ConnectionState().DidResume {
+		t.Error("reconnection should resume the TLS session")
+	}
+}
+
+func TestTLSPinnedPublicKeys(t *testing.T) {
+	cert, ca := generateTestCert()
+	_, other := generateTestCert()
+	addr, sock, srvWG := startTLSServer(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}, make(chan string, 1))
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	pin := func(c *x509.Certificate) string {
+		sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	// In addition to CA validation
+	s, err := NewConnSyncer("tcp", addr, WithTLSConfig(testClientTLSConfig(ca)), WithPinnedPublicKeys(pin(other), pin(ca)))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	s.closeConn()
+
+	// Instead of CA validation
+	s, err = NewConnSyncer("tcp", addr, WithTLSConfig(&tls.Config{InsecureSkipVerify: true}), WithPinnedPublicKeys(pin(ca)))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	s.closeConn()
+
+	_, err = NewConnSyncer("tcp", addr, WithTLSConfig(&tls.Config{InsecureSkipVerify: true}), WithPinnedPublicKeys(pin(other)))
+	if err == nil {
+		t.Fatal("NewConnSyncer() should fail when no pinned key matches")
+	}
+
+	_, err = NewConnSyncer("tcp", addr, WithPinnedPublicKeys("not a pin"))
+	if err == nil {
+		t.Fatal("NewConnSyncer() should fail on invalid pins")
+	}
+}
+
+func TestTLSPinnedPublicKeysAppendedCert(t *testing.T) {
+	pinned, ca := generateTestCert()
+	leaf, _ := generateTestCert()
+	// The server sends a leaf that isn't pinned, followed by the pinned
+	// certificate it doesn't own the key of
+	addr, sock, srvWG := startTLSServer(&tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{leaf.Certificate[0], pinned.Certificate[0]},
+			PrivateKey:  leaf.PrivateKey,
+		}},
+	}, make(chan string, 1))
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	sum := sha256.Sum256(ca.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+	_, err := NewConnSyncer("tcp", addr, WithTLSConfig(&tls.Config{InsecureSkipVerify: true}), WithPinnedPublicKeys(pin))
+	if err == nil {
+		t.Fatal("NewConnSyncer() should fail when the pinned key isn't the leaf's")
+	}
+}
+
+// hardwareSigner hides the concrete key type, like a hardware-backed key would.
+type hardwareSigner struct {
+	crypto.Signer
+}
+
+func TestTLSClientSigner(t *testing.T) {
+	serverCert, serverCA := generateTestCert()
+	clientCert, clientCA := generateTestCert()
+	_, other := generateTestCert()
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA)
+	done := make(chan string, 1)
+	addr, sock, srvWG := startTLSServer(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}, done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	signer := hardwareSigner{clientCert.PrivateKey.(crypto.Signer)}
+	s, err := NewConnSyncer("tcp", addr,
+		WithTLSConfig(testClientTLSConfig(serverCA)),
+		WithClientSigner([]*x509.Certificate{clientCA}, signer),
+	)
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.closeConn()
+
+	msg := testMessage + "\n"
+	if _, err := io.WriteString(s, msg); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	// The server only reads messages from authenticated clients
+	if rcvd := <-done; rcvd != msg {
+		t.Errorf("message didn't match: expected=%q, actual=%q", msg, rcvd)
+	}
+
+	_, err = NewConnSyncer("tcp", addr, WithClientSigner([]*x509.Certificate{other}, signer))
+	if err == nil {
+		t.Fatal("NewConnSyncer() should fail when the certificate doesn't match the signer")
+	}
+}
+
+func TestTLSPermanentErrorNotRetried(t *testing.T) {
+	cert, ca := generateTestCert()
+	addr, sock, srvWG := startTLSServer(&tls.Config{Certificates: []tls.Certificate{cert}}, make(chan string, 1))
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	s, err := NewConnSyncer("tcp", addr, WithTLSConfig(testClientTLSConfig(ca)), WithErrorLogger(zap.New(core)))
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.Close()
+
+	// Reconnect without trusting the server's certificate
+	s.tlsConfig = &tls.Config{}
+	s.closeConn()
+	_, err = io.WriteString(s, testMessage)
+	if !IsPermanent(err) || !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("WriteString() should fail with a permanent error, actual: %v", err)
+	}
+	if n := logs.FilterMessage("zapsyslog: reconnection failed").Len(); n != 1 {
+		t.Errorf("expected a single reconnection attempt, actual: %d", n)
+	}
+}
+
+func TestTLSFIPSProfile(t *testing.T) {
+	cert, ca := generateTestCert()
+	done := make(chan string, 1)
+	addr, sock, srvWG := startTLSServer(&tls.Config{Certificates: []tls.Certificate{cert}}, done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	s, err := NewConnSyncer("tcp", addr, WithTLSConfig(testClientTLSConfig(ca)), WithFIPSTLS())
+	if err != nil {
+		t.Fatalf("NewConnSyncer() failed: %v", err)
+	}
+	defer s.Close()
+	state := s.conn.(*tls.Conn).ConnectionState()
+	if state.Version != tls.VersionTLS12 || state.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 &&
+		state.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("unexpected TLS version %x and cipher suite %s", state.Version, tls.CipherSuiteName(state.CipherSuite))
+	}
+
+	for _, cfg := range []*tls.Config{
+		{InsecureSkipVerify: true},
+		{MaxVersion: tls.VersionTLS13},
+		{MinVersion: tls.VersionTLS10},
+		{CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256}},
+		{CurvePreferences: []tls.CurveID{tls.X25519}},
+	} {
+		if _, err := NewConnSyncer("tcp", addr, WithTLSConfig(cfg), WithFIPSTLS()); err == nil {
+			t.Errorf("NewConnSyncer() should refuse %+v with the FIPS profile", cfg)
+		}
+	}
+}
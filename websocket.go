@@ -0,0 +1,455 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultPingInterval = 30 * time.Second
+	wsGUID              = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxWSControlLen     = 125
+)
+
+// WebSocket opcodes
+const (
+	wsOpBinary = 0x2
+	wsOpClose  = 0x8
+	wsOpPing   = 0x9
+	wsOpPong   = 0xa
+)
+
+var _ zapcore.WriteSyncer = &WebSocketSyncer{}
+
+// A WebSocketOption configures a WebSocketSyncer.
+type WebSocketOption interface {
+	apply(*WebSocketSyncer)
+}
+
+// webSocketOptionFunc wraps a func so it satisfies the WebSocketOption
+// interface.
+type webSocketOptionFunc func(*WebSocketSyncer)
+
+func (f webSocketOptionFunc) apply(s *WebSocketSyncer) {
+	f(s)
+}
+
+// WithWebSocketTLSConfig sets the TLS config of wss:// connections.
+func WithWebSocketTLSConfig(cfg *tls.Config) WebSocketOption {
+	return webSocketOptionFunc(func(s *WebSocketSyncer) {
+		s.tlsConfig = cfg
+	})
+}
+
+// WithWebSocketHeader adds h to the opening handshake requests, e.g. for
+// authentication.
+func WithWebSocketHeader(h http.Header) WebSocketOption {
+	return webSocketOptionFunc(func(s *WebSocketSyncer) {
+		s.header = h
+	})
+}
+
+// WithPingInterval sets how often to ping the server, the default is 30s. A
+// connection whose ping isn't answered by the next one is closed, and the
+// next write reconnects. Zero disables the pings.
+func WithPingInterval(d time.Duration) WebSocketOption {
+	return webSocketOptionFunc(func(s *WebSocketSyncer) {
+		s.pingInterval = d
+	})
+}
+
+// WebSocketSyncer streams messages over a WebSocket, for networks where only
+// HTTP ports are open. Each message is sent as is in a binary message, so
+// with the framing of the encoder. Broken connections are reconnected on the
+// next write, which is retried once. It's safe for concurrent use.
+type WebSocketSyncer struct {
+	mu           sync.Mutex
+	url          *url.URL
+	header       http.Header
+	tlsConfig    *tls.Config
+	pingInterval time.Duration
+
+	conn   *wsConn
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// wsConn is a client WebSocket connection, frames are written under the
+// syncer's lock and read by a background goroutine.
+type wsConn struct {
+	net.Conn
+	br     *bufio.Reader
+	wmu    sync.Mutex // serializes frame writes with the reader's pongs
+	pinged bool       // waiting for a pong, under the syncer's lock
+	ponged int32      // set by the reader
+	dead   chan struct{}
+}
+
+// NewWebSocketSyncer returns a syncer connected to the ws:// or wss://
+// endpoint rawURL.
+func NewWebSocketSyncer(rawURL string, opts ...WebSocketOption) (*WebSocketSyncer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("zapsyslog: unsupported websocket scheme %q", u.Scheme)
+	}
+
+	s := &WebSocketSyncer{
+		url:          u,
+		pingInterval: defaultPingInterval,
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+	if s.conn, err = s.dial(); err != nil {
+		return nil, err
+	}
+	if s.pingInterval > 0 {
+		s.wg.Add(1)
+		go s.keepalive()
+	}
+	return s, nil
+}
+
+// dial connects and performs the opening handshake.
+func (s *WebSocketSyncer) dial() (*wsConn, error) {
+	host := s.url.Host
+	if s.url.Port() == "" {
+		if s.url.Scheme == "wss" {
+			host = net.JoinHostPort(s.url.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(s.url.Hostname(), "80")
+		}
+	}
+
+	var conn net.Conn
+	var err error
+	if s.url.Scheme == "wss" {
+		cfg := s.tlsConfig
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: s.url.Hostname()}
+		}
+		conn, err = tls.Dial("tcp", host, cfg)
+	} else {
+		conn, err = net.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        s.url,
+		Host:       s.url.Host,
+		Header:     make(http.Header),
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+	}
+	for k, v := range s.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("zapsyslog: websocket handshake failed: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		conn.Close()
+		return nil, errors.New("zapsyslog: websocket handshake failed: invalid Sec-WebSocket-Accept")
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &wsConn{Conn: conn, br: br, dead: make(chan struct{})}
+	go c.readLoop()
+	return c, nil
+}
+
+// wsAccept computes the Sec-WebSocket-Accept value expected for key.
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// readLoop answers pings and records pongs until the connection breaks, the
+// server's data messages are discarded.
+func (c *wsConn) readLoop() {
+	defer close(c.dead)
+	defer c.Close()
+	for {
+		op, payload, err := readWSFrame(c.br, false)
+		if err != nil {
+			return
+		}
+		switch op {
+		case wsOpPing:
+			c.wmu.Lock()
+			err = writeWSFrame(c.Conn, wsOpPong, payload, true)
+			c.wmu.Unlock()
+			if err != nil {
+				return
+			}
+		case wsOpPong:
+			atomic.StoreInt32(&c.ponged, 1)
+		case wsOpClose:
+			c.wmu.Lock()
+			writeWSFrame(c.Conn, wsOpClose, payload, true)
+			c.wmu.Unlock()
+			return
+		}
+	}
+}
+
+func (c *wsConn) isDead() bool {
+	select {
+	case <-c.dead:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return writeWSFrame(c.Conn, op, payload, true)
+}
+
+// keepalive pings the server until the syncer is closed.
+func (s *WebSocketSyncer) keepalive() {
+	defer s.wg.Done()
+	t := time.NewTicker(s.pingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+
+		s.mu.Lock()
+		if c := s.conn; c != nil {
+			if c.pinged && atomic.LoadInt32(&c.ponged) == 0 || c.writeFrame(wsOpPing, nil) != nil {
+				c.Close()
+				s.conn = nil
+			} else {
+				c.pinged = true
+				atomic.StoreInt32(&c.ponged, 0)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Write sends p in one WebSocket message, reconnecting and retrying once on
+// failure.
+//
+// The returned errors match ErrNotConnected or ErrDropped with errors.Is.
+func (s *WebSocketSyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for i := 0; i <= defaultWriteRetries; i++ {
+		if s.conn != nil && s.conn.isDead() {
+			s.conn = nil
+		}
+		if s.conn == nil {
+			if s.closed {
+				return 0, newSyncerError(ErrNotConnected, errSyncerClosed)
+			}
+			if s.conn, err = s.dial(); err != nil {
+				err = newSyncerError(ErrNotConnected, err)
+				continue
+			}
+		}
+		if err = s.conn.writeFrame(wsOpBinary, p); err == nil {
+			return len(p), nil
+		}
+		err = newSyncerError(ErrDropped, err)
+		s.conn.Close()
+		s.conn = nil
+	}
+	return 0, err
+}
+
+// Sync implements zapcore.WriteSyncer, messages aren't buffered.
+func (s *WebSocketSyncer) Sync() error {
+	return nil
+}
+
+// Close sends a close frame, closes the connection and stops the pings,
+// later writes fail with ErrNotConnected.
+func (s *WebSocketSyncer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	var err error
+	if c := s.conn; c != nil {
+		// 1000, normal closure
+		err = c.writeFrame(wsOpClose, []byte{0x03, 0xe8})
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+		s.conn = nil
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// writeWSFrame writes a single final frame, masked as clients must.
+func writeWSFrame(w io.Writer, op byte, payload []byte, mask bool) error {
+	hdr := make([]byte, 2, 14+len(payload))
+	hdr[0] = 0x80 | op
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= maxWSControlLen:
+		hdr[1] = maskBit | byte(n)
+	case n <= 0xffff:
+		hdr[1] = maskBit | 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = maskBit | 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+
+	frame := hdr
+	if mask {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		frame = append(frame, key[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= key[i&3]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// readWSFrame reads a frame, unmasking its payload. The payload of data
+// frames is discarded unless keepData is set.
+func readWSFrame(r *bufio.Reader, keepData bool) (op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	op = hdr[0] & 0x0f
+	masked := hdr[1]&0x80 != 0
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	var key [4]byte
+	if masked {
+		if _, err = io.ReadFull(r, key[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if op < wsOpClose && !keepData {
+		_, err = io.CopyN(ioutil.Discard, r, int64(n))
+		return op, nil, err
+	}
+	if op >= wsOpClose && n > maxWSControlLen {
+		return 0, nil, fmt.Errorf("zapsyslog: websocket control frame too large: %d", n)
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i&3]
+		}
+	}
+	return op, payload, nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslog
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startWebSocketServer accepts WebSocket connections, sending the messages
+// received to the returned channel and answering pings if pong is set. It
+// returns the ws:// URL of the server and a counter of connections.
+func startWebSocketServer(t *testing.T, pong bool) (string, <-chan string, *int32) {
+	msgs := make(chan string, 10)
+	var conns int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "bad handshake", http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&conns, 1)
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		brw.WriteString("Sec-WebSocket-Accept: " + wsAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		brw.Flush()
+
+		for {
+			op, payload, err := readWSFrame(brw.Reader, true)
+			if err != nil {
+				return
+			}
+			switch op {
+			case wsOpBinary:
+				msgs <- string(payload)
+			case wsOpPing:
+				if pong {
+					writeWSFrame(conn, wsOpPong, payload, false)
+				}
+			case wsOpClose:
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), msgs, &conns
+}
+
+func TestWebSocketSyncer(t *testing.T) {
+	u, msgs, conns := startWebSocketServer(t, true)
+	s, err := NewWebSocketSyncer(u,
+		WithWebSocketHeader(http.Header{"Authorization": {"Bearer token"}}),
+		WithPingInterval(5*time.Millisecond))
+	require.NoError(t, err)
+
+	long := strings.Repeat("x", 70000)
+	for _, msg := range []string{testMessage, long} {
+		_, err := s.Write([]byte(msg))
+		require.NoError(t, err)
+		assert.Equal(t, msg, <-msgs)
+	}
+
+	// Answered pings keep the connection
+	time.Sleep(50 * time.Millisecond)
+	_, err = s.Write([]byte(testMessage))
+	require.NoError(t, err)
+	<-msgs
+	assert.Equal(t, int32(1), atomic.LoadInt32(conns))
+
+	require.NoError(t, s.Close())
+	_, err = s.Write([]byte(testMessage))
+	assert.True(t, errors.Is(err, ErrNotConnected), "unexpected error: %v", err)
+}
+
+func TestWebSocketSyncerPingTimeout(t *testing.T) {
+	u, msgs, conns := startWebSocketServer(t, false)
+	s, err := NewWebSocketSyncer(u,
+		WithWebSocketHeader(http.Header{"Authorization": {"Bearer token"}}),
+		WithPingInterval(5*time.Millisecond))
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.conn == nil
+	}, time.Second, time.Millisecond, "the connection should be closed without pongs")
+
+	_, err = s.Write([]byte(testMessage))
+	require.NoError(t, err)
+	assert.Equal(t, testMessage, <-msgs)
+	assert.Equal(t, int32(2), atomic.LoadInt32(conns))
+}
+
+func TestWebSocketSyncerHandshakeError(t *testing.T) {
+	u, _, _ := startWebSocketServer(t, true)
+	_, err := NewWebSocketSyncer(u)
+	assert.Error(t, err, "the handshake should fail without authorization")
+
+	_, err = NewWebSocketSyncer("http://localhost")
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package zapsyslogdtls sends syslog messages over DTLS 1.2 (RFC6012), to
+// encrypt datagram syslog where TCP isn't an option:
+//
+//	sink, err := zapsyslogdtls.NewSyncer("collector:6514", &dtls.Config{RootCAs: pool})
+//
+// The messages must be encoded with zapsyslog.OctetCountingFraming, as RFC6012
+// requires. The handshake is done by pion/dtls, with the cookie exchange of
+// RFC6347 when the collector asks for it and flights fragmented to the MTU.
+package zapsyslogdtls
+
+import (
+	"errors"
+	"net"
+
+	zapsyslog "github.com/imperfectgo/zap-syslog"
+	"github.com/pion/dtls/v2"
+)
+
+const (
+	// DefaultMTU is the MTU used when the config doesn't set one, the
+	// default of pion/dtls.
+	DefaultMTU = 1200
+
+	// recordOverhead is the largest a record adds to its payload with the
+	// cipher suites of pion/dtls: the header, and the IV, MAC and padding of
+	// the CBC suites.
+	recordOverhead = 13 + 16 + 20 + 16
+)
+
+// NewSyncer returns a syncer sending to the collector at raddr over DTLS,
+// connecting and reconnecting with cfg. Each message is sent in a record of
+// its own within cfg.MTU, longer messages fail with
+// zapsyslog.ErrMessageTooLarge rather than being fragmented by IP. opts are
+// applied after those, TLS options don't apply.
+func NewSyncer(raddr string, cfg *dtls.Config, opts ...zapsyslog.SyncerOption) (*zapsyslog.ConnSyncer, error) {
+	if cfg == nil {
+		return nil, errors.New("zapsyslog: no DTLS config")
+	}
+	return zapsyslog.NewConnSyncer("udp", raddr, append([]zapsyslog.SyncerOption{
+		zapsyslog.WithDialer(Dialer(cfg)),
+		zapsyslog.WithMaxMessageSize(MaxMessageSize(cfg)),
+	}, opts...)...)
+}
+
+// Dialer returns a zapsyslog.Dialer connecting with cfg, for UDP networks.
+func Dialer(cfg *dtls.Config) zapsyslog.Dialer {
+	return func(network, raddr string) (net.Conn, error) {
+		addr, err := net.ResolveUDPAddr(network, raddr)
+		if err != nil {
+			return nil, err
+		}
+		return dtls.Dial(network, addr, cfg)
+	}
+}
+
+// MaxMessageSize returns the size of the longest framed message sent in a
+// single record within the MTU of cfg.
+func MaxMessageSize(cfg *dtls.Config) int {
+	mtu := cfg.MTU
+	if mtu <= 0 {
+		mtu = DefaultMTU
+	}
+	return mtu - recordOverhead
+}
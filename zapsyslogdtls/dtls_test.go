@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslogdtls
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	zapsyslog "github.com/imperfectgo/zap-syslog"
+	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v2/pkg/crypto/selfsign"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncer(t *testing.T) {
+	cert, err := selfsign.GenerateSelfSigned()
+	require.NoError(t, err)
+	ln, err := dtls.Listen("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, &dtls.Config{
+		Certificates: []tls.Certificate{cert},
+	})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	received := make(chan string, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 8192)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			received <- string(buf[:n])
+		}
+	}()
+
+	cfg := &dtls.Config{InsecureSkipVerify: true}
+	sink, err := NewSyncer(ln.Addr().String(), cfg)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	for _, msg := range []string{"16 <14>1 - - - - - a", "16 <14>1 - - - - - b"} {
+		_, err = sink.Write([]byte(msg))
+		require.NoError(t, err)
+		select {
+		case got := <-received:
+			assert.Equal(t, msg, got)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q not received", msg)
+		}
+	}
+
+	_, err = sink.Write([]byte(strings.Repeat("x", MaxMessageSize(cfg)+1)))
+	assert.True(t, errors.Is(err, zapsyslog.ErrMessageTooLarge), "got %v", err)
+}
+
+func TestSyncerNoConfig(t *testing.T) {
+	_, err := NewSyncer("127.0.0.1:6514", nil)
+	assert.Error(t, err)
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	assert.Equal(t, DefaultMTU-recordOverhead, MaxMessageSize(&dtls.Config{}))
+	assert.Equal(t, 1400-recordOverhead, MaxMessageSize(&dtls.Config{MTU: 1400}))
+}
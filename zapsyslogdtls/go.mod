@@ -0,0 +1,25 @@
+module github.com/imperfectgo/zap-syslog/zapsyslogdtls
+
+go 1.18
+
+require (
+	github.com/imperfectgo/zap-syslog v0.0.0-00010101000000-000000000000
+	github.com/pion/dtls/v2 v2.2.12
+	github.com/stretchr/testify v1.8.4
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pion/logging v0.2.2 // indirect
+	github.com/pion/transport/v2 v2.2.4 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.uber.org/atomic v1.6.0 // indirect
+	go.uber.org/multierr v1.5.0 // indirect
+	go.uber.org/zap v1.16.0 // indirect
+	golang.org/x/crypto v0.18.0 // indirect
+	golang.org/x/net v0.20.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/imperfectgo/zap-syslog => ../
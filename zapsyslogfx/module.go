@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package zapsyslogfx provides a syslog backed *zap.Logger to fx
+// applications:
+//
+//	fx.New(
+//		zapsyslogfx.Module(zapsyslogfx.Config{
+//			Network: "tcp",
+//			Address: "localhost:514",
+//			Encoder: zapsyslog.NewRsyslogEncoderConfig(),
+//		}),
+//		fx.Invoke(func(logger *zap.Logger) { ... }),
+//	)
+package zapsyslogfx
+
+import (
+	"context"
+
+	zapsyslog "github.com/imperfectgo/zap-syslog"
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Config configures the logger provided by Module.
+type Config struct {
+	// Network and Address of the syslog server, as for zapsyslog.NewConnSyncer.
+	Network string
+	Address string
+
+	Encoder zapsyslog.SyslogEncoderConfig
+
+	// Level defaults to zapcore.InfoLevel.
+	Level zapcore.LevelEnabler
+
+	SyncerOptions []zapsyslog.SyncerOption
+	LoggerOptions []zap.Option
+}
+
+// Module returns an fx module providing a *zap.Logger configured by cfg, the
+// logger is flushed and its connection closed when the application stops.
+func Module(cfg Config) fx.Option {
+	return fx.Module("zapsyslog",
+		fx.Provide(func(lc fx.Lifecycle) (*zap.Logger, error) {
+			return New(lc, cfg)
+		}),
+	)
+}
+
+// New returns a logger configured by cfg, with a hook on lc flushing it and
+// closing its connection on stop. It's the constructor behind Module.
+func New(lc fx.Lifecycle, cfg Config) (*zap.Logger, error) {
+	if err := syslog.Valid(cfg.Encoder.Facility); err != nil {
+		return nil, err
+	}
+	sink, err := zapsyslog.NewConnSyncer(cfg.Network, cfg.Address, cfg.SyncerOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	level := cfg.Level
+	if level == nil {
+		level = zapcore.InfoLevel
+	}
+	logger := zap.New(zapcore.NewCore(zapsyslog.NewSyslogEncoder(cfg.Encoder), sink, level), cfg.LoggerOptions...)
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			return multierr.Append(logger.Sync(), sink.Close())
+		},
+	})
+	return logger, nil
+}
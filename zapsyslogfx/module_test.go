@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslogfx
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+
+	zapsyslog "github.com/imperfectgo/zap-syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func TestModule(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	rcvd := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		rcvd <- lines
+	}()
+
+	app := fx.New(
+		fx.NopLogger,
+		Module(Config{
+			Network:       "tcp",
+			Address:       ln.Addr().String(),
+			Encoder:       zapsyslog.NewRsyslogEncoderConfig(),
+			SyncerOptions: []zapsyslog.SyncerOption{zapsyslog.WithWriteBuffer(4096, 4096)},
+		}),
+		fx.Invoke(func(logger *zap.Logger) {
+			logger.Info("hello")
+			logger.Debug("filtered")
+		}),
+	)
+	require.NoError(t, app.Err())
+	require.NoError(t, app.Start(context.Background()))
+	// Stopping flushes the buffered message and closes the connection
+	require.NoError(t, app.Stop(context.Background()))
+
+	lines := <-rcvd
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"msg":"hello"`)
+}
+
+func TestModuleConnectError(t *testing.T) {
+	app := fx.New(
+		fx.NopLogger,
+		Module(Config{Network: "unix", Address: "/nonexistent/socket"}),
+		fx.Invoke(func(*zap.Logger) {}),
+	)
+	assert.Error(t, app.Err())
+}
+
+func TestModuleInvalidFacility(t *testing.T) {
+	cfg := Config{Network: "udp", Address: "localhost:514"}
+	cfg.Encoder.Facility = 1 << 10
+	app := fx.New(
+		fx.NopLogger,
+		Module(cfg),
+		fx.Invoke(func(*zap.Logger) {}),
+	)
+	assert.Error(t, app.Err())
+}
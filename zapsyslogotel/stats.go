@@ -0,0 +1,129 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package zapsyslogotel records zapsyslog syncer metrics with the
+// OpenTelemetry metrics API:
+//
+//	st, err := zapsyslogotel.NewStats(otel.Meter("zapsyslog"))
+//	...
+//	sink, err := zapsyslog.NewConnSyncer("tcp", addr, zapsyslog.WithStats(st))
+package zapsyslogotel
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	zapsyslog "github.com/imperfectgo/zap-syslog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/multierr"
+)
+
+// reasonKey is the attribute of dropped messages telling why they were dropped.
+const reasonKey = attribute.Key("reason")
+
+// reasons map the syncer errors to the values of reasonKey.
+var reasons = []struct {
+	err    error
+	reason string
+}{
+	{zapsyslog.ErrNotConnected, "not_connected"},
+	{zapsyslog.ErrDropped, "write_failed"},
+	{zapsyslog.ErrMessageTooLarge, "too_large"},
+	{zapsyslog.ErrCircuitOpen, "circuit_open"},
+}
+
+type stats struct {
+	attrs   metric.MeasurementOption
+	written metric.Int64Counter
+	bytes   metric.Int64Counter
+	dropped metric.Int64Counter
+	reconns metric.Int64Counter
+	encode  metric.Float64Histogram
+	write   metric.Float64Histogram
+	queue   metric.Float64Histogram
+}
+
+var _ zapsyslog.LatencyStats = &stats{}
+
+// NewStats returns stats recording to instruments created with meter, attrs
+// are added to every measurement, e.g. to tell several syncers apart.
+func NewStats(meter metric.Meter, attrs ...attribute.KeyValue) (zapsyslog.LatencyStats, error) {
+	st := &stats{attrs: metric.WithAttributes(attrs...)}
+	var err, e error
+	counter := func(name, unit, desc string) metric.Int64Counter {
+		var c metric.Int64Counter
+		c, e = meter.Int64Counter(name, metric.WithUnit(unit), metric.WithDescription(desc))
+		err = multierr.Append(err, e)
+		return c
+	}
+	histogram := func(name, desc string) metric.Float64Histogram {
+		var h metric.Float64Histogram
+		h, e = meter.Float64Histogram(name, metric.WithUnit("s"), metric.WithDescription(desc))
+		err = multierr.Append(err, e)
+		return h
+	}
+
+	st.written = counter("zapsyslog.messages.written", "{message}", "Messages written to the syslog server.")
+	st.bytes = counter("zapsyslog.bytes.written", "By", "Bytes written to the syslog server.")
+	st.dropped = counter("zapsyslog.messages.dropped", "{message}", "Messages that couldn't be written, by reason.")
+	st.reconns = counter("zapsyslog.reconnections", "{reconnection}", "Reconnections to the syslog server.")
+	st.encode = histogram("zapsyslog.encode.duration", "Time taken to encode entries.")
+	st.write = histogram("zapsyslog.write.duration", "Time taken to write messages, including retries.")
+	st.queue = histogram("zapsyslog.queue.duration", "Time messages spent queued by asynchronous syncers.")
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (st *stats) Written(n int) {
+	ctx := context.Background()
+	st.written.Add(ctx, 1, st.attrs)
+	st.bytes.Add(ctx, int64(n), st.attrs)
+}
+
+func (st *stats) Dropped(err error) {
+	reason := "other"
+	for _, r := range reasons {
+		if errors.Is(err, r.err) {
+			reason = r.reason
+			break
+		}
+	}
+	st.dropped.Add(context.Background(), 1, st.attrs, metric.WithAttributes(reasonKey.String(reason)))
+}
+
+func (st *stats) Reconnected() {
+	st.reconns.Add(context.Background(), 1, st.attrs)
+}
+
+func (st *stats) ObserveEncode(d time.Duration) {
+	st.encode.Record(context.Background(), d.Seconds(), st.attrs)
+}
+
+func (st *stats) ObserveWrite(d time.Duration) {
+	st.write.Record(context.Background(), d.Seconds(), st.attrs)
+}
+
+func (st *stats) ObserveQueue(d time.Duration) {
+	st.queue.Record(context.Background(), d.Seconds(), st.attrs)
+}
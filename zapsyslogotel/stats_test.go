@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslogotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	zapsyslog "github.com/imperfectgo/zap-syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestStats(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	st, err := NewStats(provider.Meter("test"), attribute.String("syncer", "test"))
+	require.NoError(t, err)
+
+	st.Written(10)
+	st.Written(5)
+	st.Dropped(fmt.Errorf("write: %w", zapsyslog.ErrCircuitOpen))
+	st.Dropped(errors.New("unknown"))
+	st.Reconnected()
+	st.ObserveEncode(time.Millisecond)
+	st.ObserveWrite(2 * time.Millisecond)
+	st.ObserveQueue(3 * time.Millisecond)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	sums := map[string]int64{}
+	histograms := map[string]float64{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			for _, dp := range data.DataPoints {
+				syncer, _ := dp.Attributes.Value("syncer")
+				assert.Equal(t, "test", syncer.AsString())
+				key := m.Name
+				if reason, ok := dp.Attributes.Value(reasonKey); ok {
+					key += "/" + reason.AsString()
+				}
+				sums[key] += dp.Value
+			}
+		case metricdata.Histogram[float64]:
+			for _, dp := range data.DataPoints {
+				histograms[m.Name] += dp.Sum
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]int64{
+		"zapsyslog.messages.written":              2,
+		"zapsyslog.bytes.written":                 15,
+		"zapsyslog.messages.dropped/circuit_open": 1,
+		"zapsyslog.messages.dropped/other":        1,
+		"zapsyslog.reconnections":                 1,
+	}, sums)
+	assert.Equal(t, map[string]float64{
+		"zapsyslog.encode.duration": 0.001,
+		"zapsyslog.write.duration":  0.002,
+		"zapsyslog.queue.duration":  0.003,
+	}, histograms)
+}
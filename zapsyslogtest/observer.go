@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package zapsyslogtest provides helpers to test code logging with zapsyslog.
+package zapsyslogtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	zapsyslog "github.com/imperfectgo/zap-syslog"
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"go.uber.org/zap/zapcore"
+)
+
+const ceeCookie = "@cee:"
+
+// ObservedMessage is a message written by an observer core, as a collector
+// would parse it.
+type ObservedMessage struct {
+	syslog.Message
+	// Fields is the decoded JSON body.
+	Fields map[string]interface{}
+}
+
+// ObservedMessages is a concurrency safe collection of observed messages.
+type ObservedMessages struct {
+	mu       sync.RWMutex
+	messages []ObservedMessage
+}
+
+// Len returns the number of messages observed so far.
+func (o *ObservedMessages) Len() int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return len(o.messages)
+}
+
+// All returns a copy of all the messages observed so far.
+func (o *ObservedMessages) All() []ObservedMessage {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return append([]ObservedMessage(nil), o.messages...)
+}
+
+// TakeAll returns all the messages observed so far and clears them.
+func (o *ObservedMessages) TakeAll() []ObservedMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	messages := o.messages
+	o.messages = nil
+	return messages
+}
+
+// Write parses the framed messages of p, messages failing to parse make it
+// return an error, as zap reports to its ErrorOutput.
+func (o *ObservedMessages) Write(p []byte) (int, error) {
+	s := bufio.NewScanner(bytes.NewReader(p))
+	s.Buffer(nil, len(p)+1)
+	s.Split(syslog.ScanFrames)
+
+	var observed []ObservedMessage
+	for s.Scan() {
+		m, err := syslog.ParseMessage(s.Bytes())
+		if err != nil {
+			return 0, err
+		}
+		msg := ObservedMessage{Message: *m}
+		// The parsed message references p, which the core reuses
+		msg.Msg = append([]byte(nil), m.Msg...)
+		if body := bytes.TrimPrefix(msg.Msg, []byte(ceeCookie)); len(body) > 0 {
+			if err := json.Unmarshal(body, &msg.Fields); err != nil {
+				return 0, err
+			}
+		}
+		observed = append(observed, msg)
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	if len(observed) == 0 {
+		return 0, errors.New("zapsyslogtest: no message written")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, observed...)
+	return len(p), nil
+}
+
+// Sync implements zapcore.WriteSyncer.
+func (o *ObservedMessages) Sync() error {
+	return nil
+}
+
+// NewObserver returns a core encoding entries with a syslog encoder
+// configured by cfg, and the collection they're parsed into.
+func NewObserver(cfg zapsyslog.SyslogEncoderConfig, enab zapcore.LevelEnabler) (zapcore.Core, *ObservedMessages) {
+	o := &ObservedMessages{}
+	return zapcore.NewCore(zapsyslog.NewSyslogEncoder(cfg), o, enab), o
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2017 Timon Wong
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapsyslogtest
+
+import (
+	"testing"
+
+	zapsyslog "github.com/imperfectgo/zap-syslog"
+	"github.com/imperfectgo/zap-syslog/syslog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestObserver(t *testing.T) {
+	for _, framing := range []zapsyslog.Framing{zapsyslog.NonTransparentFraming, zapsyslog.OctetCountingFraming} {
+		cfg := zapsyslog.NewRsyslogEncoderConfig()
+		cfg.Framing = framing
+		cfg.Facility = syslog.LOG_LOCAL3
+		cfg.App = "observed"
+		cfg.StructuredData = []zapsyslog.SDElement{{ID: "meta", Params: []zapsyslog.SDParam{{Name: "k", Value: "v"}}}}
+		core, logs := NewObserver(cfg, zapcore.InfoLevel)
+
+		logger := zap.New(core).With(zap.String("ctx", "c"))
+		logger.Debug("filtered")
+		logger.Warn("hello", zap.Int("n", 1))
+		require.Equal(t, 1, logs.Len())
+
+		messages := logs.TakeAll()
+		require.Len(t, messages, 1)
+		assert.Equal(t, 0, logs.Len())
+
+		m := messages[0]
+		assert.Equal(t, syslog.LOG_LOCAL3, m.Facility())
+		assert.Equal(t, syslog.LOG_WARNING, m.Severity())
+		assert.Equal(t, "observed", m.AppName)
+		assert.Equal(t, []syslog.SDElement{{ID: "meta", Params: []syslog.SDParam{{Name: "k", Value: "v"}}}}, m.StructuredData)
+		assert.Equal(t, "hello", m.Fields["msg"])
+		assert.Equal(t, "c", m.Fields["ctx"])
+		assert.Equal(t, float64(1), m.Fields["n"])
+	}
+}
+
+func TestObserverParseError(t *testing.T) {
+	_, err := (&ObservedMessages{}).Write([]byte("not syslog\n"))
+	assert.Error(t, err)
+}